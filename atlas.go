@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/padurean/make-image-transparent/imagetransparent"
+)
+
+// atlasSprite is the rectangle of a sprite in the sprite sheet
+type atlasSprite struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// atlas describes a sprite sheet: its image file, its size and the rectangles
+// of its sprites, by the names of their input files
+type atlas struct {
+	Image   string                 `json:"image"`
+	Width   int                    `json:"width"`
+	Height  int                    `json:"height"`
+	Sprites map[string]atlasSprite `json:"sprites"`
+}
+
+// atlasFileName returns the name of the JSON atlas of the sprite sheet
+// sheetFileName: the same, with the .json extension
+func atlasFileName(sheetFileName string) string {
+	return strings.TrimSuffix(sheetFileName, filepath.Ext(sheetFileName)) + ".json"
+}
+
+// packSprites places rectangles of the given sizes in a sheet, without
+// overlapping, using a shelf algorithm: sorted by height, they are placed left to
+// right in rows as wide as the side of a square having their total area (but at
+// least as wide as the widest one). Returns the position of each rectangle and
+// the size of the sheet.
+func packSprites(sizes []image.Point) ([]image.Point, image.Point) {
+	area, maxWidth := 0, 0
+	order := make([]int, len(sizes))
+	for i, size := range sizes {
+		area += size.X * size.Y
+		if size.X > maxWidth {
+			maxWidth = size.X
+		}
+		order[i] = i
+	}
+	width := int(math.Ceil(math.Sqrt(float64(area))))
+	if width < maxWidth {
+		width = maxWidth
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return sizes[order[i]].Y > sizes[order[j]].Y
+	})
+
+	positions := make([]image.Point, len(sizes))
+	var sheet image.Point
+	x, y, rowHeight := 0, 0, 0
+	for _, i := range order {
+		size := sizes[i]
+		if x+size.X > width {
+			x, y, rowHeight = 0, y+rowHeight, 0
+		}
+		positions[i] = image.Point{x, y}
+		x += size.X
+		if size.Y > rowHeight {
+			rowHeight = size.Y
+		}
+		if x > sheet.X {
+			sheet.X = x
+		}
+		if y+rowHeight > sheet.Y {
+			sheet.Y = y + rowHeight
+		}
+	}
+	return positions, sheet
+}
+
+// loadSprite decodes the image from fileName, makes its background transparent
+// and trims it to its content (see -trim-padding); images which are already
+// transparent are trimmed as they are
+func loadSprite(fileName string, opts *options) (*image.RGBA, error) {
+	data, err := readInput(fileName)
+	if err != nil {
+		return nil, err
+	}
+	imageType := detectImageType(data, fileName, opts.inFormat)
+	imageData, err := decodeImage(data, fileName, opts.inFormat, opts.MaxPixels)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.noAutorotate && (imageType == imagetransparent.ImageTypes.JPEG || imageType == imagetransparent.ImageTypes.TIFF) {
+		imageData = imagetransparent.Orient(imageData, imagetransparent.ExifOrientation(data))
+	}
+	sprite, err := imagetransparent.MakeTransparent(imageData, opts.Options)
+	if errors.Is(err, imagetransparent.ErrNotConverted) {
+		sprite = image.NewRGBA(imageData.Bounds())
+		draw.Draw(sprite, sprite.Bounds(), imageData, imageData.Bounds().Min, draw.Src)
+	} else if err != nil {
+		return nil, fmt.Errorf("error when making '%s' transparent: %w", fileName, err)
+	}
+	return imagetransparent.Trim(sprite, opts.trimPadding), nil
+}
+
+// uniqueFileNames returns fileNames without the repeated ones (also if they
+// are written differently, e.g. a.png and ./a.png), e.g. listed both by a glob
+// and explicitly, keeping the first of each
+func uniqueFileNames(fileNames []string) []string {
+	seen := make(map[string]bool, len(fileNames))
+	var unique []string
+	for _, fileName := range fileNames {
+		if clean := filepath.Clean(fileName); !seen[clean] {
+			seen[clean] = true
+			unique = append(unique, fileName)
+		}
+	}
+	return unique
+}
+
+// makeAtlas makes the background of the images from fileNames transparent,
+// trims them and packs them (see packSprites) into the sprite sheet
+// opts.atlas, saved together with its JSON atlas (see atlasFileName); the
+// repeated file names are packed once
+func makeAtlas(fileNames []string, opts *options) error {
+	if err := checkWritable(filepath.Dir(opts.atlas)); err != nil {
+		return err
+	}
+	fileNames = uniqueFileNames(fileNames)
+	sprites := make([]*image.RGBA, len(fileNames))
+	sizes := make([]image.Point, len(fileNames))
+	for i, fileName := range fileNames {
+		sprite, err := loadSprite(fileName, opts)
+		if err != nil {
+			return err
+		}
+		sprites[i], sizes[i] = sprite, sprite.Bounds().Size()
+	}
+
+	positions, size := packSprites(sizes)
+	sheet := image.NewRGBA(image.Rectangle{Max: size})
+	a := atlas{
+		Image:   filepath.Base(opts.atlas),
+		Width:   size.X,
+		Height:  size.Y,
+		Sprites: make(map[string]atlasSprite, len(sprites)),
+	}
+	for i, sprite := range sprites {
+		r := image.Rectangle{Min: positions[i], Max: positions[i].Add(sizes[i])}
+		draw.Draw(sheet, r, sprite, sprite.Bounds().Min, draw.Src)
+		a.Sprites[fileNames[i]] = atlasSprite{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+	}
+
+	sheetType := imagetransparent.GetImageType(strings.TrimPrefix(filepath.Ext(opts.atlas), "."))
+	err := writeFileAtomically(opts.atlas, func(w io.Writer) error {
+		return imagetransparent.EncodeImageWithOptions(w, sheet, sheetType, opts.encodeOpts)
+	})
+	if err != nil {
+		return err
+	}
+	atlasFile := atlasFileName(opts.atlas)
+	err = writeFileAtomically(atlasFile, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(a)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "packed %d sprites into '%s' (%dx%d), described by '%s'\n", len(sprites), opts.atlas, size.X, size.Y, atlasFile)
+	return nil
+}
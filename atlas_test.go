@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/padurean/make-image-transparent/imagetransparent"
+)
+
+func TestPackSprites(t *testing.T) {
+	sizes := []image.Point{{10, 4}, {3, 8}, {6, 6}, {1, 1}, {10, 2}}
+	positions, sheet := packSprites(sizes)
+
+	area := 0
+	for i, size := range sizes {
+		area += size.X * size.Y
+		r := image.Rectangle{Min: positions[i], Max: positions[i].Add(size)}
+		if !r.In(image.Rectangle{Max: sheet}) {
+			t.Errorf("sprite %d at %v is out of the %v sheet", i, r, sheet)
+		}
+		for j := 0; j < i; j++ {
+			if other := (image.Rectangle{Min: positions[j], Max: positions[j].Add(sizes[j])}); r.Overlaps(other) {
+				t.Errorf("sprite %d at %v overlaps sprite %d at %v", i, r, j, other)
+			}
+		}
+	}
+	if sheet.X < 10 || sheet.X*sheet.Y > 2*area {
+		t.Errorf("sheet = %v, want one at least 10 wide and at most twice the %d sprites area", sheet, area)
+	}
+}
+
+func TestMakeAtlasRepeatedFiles(t *testing.T) {
+	opts := options{
+		Options: imagetransparent.DefaultOptions(),
+		atlas:   filepath.Join(t.TempDir(), "sheet.png"),
+	}
+	// the same file listed twice, e.g. by a glob and explicitly
+	fileNames := []string{"sample--grey-on-white--jpg.jpg", "./sample--grey-on-white--jpg.jpg"}
+	if err := makeAtlas(fileNames, &opts); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(atlasFileName(opts.atlas))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a atlas
+	if err := json.Unmarshal(data, &a); err != nil {
+		t.Fatal(err)
+	}
+	sprite, ok := a.Sprites[fileNames[0]]
+	if len(a.Sprites) != 1 || !ok {
+		t.Fatalf("sprites = %v, want only %s", a.Sprites, fileNames[0])
+	}
+	if a.Width != sprite.Width || a.Height != sprite.Height {
+		t.Errorf("sheet = %dx%d, want the %dx%d of its only sprite", a.Width, a.Height, sprite.Width, sprite.Height)
+	}
+}
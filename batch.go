@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/padurean/make-image-transparent/imagetransparent"
+)
+
+// outputFilePrefix is the prefix of the file names of the converted images;
+// files having it are skipped in batch mode
+const outputFilePrefix = "out__"
+
+// batchFiles returns the image files to process in batch mode if pattern is a
+// directory (all its supported image files, including the ones in its
+// subdirectories if recursive is set) or a glob (all matching files); otherwise
+// it reports that pattern is not a batch
+func batchFiles(pattern string, recursive bool) ([]string, bool, error) {
+	if isURL(pattern) {
+		return nil, false, nil
+	}
+	var candidates []string
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() && recursive {
+		err := filepath.WalkDir(pattern, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				// e.g. .git
+				if path != pattern && strings.HasPrefix(entry.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			candidates = append(candidates, path)
+			return nil
+		})
+		if err != nil {
+			return nil, true, fmt.Errorf("error walking directory '%s': %w", pattern, err)
+		}
+	} else if err == nil && info.IsDir() {
+		entries, err := os.ReadDir(pattern)
+		if err != nil {
+			return nil, true, fmt.Errorf("error reading directory '%s': %w", pattern, err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				candidates = append(candidates, filepath.Join(pattern, entry.Name()))
+			}
+		}
+	} else if strings.ContainsAny(pattern, "*?[") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, true, fmt.Errorf("invalid glob pattern '%s': %w", pattern, err)
+		}
+		candidates = matches
+	} else {
+		return nil, false, nil
+	}
+
+	var files []string
+	for _, file := range candidates {
+		base := filepath.Base(file)
+		if strings.HasPrefix(base, outputFilePrefix) {
+			continue
+		}
+		ext := strings.TrimPrefix(filepath.Ext(base), ".")
+		if ext == "" && sniffFile(file) == imagetransparent.ImageTypes.UNSUPPORTED {
+			continue
+		}
+		if ext != "" && imagetransparent.GetImageType(ext) == imagetransparent.ImageTypes.UNSUPPORTED {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, true, nil
+}
+
+// argsFiles returns the image files of the positional arguments, each of
+// which is processed like in batch mode if it is a directory or a glob, or is
+// an image file otherwise, e.g. the files of a glob expanded by the shell
+func argsFiles(args []string, recursive bool) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		argFiles, isBatch, err := batchFiles(arg, recursive)
+		if err != nil {
+			return nil, err
+		}
+		if !isBatch {
+			argFiles = []string{arg}
+		}
+		files = append(files, argFiles...)
+	}
+	return files, nil
+}
+
+// printFileOutcome prints to stdout whether file was converted, and to which
+// output, or skipped; the failures are reported by the callers
+func printFileOutcome(file string, conv *conversion, err error) {
+	switch {
+	case err == nil && conv.Output != "":
+		fmt.Fprintf(stdout, "%s: converted to '%s'\n", file, conv.Output)
+	case err == nil:
+		fmt.Fprintf(stdout, "%s: converted\n", file)
+	case errors.Is(err, imagetransparent.ErrNotConverted):
+		fmt.Fprintf(stdout, "%s: skipped - %v\n", file, err)
+	}
+}
+
+// parseFileList returns the paths listed in data one per line, e.g. by find;
+// blank lines are skipped
+func parseFileList(data []byte) []string {
+	var files []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		files = append(files, line)
+	}
+	return files
+}
+
+// sniffFile returns the image type of the file detected from its content (see
+// imagetransparent.SniffImageType), for files without an extension
+func sniffFile(fileName string) imagetransparent.ImageType {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return imagetransparent.ImageTypes.UNSUPPORTED
+	}
+	defer f.Close()
+	header := make([]byte, 16)
+	n, _ := io.ReadFull(f, header)
+	return imagetransparent.SniffImageType(header[:n])
+}
+
+// batchSummary counts the outcomes of a batch run
+type batchSummary struct {
+	converted int
+	// skipped counts the files in which no pixel matched the background color,
+	// including the alreadyTransparent ones, which are left untouched
+	skipped            int
+	alreadyTransparent int
+	failed             int
+	// notProcessed is the number of files left when -fail-fast or an interrupt
+	// stopped the run
+	notProcessed int
+	// interrupted reports whether the run was stopped by canceling its context
+	interrupted bool
+}
+
+// processBatch processes files concurrently, using a pool of (at most)
+// opts.Workers workers which share them to process the rows of the images, so
+// at most opts.Workers goroutines do the processing; it reports the failures to stderr and prints a summary to stdout (to
+// stderr with -json, where stdout gets a JSON object per file instead). The
+// failures don't stop the run, unless opts.failFast is set, in which case no
+// more files are started after the first one (the ones in progress are still
+// finished). Likewise, no more files are started once ctx is canceled, e.g. on
+// Ctrl-C (see handleInterrupts). With opts.recursive the counts of each
+// directory are printed too, and with opts.fromList the outcome of each file.
+// The progress, if shown, is the number of files processed so far.
+func processBatch(ctx context.Context, files []string, opts *options) batchSummary {
+	progress := opts.progress
+	fileOpts := *opts
+	fileOpts.progress = nil
+	opts = &fileOpts
+	threads := opts.Workers
+	if threads < 1 {
+		threads = runtime.NumCPU()
+	}
+	workers := threads
+	if workers > len(files) {
+		workers = len(files)
+	}
+	if workers > 0 {
+		opts.Workers = threads / workers
+	}
+
+	type result struct {
+		file string
+		conv *conversion
+		err  error
+	}
+
+	jobs := make(chan string)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				conv, err := processFile(file, opts)
+				results <- result{file, conv, err}
+			}
+		}()
+	}
+	stop := make(chan struct{})
+	go func() {
+		defer close(jobs)
+		for _, file := range files {
+			// checked first, as select picks randomly among the ready cases
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case jobs <- file:
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var summary batchSummary
+	dirSummaries := make(map[string]*batchSummary)
+	done := 0
+	for r := range results {
+		done++
+		if progress != nil {
+			progress.clear()
+		}
+		if opts.json {
+			printJSON(r.conv, r.err)
+		}
+		dirSummary := dirSummaries[filepath.Dir(r.file)]
+		if dirSummary == nil {
+			dirSummary = &batchSummary{}
+			dirSummaries[filepath.Dir(r.file)] = dirSummary
+		}
+		if opts.fromList != "" && !opts.json {
+			printFileOutcome(r.file, r.conv, r.err)
+		}
+		switch {
+		case r.err == nil:
+			summary.converted++
+			dirSummary.converted++
+		case errors.Is(r.err, imagetransparent.ErrNotConverted):
+			summary.skipped++
+			dirSummary.skipped++
+			if errors.Is(r.err, imagetransparent.ErrAlreadyTransparent) {
+				summary.alreadyTransparent++
+				dirSummary.alreadyTransparent++
+			}
+		default:
+			summary.failed++
+			dirSummary.failed++
+			fmt.Fprintf(stderr, "%s: %v\n", r.file, r.err)
+			if opts.failFast && summary.failed == 1 {
+				close(stop)
+			}
+		}
+		if progress != nil && done < len(files) {
+			progress.print(fmt.Sprintf("%d/%d files", done, len(files)))
+		}
+	}
+
+	summary.notProcessed = len(files) - done
+	summary.interrupted = ctx.Err() != nil && summary.notProcessed > 0
+	notProcessed := ""
+	switch {
+	case summary.interrupted:
+		notProcessed = fmt.Sprintf(", %d not processed (interrupted)", summary.notProcessed)
+	case summary.notProcessed > 0:
+		notProcessed = fmt.Sprintf(", %d not processed (-fail-fast)", summary.notProcessed)
+	}
+
+	out := stdout
+	if opts.json {
+		out = stderr
+	}
+	if opts.recursive {
+		dirs := make([]string, 0, len(dirSummaries))
+		for dir := range dirSummaries {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			s := dirSummaries[dir]
+			fmt.Fprintf(out, "%s: %d converted, %d skipped, %d failed\n", dir, s.converted, s.skipped, s.failed)
+		}
+	}
+	if opts.dryRun {
+		fmt.Fprintf(out, "dry run: %d would be converted, %d would be skipped (%d already transparent), %d failed%s\n",
+			summary.converted, summary.skipped, summary.alreadyTransparent, summary.failed, notProcessed)
+	} else {
+		fmt.Fprintf(out, "%d converted, %d skipped (%d already transparent), %d failed%s\n",
+			summary.converted, summary.skipped, summary.alreadyTransparent, summary.failed, notProcessed)
+	}
+	return summary
+}
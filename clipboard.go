@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// runClipboardCommand runs cmd, a command of the platform which puts its
+// standard input on the clipboard, feeding it the PNG image data. Its errors go
+// straight to stderr: the commands which keep running in the background to
+// serve the clipboard (e.g. xclip) would block reading them from a pipe.
+func runClipboardCommand(cmd *exec.Cmd, data []byte) error {
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error when copying the image to the clipboard with %s: %w", filepath.Base(cmd.Path), err)
+	}
+	return nil
+}
+
+// withTempPNG saves the PNG image data to a temporary file and calls f with its
+// path, for the platforms whose clipboard commands can't read the image from
+// their standard input; the file is removed afterwards
+func withTempPNG(data []byte, f func(path string) error) error {
+	file, err := os.CreateTemp("", "make-image-transparent-*.png")
+	if err != nil {
+		return fmt.Errorf("error when creating a temporary file for the clipboard: %w", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error when writing temporary file '%s': %w", file.Name(), err)
+	}
+	return f(file.Name())
+}
+
+// clipboardCommandNotFound returns the error of a missing clipboard command,
+// explaining what has to be installed
+func clipboardCommandNotFound(command, install string) error {
+	return fmt.Errorf("error when copying the image to the clipboard: %s was not found, %s: %w", command, install, exec.ErrNotFound)
+}
+
+// errClipboardUnsupported is returned by copyToClipboard on the platforms
+// without clipboard support
+var errClipboardUnsupported = errors.New("copying images to the clipboard is not supported on this platform (only on macOS, Windows and Linux)")
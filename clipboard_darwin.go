@@ -0,0 +1,17 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// copyToClipboard puts the PNG image data on the clipboard with osascript,
+// which reads it from a temporary file
+func copyToClipboard(data []byte) error {
+	return withTempPNG(data, func(path string) error {
+		script := fmt.Sprintf("set the clipboard to (read (POSIX file %q) as «class PNGf»)", path)
+		return runClipboardCommand(exec.Command("osascript", "-e", script), nil)
+	})
+}
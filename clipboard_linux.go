@@ -0,0 +1,23 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// copyToClipboard puts the PNG image data on the clipboard, with wl-copy on
+// Wayland and xclip on X11
+func copyToClipboard(data []byte) error {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wl-copy"); err != nil {
+			return clipboardCommandNotFound("wl-copy", "install wl-clipboard")
+		}
+		return runClipboardCommand(exec.Command("wl-copy", "--type", "image/png"), data)
+	}
+	if _, err := exec.LookPath("xclip"); err != nil {
+		return clipboardCommandNotFound("xclip", "install xclip")
+	}
+	return runClipboardCommand(exec.Command("xclip", "-selection", "clipboard", "-target", "image/png", "-in"), data)
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !linux && !windows
+
+package main
+
+// copyToClipboard fails with errClipboardUnsupported, as there is no clipboard
+// support for this platform
+func copyToClipboard(data []byte) error {
+	return errClipboardUnsupported
+}
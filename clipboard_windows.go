@@ -0,0 +1,28 @@
+//go:build windows
+
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// clipboardScript is the PowerShell script putting the PNG image of the file
+// {path} on the clipboard, both as PNG, which keeps the transparency, and as a
+// bitmap, for the applications which don't support PNG
+const clipboardScript = `Add-Type -AssemblyName System.Windows.Forms, System.Drawing
+$bytes = [System.IO.File]::ReadAllBytes('{path}')
+$data = New-Object System.Windows.Forms.DataObject
+$data.SetData('PNG', (New-Object System.IO.MemoryStream(, $bytes)))
+$data.SetImage([System.Drawing.Image]::FromStream((New-Object System.IO.MemoryStream(, $bytes))))
+[System.Windows.Forms.Clipboard]::SetDataObject($data, $true)`
+
+// copyToClipboard puts the PNG image data on the clipboard with PowerShell,
+// which reads it from a temporary file
+func copyToClipboard(data []byte) error {
+	return withTempPNG(data, func(path string) error {
+		// single quotes are escaped by doubling them in PowerShell strings
+		script := strings.ReplaceAll(clipboardScript, "{path}", strings.ReplaceAll(path, "'", "''"))
+		return runClipboardCommand(exec.Command("powershell", "-NoProfile", "-NonInteractive", "-STA", "-Command", script), nil)
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// configFileName is the name of the file, in the working directory or in the
+// home directory, holding default values of the flags
+const configFileName = ".make-image-transparent.json"
+
+// findConfigFile returns the path of the config file in the working directory
+// or, if there is none, in the home directory; "" if there is none in either
+func findConfigFile() string {
+	candidates := []string{configFileName}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, configFileName))
+	}
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// flagAliases are the flags which set the same value
+var flagAliases = map[string]string{"o": "output", "output": "o"}
+
+// explicitFlags returns the names of the flags of fs set on the command line,
+// and of their aliases
+func explicitFlags(fs *flag.FlagSet) map[string]bool {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+		if alias, ok := flagAliases[f.Name]; ok {
+			explicit[alias] = true
+		}
+	})
+	return explicit
+}
+
+// loadConfig sets the flags of fs to the values in the config file at path: a
+// JSON object mapping flag names (without the leading dash) to values, which
+// are strings, numbers, booleans or, for repeatable flags, arrays of them, e.g.
+// {"tolerance": 40, "mode": "flood", "bg-color": ["#FFF", "#EEE"]}. It is
+// called after the command line flags are parsed, and the flags set there
+// (or their aliases) are left as they are, so they override the config file.
+// The config values are set like defaults: the flags aren't visited as set by
+// fs.Visit, so they don't conflict with the command line flags (e.g. the mode
+// with -seed-point). Returns the names of the flags it set.
+func loadConfig(fs *flag.FlagSet, path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error when reading config file '%s': %w", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var config map[string]interface{}
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("error when parsing config file '%s': %w", path, err)
+	}
+
+	explicit := explicitFlags(fs)
+	configured := make(map[string]bool)
+	for name, value := range config {
+		if explicit[name] {
+			continue
+		}
+		f := fs.Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown flag %s in config file '%s'", name, path)
+		}
+		configured[name] = true
+		if alias, ok := flagAliases[name]; ok {
+			configured[alias] = true
+		}
+		values := []interface{}{value}
+		if list, ok := value.([]interface{}); ok {
+			values = list
+		}
+		for _, v := range values {
+			var s string
+			switch v := v.(type) {
+			case string:
+				s = v
+			case json.Number:
+				s = v.String()
+			case bool:
+				s = strconv.FormatBool(v)
+			default:
+				return nil, fmt.Errorf("invalid value of %s in config file '%s' - it has to be a string, number or boolean", name, path)
+			}
+			if err := f.Value.Set(s); err != nil {
+				return nil, fmt.Errorf("invalid %s in config file '%s': %w", name, path, err)
+			}
+		}
+	}
+	return configured, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	var tolerance uint8
+	var colors []color.RGBA
+	var mode, output string
+	var trim bool
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(toleranceValue{&tolerance}, "tolerance", "")
+	fs.Var(colorsValue{&colors}, "bg-color", "")
+	fs.StringVar(&mode, "mode", "global", "")
+	fs.BoolVar(&trim, "trim", false, "")
+	fs.StringVar(&output, "o", "", "")
+	fs.StringVar(&output, "output", "", "")
+
+	path := filepath.Join(t.TempDir(), configFileName)
+	config := `{"tolerance": 40, "mode": "flood", "bg-color": ["#FFF", "0,0,0"], "trim": true, "output": "config.png"}`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Parse([]string{"-mode", "global", "-o", "flag.png"}); err != nil {
+		t.Fatal(err)
+	}
+	configured, err := loadConfig(fs, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !configured["tolerance"] || !configured["trim"] || configured["mode"] || configured["o"] {
+		t.Errorf("configured flags = %v, want the config file ones not set on the command line", configured)
+	}
+
+	if tolerance != 40 || !trim || len(colors) != 2 {
+		t.Errorf("tolerance = %d, trim = %v, bg colors = %v, want the config file values", tolerance, trim, colors)
+	}
+	if mode != "global" || output != "flag.png" {
+		t.Errorf("mode = %s, output = %s, want the command line values", mode, output)
+	}
+
+	for _, config := range []string{`{"tolerance": 300}`, `{"unknown": 1}`, `{"tolerance": {}}`, `[]`} {
+		if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.Var(toleranceValue{&tolerance}, "tolerance", "")
+		if _, err := loadConfig(fs, path); err == nil {
+			t.Errorf("invalid config %s was loaded", config)
+		}
+	}
+}
+
+func TestLoadConfigConflictingFlag(t *testing.T) {
+	// the mode of the config file must not be taken for one given on the
+	// command line, which -seed-point conflicts with
+	var mode, seedPoint string
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(&mode, "mode", "flood", "")
+	fs.StringVar(&seedPoint, "seed-point", "", "")
+
+	path := filepath.Join(t.TempDir(), configFileName)
+	if err := os.WriteFile(path, []byte(`{"mode": "global"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Parse([]string{"-seed-point", "1,1"}); err != nil {
+		t.Fatal(err)
+	}
+	configured, err := loadConfig(fs, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode != "global" || !configured["mode"] {
+		t.Errorf("mode = %s, configured = %v, want the config file mode", mode, configured)
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "seed-point" {
+			t.Errorf("flag %s of the config file is visited as given on the command line", f.Name)
+		}
+	})
+}
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/padurean/make-image-transparent/imagetransparent"
+	"golang.org/x/image/tiff"
+)
+
+// toleranceValue is a flag.Value which accepts a color tolerance in the 0-255
+// range or as a percentage of it (e.g. 40%)
+type toleranceValue struct {
+	tolerance *uint8
+}
+
+func (t toleranceValue) String() string {
+	if t.tolerance == nil {
+		return ""
+	}
+	return strconv.Itoa(int(*t.tolerance))
+}
+
+func (t toleranceValue) Set(s string) error {
+	v, err := parseChannelValue(s, "tolerance")
+	if err != nil {
+		return err
+	}
+	*t.tolerance = v
+	return nil
+}
+
+// alphaValue is a flag.Value which accepts an alpha value in the 0-255 range or
+// as a percentage of it (e.g. 25%)
+type alphaValue struct {
+	alpha *uint8
+}
+
+func (a alphaValue) String() string {
+	if a.alpha == nil {
+		return ""
+	}
+	return strconv.Itoa(int(*a.alpha))
+}
+
+func (a alphaValue) Set(s string) error {
+	v, err := parseChannelValue(s, "alpha")
+	if err != nil {
+		return err
+	}
+	*a.alpha = v
+	return nil
+}
+
+// parseChannelValue parses a color channel value (the flag name is used in the
+// errors) given in the 0-255 range or as a percentage of it
+func parseChannelValue(s string, name string) (uint8, error) {
+	if strings.HasSuffix(s, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, fmt.Errorf("%s percentage has to be a number between 0%% and 100%% - got %s", name, s)
+		}
+		return uint8(math.Round(p * 255 / 100)), nil
+	}
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("%s has to be a number between 0 and 255 - got %s", name, s)
+	}
+	return uint8(v), nil
+}
+
+// colorsValue is a repeatable flag.Value which accepts colors in one of the
+// formats supported by imagetransparent.ParseColor
+type colorsValue struct {
+	colors *[]color.RGBA
+}
+
+func (c colorsValue) String() string {
+	if c.colors == nil {
+		return ""
+	}
+	return strings.Join(hexColors(*c.colors), ",")
+}
+
+func (c colorsValue) Set(s string) error {
+	parsed, err := imagetransparent.ParseColor(s)
+	if err != nil {
+		return err
+	}
+	*c.colors = append(*c.colors, parsed)
+	return nil
+}
+
+// colorValue is a flag.Value which accepts a color in one of the formats
+// supported by imagetransparent.ParseColor; the color is nil until set
+type colorValue struct {
+	color **color.RGBA
+}
+
+func (c colorValue) String() string {
+	if c.color == nil || *c.color == nil {
+		return ""
+	}
+	return hexColors([]color.RGBA{**c.color})[0]
+}
+
+func (c colorValue) Set(s string) error {
+	parsed, err := imagetransparent.ParseColor(s)
+	if err != nil {
+		return err
+	}
+	*c.color = &parsed
+	return nil
+}
+
+// modeValue is a flag.Value which accepts one of the imagetransparent.Modes
+type modeValue struct {
+	mode *imagetransparent.Mode
+}
+
+func (m modeValue) String() string {
+	if m.mode == nil {
+		return ""
+	}
+	return string(*m.mode)
+}
+
+func (m modeValue) Set(s string) error {
+	switch imagetransparent.Mode(strings.ToLower(s)) {
+	case imagetransparent.Modes.Global:
+		*m.mode = imagetransparent.Modes.Global
+	case imagetransparent.Modes.Flood:
+		*m.mode = imagetransparent.Modes.Flood
+	default:
+		return fmt.Errorf("mode has to be %s or %s - got %s", imagetransparent.Modes.Global, imagetransparent.Modes.Flood, s)
+	}
+	return nil
+}
+
+// outputMode is the color model the PNG output images are converted to
+type outputMode string
+
+// outputModes of the PNG output images: RGBA8 and RGBA16 have 8 and 16 bits per
+// channel, Paletted has a palette of (up to 256) colors and GrayAlpha gray
+// levels with alpha
+var outputModes = struct {
+	RGBA8     outputMode
+	RGBA16    outputMode
+	Paletted  outputMode
+	GrayAlpha outputMode
+}{
+	RGBA8:     "rgba8",
+	RGBA16:    "rgba16",
+	Paletted:  "paletted",
+	GrayAlpha: "gray+alpha",
+}
+
+// outputModeValue is a flag.Value which accepts one of the outputModes
+type outputModeValue struct {
+	mode *outputMode
+}
+
+func (o outputModeValue) String() string {
+	if o.mode == nil {
+		return ""
+	}
+	return string(*o.mode)
+}
+
+func (o outputModeValue) Set(s string) error {
+	switch mode := outputMode(strings.ToLower(s)); mode {
+	case outputModes.RGBA8, outputModes.RGBA16, outputModes.Paletted, outputModes.GrayAlpha:
+		*o.mode = mode
+	default:
+		return fmt.Errorf("output mode has to be %s, %s, %s or %s - got %s",
+			outputModes.RGBA8, outputModes.RGBA16, outputModes.Paletted, outputModes.GrayAlpha, s)
+	}
+	return nil
+}
+
+// pointValue is a flag.Value which accepts the x,y coordinates of a pixel
+type pointValue struct {
+	point **image.Point
+}
+
+func (p pointValue) String() string {
+	if p.point == nil || *p.point == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d,%d", (*p.point).X, (*p.point).Y)
+}
+
+func (p pointValue) Set(s string) error {
+	invalid := fmt.Errorf("point has to be x,y with x and y 0 or greater (e.g. 10,20) - got %s", s)
+	xs, ys, ok := strings.Cut(s, ",")
+	if !ok {
+		return invalid
+	}
+	x, errX := strconv.Atoi(strings.TrimSpace(xs))
+	y, errY := strconv.Atoi(strings.TrimSpace(ys))
+	if errX != nil || errY != nil || x < 0 || y < 0 {
+		return invalid
+	}
+	*p.point = &image.Point{X: x, Y: y}
+	return nil
+}
+
+// pngCompressionValue is a flag.Value which accepts the name of a PNG
+// compression level
+type pngCompressionValue struct {
+	level *png.CompressionLevel
+}
+
+var pngCompressionLevels = []struct {
+	name  string
+	level png.CompressionLevel
+}{
+	{"default", png.DefaultCompression},
+	{"none", png.NoCompression},
+	{"best-speed", png.BestSpeed},
+	{"best-compression", png.BestCompression},
+}
+
+func (c pngCompressionValue) String() string {
+	if c.level == nil || *c.level == png.DefaultCompression {
+		return ""
+	}
+	for _, l := range pngCompressionLevels {
+		if l.level == *c.level {
+			return l.name
+		}
+	}
+	return ""
+}
+
+func (c pngCompressionValue) Set(s string) error {
+	names := make([]string, len(pngCompressionLevels))
+	for i, l := range pngCompressionLevels {
+		if l.name == strings.ToLower(s) {
+			*c.level = l.level
+			return nil
+		}
+		names[i] = l.name
+	}
+	return fmt.Errorf("compression has to be one of %s - got %s", strings.Join(names, ", "), s)
+}
+
+// tiffCompressionValue is a flag.Value which accepts the name of a TIFF
+// compression type supported for encoding
+type tiffCompressionValue struct {
+	compression *tiff.CompressionType
+}
+
+func (c tiffCompressionValue) String() string {
+	if c.compression != nil && *c.compression == tiff.Deflate {
+		return "deflate"
+	}
+	return "none"
+}
+
+func (c tiffCompressionValue) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "none":
+		*c.compression = tiff.Uncompressed
+	case "deflate":
+		*c.compression = tiff.Deflate
+	case "lzw":
+		return errors.New("LZW compression is not supported for writing TIFF images - use deflate, which is lossless too")
+	default:
+		return fmt.Errorf("TIFF compression has to be none or deflate - got %s", s)
+	}
+	return nil
+}
+
+// gifQuantizerValue is a flag.Value which accepts the name of the quantizer
+// building the palette of GIF images: plan9 (the fixed Plan 9 palette) or
+// median-cut (imagetransparent.MedianCutQuantizer)
+type gifQuantizerValue struct {
+	quantizer *draw.Quantizer
+}
+
+func (q gifQuantizerValue) String() string {
+	if q.quantizer != nil && *q.quantizer != nil {
+		return "median-cut"
+	}
+	return "plan9"
+}
+
+func (q gifQuantizerValue) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "plan9":
+		*q.quantizer = nil
+	case "median-cut":
+		*q.quantizer = imagetransparent.MedianCutQuantizer{}
+	default:
+		return fmt.Errorf("GIF quantizer has to be plan9 or median-cut - got %s", s)
+	}
+	return nil
+}
+
+// backgroundModeValue is a flag.Value which accepts one of the
+// imagetransparent.BackgroundModes
+type backgroundModeValue struct {
+	mode *imagetransparent.BackgroundMode
+}
+
+func (m backgroundModeValue) String() string {
+	if m.mode == nil {
+		return ""
+	}
+	return string(*m.mode)
+}
+
+func (m backgroundModeValue) Set(s string) error {
+	switch imagetransparent.BackgroundMode(strings.ToLower(s)) {
+	case imagetransparent.BackgroundModes.Corners:
+		*m.mode = imagetransparent.BackgroundModes.Corners
+	case imagetransparent.BackgroundModes.Mode:
+		*m.mode = imagetransparent.BackgroundModes.Mode
+	case imagetransparent.BackgroundModes.Gradient:
+		*m.mode = imagetransparent.BackgroundModes.Gradient
+	default:
+		return fmt.Errorf("background mode has to be %s, %s or %s - got %s",
+			imagetransparent.BackgroundModes.Corners, imagetransparent.BackgroundModes.Mode, imagetransparent.BackgroundModes.Gradient, s)
+	}
+	return nil
+}
+
+// flipValue is a flag.Value which accepts one of the imagetransparent.Flips, h
+// or v (or horizontal or vertical)
+type flipValue struct {
+	flip *imagetransparent.Flip
+}
+
+func (f flipValue) String() string {
+	if f.flip == nil {
+		return ""
+	}
+	return string(*f.flip)
+}
+
+func (f flipValue) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "h", "horizontal":
+		*f.flip = imagetransparent.Flips.Horizontal
+	case "v", "vertical":
+		*f.flip = imagetransparent.Flips.Vertical
+	default:
+		return fmt.Errorf("flip has to be h or v - got %s", s)
+	}
+	return nil
+}
+
+// metricValue is a flag.Value which accepts one of the imagetransparent.Metrics
+type metricValue struct {
+	metric *imagetransparent.Metric
+}
+
+func (m metricValue) String() string {
+	if m.metric == nil {
+		return ""
+	}
+	return string(*m.metric)
+}
+
+func (m metricValue) Set(s string) error {
+	switch imagetransparent.Metric(strings.ToLower(s)) {
+	case imagetransparent.Metrics.RGB:
+		*m.metric = imagetransparent.Metrics.RGB
+	case imagetransparent.Metrics.Euclidean:
+		*m.metric = imagetransparent.Metrics.Euclidean
+	case imagetransparent.Metrics.HSV:
+		*m.metric = imagetransparent.Metrics.HSV
+	default:
+		return fmt.Errorf("metric has to be %s, %s or %s - got %s",
+			imagetransparent.Metrics.RGB, imagetransparent.Metrics.Euclidean, imagetransparent.Metrics.HSV, s)
+	}
+	return nil
+}
+
+// chromaKeyValue is a flag.Value which accepts green, blue, a hue in degrees
+// (0-360, e.g. 120 or #120 for green) or a color in one of the formats supported
+// by imagetransparent.ParseColor (e.g. 0,177,64) whose hue is keyed out; the key
+// is nil until set
+type chromaKeyValue struct {
+	key **imagetransparent.ChromaKey
+}
+
+func (c chromaKeyValue) String() string {
+	if c.key == nil || *c.key == nil {
+		return ""
+	}
+	return strconv.FormatFloat((*c.key).Hue, 'g', -1, 64)
+}
+
+func (c chromaKeyValue) Set(s string) error {
+	key := imagetransparent.ChromaKeys.Green
+	switch strings.ToLower(s) {
+	case "green":
+	case "blue":
+		key = imagetransparent.ChromaKeys.Blue
+	default:
+		// e.g. #001140 is a color, not a hue
+		if hue, err := strconv.ParseFloat(strings.TrimPrefix(s, "#"), 64); err == nil && (hue <= 360 || !strings.HasPrefix(s, "#")) {
+			if hue < 0 || hue > 360 {
+				return fmt.Errorf("chroma key hue has to be between 0 and 360 degrees - got %s", s)
+			}
+			key.Hue = hue
+			break
+		}
+		parsed, err := imagetransparent.ParseColor(s)
+		if err != nil {
+			return fmt.Errorf("chroma key has to be green, blue, a hue in degrees or a color - got %s", s)
+		}
+		key.Hue = imagetransparent.Hue(parsed)
+	}
+	*c.key = &key
+	return nil
+}
+
+// icoSizesValue is a flag.Value which accepts comma separated ICO image sizes
+// (1-256 pixels), e.g. 16,32,48
+type icoSizesValue struct {
+	sizes *[]int
+}
+
+func (i icoSizesValue) String() string {
+	if i.sizes == nil {
+		return ""
+	}
+	sizes := make([]string, len(*i.sizes))
+	for j, size := range *i.sizes {
+		sizes[j] = strconv.Itoa(size)
+	}
+	return strings.Join(sizes, ",")
+}
+
+func (i icoSizesValue) Set(s string) error {
+	var sizes []int
+	for _, part := range strings.Split(s, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || size < 1 || size > 256 {
+			return fmt.Errorf("ICO sizes have to be comma separated numbers between 1 and 256 - got %s", s)
+		}
+		sizes = append(sizes, size)
+	}
+	*i.sizes = sizes
+	return nil
+}
+
+// tolerancesValue is a flag.Value which accepts comma separated color
+// tolerances, each in the 0-255 range or as a percentage of it, e.g. 20,40,60
+type tolerancesValue struct {
+	tolerances *[]uint8
+}
+
+func (t tolerancesValue) String() string {
+	if t.tolerances == nil {
+		return ""
+	}
+	tolerances := make([]string, len(*t.tolerances))
+	for i, tolerance := range *t.tolerances {
+		tolerances[i] = strconv.Itoa(int(tolerance))
+	}
+	return strings.Join(tolerances, ",")
+}
+
+func (t tolerancesValue) Set(s string) error {
+	var tolerances []uint8
+	for _, part := range strings.Split(s, ",") {
+		tolerance, err := parseChannelValue(strings.TrimSpace(part), "tolerance")
+		if err != nil {
+			return err
+		}
+		tolerances = append(tolerances, tolerance)
+	}
+	*t.tolerances = tolerances
+	return nil
+}
+
+// scaleSpec is how the -scale flag resizes the images: by factor, if set, or to
+// width and/or height pixels, keeping the aspect ratio (if both are set, the
+// image is fitted within them)
+type scaleSpec struct {
+	factor        float64
+	width, height int
+}
+
+// size returns the size an image of the given size is scaled to
+func (s scaleSpec) size(size image.Point) image.Point {
+	factor := s.factor
+	switch {
+	case s.width > 0 && s.height > 0:
+		factor = math.Min(float64(s.width)/float64(size.X), float64(s.height)/float64(size.Y))
+	case s.width > 0:
+		factor = float64(s.width) / float64(size.X)
+	case s.height > 0:
+		factor = float64(s.height) / float64(size.Y)
+	}
+	scaled := image.Point{int(math.Round(float64(size.X) * factor)), int(math.Round(float64(size.Y) * factor))}
+	if scaled.X < 1 {
+		scaled.X = 1
+	}
+	if scaled.Y < 1 {
+		scaled.Y = 1
+	}
+	return scaled
+}
+
+// scaleValue is a flag.Value which accepts a scale factor (e.g. 0.5) or a size:
+// a width (300x), a height (x200) or both (300x200)
+type scaleValue struct {
+	spec **scaleSpec
+}
+
+func (s scaleValue) String() string {
+	if s.spec == nil || *s.spec == nil {
+		return ""
+	}
+	spec := *s.spec
+	if spec.factor > 0 {
+		return strconv.FormatFloat(spec.factor, 'g', -1, 64)
+	}
+	size := "x"
+	if spec.width > 0 {
+		size = strconv.Itoa(spec.width) + size
+	}
+	if spec.height > 0 {
+		size += strconv.Itoa(spec.height)
+	}
+	return size
+}
+
+func (s scaleValue) Set(v string) error {
+	invalid := fmt.Errorf("scale has to be a factor (e.g. 0.5) or a size: a width (300x), a height (x200) or both (300x200) - got %s", v)
+	var spec scaleSpec
+	width, height, isSize := strings.Cut(strings.ToLower(v), "x")
+	if !isSize {
+		factor, err := strconv.ParseFloat(v, 64)
+		if err != nil || factor <= 0 || math.IsInf(factor, 0) {
+			return invalid
+		}
+		spec.factor = factor
+	} else {
+		if width == "" && height == "" {
+			return invalid
+		}
+		for _, dim := range []struct {
+			s string
+			n *int
+		}{{width, &spec.width}, {height, &spec.height}} {
+			if dim.s == "" {
+				continue
+			}
+			n, err := strconv.Atoi(dim.s)
+			if err != nil || n < 1 {
+				return invalid
+			}
+			*dim.n = n
+		}
+	}
+	*s.spec = &spec
+	return nil
+}
+
+// outputImageTypeValue is a flag.Value which accepts one of the
+// imagetransparent.ImageTypes supporting transparency
+type outputImageTypeValue struct {
+	imageType *imagetransparent.ImageType
+}
+
+func (o outputImageTypeValue) String() string {
+	if o.imageType == nil {
+		return ""
+	}
+	return string(*o.imageType)
+}
+
+func (o outputImageTypeValue) Set(s string) error {
+	switch imageType := imagetransparent.GetImageType(s); imageType {
+	case imagetransparent.ImageTypes.JPEG:
+		return errors.New("jpeg does not support transparency")
+	case imagetransparent.ImageTypes.UNSUPPORTED:
+		return fmt.Errorf("output format %s is not supported", s)
+	case imagetransparent.ImageTypes.AVIF, imagetransparent.ImageTypes.HEIC:
+		return fmt.Errorf("%s images can only be decoded", imageType)
+	default:
+		*o.imageType = imageType
+		return nil
+	}
+}
+
+// inputImageTypeValue is a flag.Value which accepts one of the supported
+// imagetransparent.ImageTypes
+type inputImageTypeValue struct {
+	imageType *imagetransparent.ImageType
+}
+
+func (i inputImageTypeValue) String() string {
+	if i.imageType == nil {
+		return ""
+	}
+	return string(*i.imageType)
+}
+
+func (i inputImageTypeValue) Set(s string) error {
+	imageType := imagetransparent.GetImageType(s)
+	if imageType == imagetransparent.ImageTypes.UNSUPPORTED {
+		return fmt.Errorf("input format %s is not supported", s)
+	}
+	*i.imageType = imageType
+	return nil
+}
+
+// parseArgs parses the flags from args, allowing them to be placed both before
+// and after the positional arguments, and returns the positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
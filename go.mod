@@ -0,0 +1,8 @@
+module github.com/padurean/make-image-transparent
+
+go 1.26.0
+
+require (
+	github.com/chai2010/webp v1.4.0
+	golang.org/x/image v0.46.0
+)
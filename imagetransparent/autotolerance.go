@@ -0,0 +1,80 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// AutoTolerance derives a Tolerance from the pixels on the border of img: it
+// builds the histogram of their distances (the max per channel difference) to
+// the nearest of bgColors and picks the knee point of its cumulative curve, i.e.
+// the distance after which adding tolerance stops capturing many more border
+// pixels. The result is raised, if needed, to cover the spread (mean plus 3
+// standard deviations) of the border pixels up to the knee, which are assumed to
+// be background. Transparent pixels are ignored.
+func AutoTolerance(img image.Image, bgColors []color.RGBA) uint8 {
+	if len(bgColors) == 0 {
+		return 0
+	}
+	bounds := img.Bounds()
+	var hist [256]int
+	n := 0
+	add := func(x, y int) {
+		c := straightColor(img.At(x, y))
+		if c.A == 0 {
+			return
+		}
+		d := uint8(255)
+		for i := range bgColors {
+			bg := &bgColors[i]
+			dc := uint8Diff(c.R, bg.R)
+			if dG := uint8Diff(c.G, bg.G); dG > dc {
+				dc = dG
+			}
+			if dB := uint8Diff(c.B, bg.B); dB > dc {
+				dc = dB
+			}
+			if dc < d {
+				d = dc
+			}
+		}
+		hist[d]++
+		n++
+	}
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		add(x, bounds.Min.Y)
+		if bounds.Dy() > 1 {
+			add(x, bounds.Max.Y-1)
+		}
+	}
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		add(bounds.Min.X, y)
+		if bounds.Dx() > 1 {
+			add(bounds.Max.X-1, y)
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+
+	// the knee is the point of the cumulative curve farthest above the line
+	// joining its ends
+	knee, bestGap, cumulative := 0, math.Inf(-1), 0
+	for d := 0; d < len(hist); d++ {
+		cumulative += hist[d]
+		if gap := float64(cumulative)/float64(n) - float64(d)/255; gap > bestGap {
+			knee, bestGap = d, gap
+		}
+	}
+
+	var count, sum, sumSquares float64
+	for d := 0; d <= knee; d++ {
+		count += float64(hist[d])
+		sum += float64(hist[d] * d)
+		sumSquares += float64(hist[d] * d * d)
+	}
+	mean := sum / count
+	spread := mean + 3*math.Sqrt(math.Max(sumSquares/count-mean*mean, 0))
+	return uint8(math.Min(math.Max(float64(knee), math.Ceil(spread)), 255))
+}
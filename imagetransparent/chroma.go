@@ -0,0 +1,63 @@
+package imagetransparent
+
+import (
+	"image/color"
+	"math"
+)
+
+// ChromaKey removes the pixels by their hue, regardless of their lightness, like
+// the keying of green and blue screens: unlike the distance to a background
+// color, it isn't thrown off by the uneven lighting of the screen
+type ChromaKey struct {
+	// Hue of the screen in degrees (0-360), e.g. 120 for green
+	Hue float64
+	// HueTolerance is the max difference in degrees (0-180) between the hue of a
+	// pixel and Hue for the pixel to be removed
+	HueTolerance float64
+	// MinSaturation (0-255) is the saturation below which pixels are kept,
+	// since the hue of grayish colors (e.g. the highlights and the shadows of
+	// the subject) is meaningless
+	MinSaturation uint8
+}
+
+// ChromaKeys for the usual screens
+var ChromaKeys = struct {
+	Green ChromaKey
+	Blue  ChromaKey
+}{
+	Green: ChromaKey{Hue: 120, HueTolerance: 40, MinSaturation: 80},
+	Blue:  ChromaKey{Hue: 240, HueTolerance: 40, MinSaturation: 80},
+}
+
+// excess returns how far beyond the tolerances of k the color c is, in 0-255
+// units like Options.colorExcess (for the hue, 180 degrees are 255 units); it is
+// 0 or less if c is keyed out
+func (k *ChromaKey) excess(c *color.RGBA) float64 {
+	h, s, _ := rgbToHSV(c)
+	dH := math.Abs(h - k.Hue)
+	if dH > 180 {
+		dH = 360 - dH
+	}
+	return math.Max((dH-k.HueTolerance)*255/180, float64(k.MinSaturation)-s)
+}
+
+// matches reports whether c is keyed out: whether its hue is within
+// k.HueTolerance of k.Hue and it is saturated enough
+func (k *ChromaKey) matches(c *color.RGBA) bool {
+	h, s, _ := rgbToHSV(c)
+	if s < float64(k.MinSaturation) {
+		return false
+	}
+	dH := math.Abs(h - k.Hue)
+	if dH > 180 {
+		dH = 360 - dH
+	}
+	return dH <= k.HueTolerance
+}
+
+// Hue returns the hue of c in degrees (0-360), e.g. to key out the color of a
+// screen sampled from an image
+func Hue(c color.RGBA) float64 {
+	h, _, _ := rgbToHSV(&c)
+	return h
+}
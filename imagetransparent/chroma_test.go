@@ -0,0 +1,31 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestChromaKey(t *testing.T) {
+	// a green screen lit unevenly, from dark to light green
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	img.SetRGBA(0, 0, color.RGBA{R: 10, G: 90, B: 20, A: 255})
+	img.SetRGBA(1, 0, color.RGBA{R: 120, G: 250, B: 130, A: 255})
+	img.SetRGBA(2, 0, color.RGBA{R: 200, G: 210, B: 200, A: 255}) // grayish
+	img.SetRGBA(3, 0, color.RGBA{R: 200, G: 40, B: 30, A: 255})
+
+	opts := DefaultOptions()
+	opts.ChromaKey = &ChromaKeys.Green
+	result, changed, err := MakeTransparentCount(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 2 {
+		t.Errorf("changed = %d, want 2", changed)
+	}
+	for x, wantA := range []uint8{0, 0, 255, 255} {
+		if a := result.RGBAAt(x, 0).A; a != wantA {
+			t.Errorf("alpha at %d = %d, want %d", x, a, wantA)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/draw"
+)
+
+// ConvertCMYK returns an RGBA copy of img if it is a CMYK image (e.g. a JPEG
+// from a print workflow), so that its colors are sampled and compared as RGB
+// ones; other images are returned as is
+func ConvertCMYK(img image.Image) image.Image {
+	cmyk, ok := img.(*image.CMYK)
+	if !ok {
+		return img
+	}
+	imageRGBA := image.NewRGBA(cmyk.Bounds())
+	draw.Draw(imageRGBA, imageRGBA.Bounds(), cmyk, cmyk.Bounds().Min, draw.Src)
+	return imageRGBA
+}
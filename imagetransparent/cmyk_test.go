@@ -0,0 +1,51 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestConvertCMYK(t *testing.T) {
+	// white background with a cyan square
+	img := image.NewCMYK(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if x >= 2 && x < 6 && y >= 2 && y < 6 {
+				img.SetCMYK(x, y, color.CMYK{C: 255})
+			} else {
+				img.SetCMYK(x, y, color.CMYK{})
+			}
+		}
+	}
+
+	converted, ok := ConvertCMYK(img).(*image.RGBA)
+	if !ok {
+		t.Fatalf("converted image is a %T, want *image.RGBA", ConvertCMYK(img))
+	}
+	if !converted.Opaque() {
+		t.Error("converted image is not opaque")
+	}
+	bg, ambiguous := DetectBackgroundColor(converted, DefaultOptions())
+	if want := (color.RGBA{R: 255, G: 255, B: 255, A: 255}); ambiguous || bg != want {
+		t.Errorf("background = %v (ambiguous %v), want %v", bg, ambiguous, want)
+	}
+
+	opts := DefaultOptions()
+	opts.BackgroundColors = []color.RGBA{bg}
+	result, changed, err := MakeTransparentCount(converted, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 64-16 {
+		t.Errorf("changed %d pixels, want %d", changed, 64-16)
+	}
+	if c := result.RGBAAt(3, 3); c != (color.RGBA{G: 255, B: 255, A: 255}) {
+		t.Errorf("foreground = %v, want cyan", c)
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	if ConvertCMYK(rgba) != image.Image(rgba) {
+		t.Error("RGBA image was converted")
+	}
+}
@@ -0,0 +1,238 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/jpeg"
+	"image/png"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/chai2010/webp"
+	"golang.org/x/image/bmp"
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// EncodeOptions configure how the images are encoded; the zero value uses the
+// default settings of each format
+type EncodeOptions struct {
+	// PNGCompression is the compression level of PNG images
+	PNGCompression png.CompressionLevel
+	// JPEGQuality is the quality (1-100) of JPEG images; 0 means
+	// jpeg.DefaultQuality
+	JPEGQuality int
+	// TIFFCompression is the compression of TIFF images; only Uncompressed (the
+	// default) and the lossless Deflate are supported for encoding
+	TIFFCompression tiff.CompressionType
+	// ICOSizes are the sizes (1-256 pixels) of the square images of ICO files,
+	// e.g. 16, 32 and 48 for favicons; if there are none, an ICO file has a
+	// single image of the size of the encoded one (see EncodeICO)
+	ICOSizes []int
+	// WebPLossless encodes WebP images losslessly; by default they are lossy,
+	// which is smaller for photos but blurs the colors along sharp edges, e.g.
+	// of logos, into the transparent pixels
+	WebPLossless bool
+	// GIFNumColors is the maximum number of colors (1-256) of GIF images,
+	// including the transparent one; 0 means 256
+	GIFNumColors int
+	// GIFQuantizer builds the palette of GIF images, e.g. MedianCutQuantizer;
+	// if nil, the first colors of palette.Plan9 are used, like gif.Encode does
+	GIFQuantizer draw.Quantizer
+	// GIFDrawer draws the images to their GIF palette; if nil,
+	// draw.FloydSteinberg dithers them, draw.Src doesn't
+	GIFDrawer draw.Drawer
+	// Metadata is written to PNG images as text chunks (see ReadMetadata);
+	// the other formats don't keep it
+	Metadata Metadata
+}
+
+// IsEncodable reports whether images can be encoded in the format of the given
+// imageType; AVIF and HEIC images can only be decoded
+func IsEncodable(imageType ImageType) bool {
+	switch imageType {
+	case ImageTypes.AVIF, ImageTypes.HEIC, ImageTypes.UNSUPPORTED:
+		return false
+	default:
+		return true
+	}
+}
+
+// EncodeImage writes img to w in the format of the given imageType, using the
+// default EncodeOptions
+func EncodeImage(w io.Writer, img image.Image, imageType ImageType) error {
+	return EncodeImageWithOptions(w, img, imageType, EncodeOptions{})
+}
+
+// EncodeImageWithOptions writes img to w in the format of the given imageType,
+// configured by opts
+func EncodeImageWithOptions(w io.Writer, img image.Image, imageType ImageType, opts EncodeOptions) error {
+	switch imageType {
+	case ImageTypes.JPEG:
+		var jpegOpts *jpeg.Options
+		if opts.JPEGQuality > 0 {
+			jpegOpts = &jpeg.Options{Quality: opts.JPEGQuality}
+		}
+		return jpeg.Encode(w, img, jpegOpts)
+	case ImageTypes.PNG:
+		encoder := png.Encoder{CompressionLevel: opts.PNGCompression}
+		if opts.Metadata.IsEmpty() {
+			return encoder.Encode(w, img)
+		}
+		var buff bytes.Buffer
+		if err := encoder.Encode(&buff, img); err != nil {
+			return err
+		}
+		data, err := addPNGMetadata(buff.Bytes(), opts.Metadata)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case ImageTypes.BMP:
+		return bmp.Encode(w, img)
+	case ImageTypes.TIFF:
+		return tiff.Encode(w, img, &tiff.Options{Compression: opts.TIFFCompression})
+	case ImageTypes.GIF:
+		return encodeGIF(w, img, opts)
+	case ImageTypes.WEBP:
+		if opts.WebPLossless {
+			return webp.Encode(w, img, &webp.Options{Lossless: true})
+		}
+		return webp.Encode(w, img, nil)
+	case ImageTypes.ICO:
+		return EncodeICO(w, img, opts.ICOSizes)
+	default:
+		return fmt.Errorf("image type %s is not supported", imageType)
+	}
+}
+
+// EncodeImageToBase64 encodes img in the format of the given imageType and
+// returns it as a base64 data URI
+func EncodeImageToBase64(img image.Image, imageType ImageType) (string, error) {
+	return EncodeImageToBase64WithOptions(img, imageType, EncodeOptions{})
+}
+
+// EncodeImageToBase64WithOptions is like EncodeImageToBase64, but the image is
+// encoded as configured by opts
+func EncodeImageToBase64WithOptions(img image.Image, imageType ImageType, opts EncodeOptions) (string, error) {
+	var buff bytes.Buffer
+	if err := EncodeImageWithOptions(&buff, img, imageType, opts); err != nil {
+		return "", fmt.Errorf("error when encoding image to base64: %w", err)
+	}
+
+	return DataURI(buff.Bytes(), imageType), nil
+}
+
+// DataURI returns the base64 data URI of the given encoded image data, e.g. to
+// embed it in HTML or CSS
+func DataURI(data []byte, imageType ImageType) string {
+	mediaType := "image/" + string(imageType)
+	if imageType == ImageTypes.ICO {
+		mediaType = "image/x-icon"
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// ParseDataURI parses a data URI - data:[<media type>][;base64],<data> -
+// returning its media type, lowercased and without parameters (text/plain if
+// there is none), and its decoded data. The "data:" prefix, the media type and
+// the base64 marker are case insensitive, and the whitespace (e.g. line breaks)
+// in the base64 data is ignored; data which isn't base64 is percent-decoded.
+func ParseDataURI(uri []byte) (string, []byte, error) {
+	uri = bytes.TrimSpace(uri)
+	if len(uri) < 5 || !strings.EqualFold(string(uri[:5]), "data:") {
+		return "", nil, errors.New("data URI has to start with data:")
+	}
+	comma := bytes.IndexByte(uri, ',')
+	if comma < 0 {
+		return "", nil, errors.New("data URI has no comma before its data")
+	}
+	header, payload := string(uri[5:comma]), uri[comma+1:]
+
+	isBase64 := false
+	if i := strings.LastIndex(header, ";"); i >= 0 && strings.EqualFold(strings.TrimSpace(header[i+1:]), "base64") {
+		isBase64, header = true, header[:i]
+	}
+	mediaType := "text/plain"
+	if strings.TrimSpace(header) != "" {
+		parsed, _, err := mime.ParseMediaType(header)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid data URI media type %s: %w", header, err)
+		}
+		mediaType = parsed
+	}
+
+	if !isBase64 {
+		data, err := url.PathUnescape(string(payload))
+		if err != nil {
+			return "", nil, fmt.Errorf("error when decoding data URI: %w", err)
+		}
+		return mediaType, []byte(data), nil
+	}
+	data, err := decodeBase64(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("error when decoding from base64: %w", err)
+	}
+	return mediaType, data, nil
+}
+
+// decodeBase64 decodes the base64 src (padded or not), ignoring whitespace,
+// into a new buffer
+func decodeBase64(src []byte) ([]byte, error) {
+	src = bytes.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, src)
+	encoding := base64.StdEncoding
+	if len(src)%4 != 0 {
+		encoding = base64.RawStdEncoding
+		src = bytes.TrimRight(src, "=")
+	}
+	decoded := make([]byte, encoding.DecodedLen(len(src)))
+	n, err := encoding.Decode(decoded, src)
+	if err != nil {
+		return nil, err
+	}
+	return decoded[:n], nil
+}
+
+// DecodeImageFromBase64 decodes the image (in any of the supported formats, see
+// DecodeImage) from a base64 data URI (see ParseDataURI), from base64 data
+// without the data URI prefix or, if data isn't base64, from data itself. The
+// format is detected from the content, so a media type not matching it (e.g.
+// image/jpg for a PNG) doesn't matter, but it has to be an image one.
+func DecodeImageFromBase64(data []byte) (image.Image, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) >= 5 && strings.EqualFold(string(trimmed[:5]), "data:") {
+		mediaType, decoded, err := ParseDataURI(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(mediaType, "image/") {
+			return nil, fmt.Errorf("data URI media type %s is not an image one", mediaType)
+		}
+		data = decoded
+	} else if decoded, err := decodeBase64(trimmed); err == nil {
+		data = decoded
+	}
+
+	imageData, err := DecodeImage(data, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error when decoding image data from base64: %w", err)
+	}
+	return imageData, nil
+}
@@ -0,0 +1,112 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestBase64RoundTrip(t *testing.T) {
+	// noise doesn't compress, so the encoded image is large
+	src := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	rnd := rand.New(rand.NewSource(1))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			src.SetRGBA(x, y, color.RGBA{R: uint8(rnd.Intn(256)), G: uint8(rnd.Intn(256)), B: uint8(rnd.Intn(256)), A: 255})
+		}
+	}
+
+	encoded, err := EncodeImageToBase64(src, ImageTypes.PNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(encoded)
+	decoded, err := DecodeImageFromBase64(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != encoded {
+		t.Error("the base64 input was overwritten")
+	}
+
+	if decoded.Bounds() != src.Bounds() {
+		t.Fatalf("bounds = %v, want %v", decoded.Bounds(), src.Bounds())
+	}
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			if got, want := color.RGBAModel.Convert(decoded.At(x, y)), src.At(x, y); got != want {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkBase64RoundTrip(b *testing.B) {
+	img := newTestImage(1024)
+	for i := 0; i < b.N; i++ {
+		encoded, err := EncodeImageToBase64(img, ImageTypes.PNG)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := DecodeImageFromBase64([]byte(encoded)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeImageFromBase64(t *testing.T) {
+	var buff bytes.Buffer
+	if err := png.Encode(&buff, newTestImage(4)); err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(buff.Bytes())
+	wrapped := encoded[:20] + "\r\n" + encoded[20:]
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"data URI", "data:image/png;base64," + encoded, false},
+		{"jpg media type", "data:image/jpg;base64," + encoded, false},
+		{"uppercase", "DATA:IMAGE/PNG;BASE64," + encoded, false},
+		{"parameters", "data:image/png;charset=utf-8;base64," + encoded, false},
+		{"whitespace", "  data:image/png;base64," + wrapped + "\n", false},
+		{"raw base64", encoded, false},
+		{"unpadded raw base64", strings.TrimRight(encoded, "="), false},
+		{"raw image", buff.String(), false},
+		{"not an image media type", "data:text/plain;base64," + encoded, true},
+		{"no comma", "data:image/png;base64", true},
+		{"invalid base64", "data:image/png;base64,!!!!", true},
+	}
+	for _, tt := range tests {
+		img, err := DecodeImageFromBase64([]byte(tt.data))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: DecodeImageFromBase64 error = nil, want one", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: DecodeImageFromBase64 error: %v", tt.name, err)
+		} else if img.Bounds() != image.Rect(0, 0, 4, 4) {
+			t.Errorf("%s: bounds = %v, want 4x4", tt.name, img.Bounds())
+		}
+	}
+}
+
+func TestParseDataURI(t *testing.T) {
+	mediaType, data, err := ParseDataURI([]byte("data:,A%20brief%20note"))
+	if err != nil || mediaType != "text/plain" || string(data) != "A brief note" {
+		t.Errorf("ParseDataURI = %q, %q, %v, want text/plain, \"A brief note\"", mediaType, data, err)
+	}
+	mediaType, data, err = ParseDataURI([]byte("Data:Image/GIF;Base64,R0lG"))
+	if err != nil || mediaType != "image/gif" || string(data) != "GIF" {
+		t.Errorf("ParseDataURI = %q, %q, %v, want image/gif, \"GIF\"", mediaType, data, err)
+	}
+}
@@ -0,0 +1,368 @@
+package imagetransparent
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Metric ...
+type Metric string
+
+// Metrics used for comparing colors: RGB compares each of the red, green and
+// blue channels against Options.Tolerance (or Options.ChannelTolerances, and
+// Options.UniformTolerance),
+// Euclidean compares the distance between the colors in the RGB space against
+// Options.Tolerance, while HSV compares hue, saturation and value against
+// Options.HueTolerance, Options.SaturationTolerance and Options.ValueTolerance
+var Metrics = struct {
+	RGB       Metric
+	Euclidean Metric
+	HSV       Metric
+}{
+	RGB:       "rgb",
+	Euclidean: "euclidean",
+	HSV:       "hsv",
+}
+
+func uint8Diff(a uint8, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// rgbToHSV returns the hue (0-360 degrees), saturation and value (0-255) of c
+func rgbToHSV(c *color.RGBA) (float64, float64, float64) {
+	r, g, b := float64(c.R), float64(c.G), float64(c.B)
+	maxC := math.Max(r, math.Max(g, b))
+	minC := math.Min(r, math.Min(g, b))
+	delta := maxC - minC
+	if maxC == 0 {
+		return 0, 0, 0
+	}
+	s := delta / maxC * 255
+
+	var h float64
+	switch {
+	case delta == 0:
+		h = 0
+	case maxC == r:
+		h = 60 * math.Mod((g-b)/delta, 6)
+	case maxC == g:
+		h = 60 * ((b-r)/delta + 2)
+	default:
+		h = 60 * ((r-g)/delta + 4)
+	}
+	if h < 0 {
+		h += 360
+	}
+	return h, s, maxC
+}
+
+// sameColorHSV compares a and b in the HSV color space; the hue is ignored if
+// either color is so unsaturated (grayish) that its hue is meaningless
+func (opts *Options) sameColorHSV(a *color.RGBA, b *color.RGBA) bool {
+	hA, sA, vA := rgbToHSV(a)
+	hB, sB, vB := rgbToHSV(b)
+	saturationTolerance := float64(opts.SaturationTolerance)
+	if math.Abs(sA-sB) > saturationTolerance || math.Abs(vA-vB) > float64(opts.ValueTolerance) {
+		return false
+	}
+	if sA <= saturationTolerance || sB <= saturationTolerance {
+		return true
+	}
+	dH := math.Abs(hA - hB)
+	if dH > 180 {
+		dH = 360 - dH
+	}
+	return dH <= opts.HueTolerance
+}
+
+// sameColorEuclidean compares the squared Euclidean distance between a and b in
+// the RGB space with the squared Options.Tolerance, so that a color differing a
+// bit in all the channels is farther than one differing as much in only one
+func (opts *Options) sameColorEuclidean(a *color.RGBA, b *color.RGBA) bool {
+	dR := int(a.R) - int(b.R)
+	dG := int(a.G) - int(b.G)
+	dB := int(a.B) - int(b.B)
+	t := int(opts.Tolerance)
+	return dR*dR+dG*dG+dB*dB <= t*t
+}
+
+// sameColor reports whether a and b have the same color, within the
+// tolerances of the Metric of opts. The pixels of grayscale images, whose
+// channels all differ by the same amount from a gray background, are compared
+// by their gray level instead, against Tolerance, unless the metric is HSV: the
+// RGB metric would always use UniformTolerance for them and the Euclidean one
+// would be stricter by a factor of sqrt(3) than for the gray level. With
+// Options.Matcher, only it decides.
+func (opts *Options) sameColor(a *color.RGBA, b *color.RGBA) bool {
+	if opts.Matcher != nil {
+		return opts.Matcher(*a, *b)
+	}
+	if opts.Exact {
+		return a.R == b.R && a.G == b.G && a.B == b.B
+	}
+	if opts.Linear && opts.Metric != Metrics.HSV {
+		la, lb := linear(a), linear(b)
+		a, b = &la, &lb
+	}
+	if opts.gray && opts.Metric != Metrics.HSV {
+		return grayDiff(a, b) <= opts.Tolerance
+	}
+	switch opts.Metric {
+	case Metrics.HSV:
+		return opts.sameColorHSV(a, b)
+	case Metrics.Euclidean:
+		return opts.sameColorEuclidean(a, b)
+	}
+
+	aa := *a
+	bb := *b
+	dR := uint8Diff(aa.R, bb.R)
+	dG := uint8Diff(aa.G, bb.G)
+	dB := uint8Diff(aa.B, bb.B)
+
+	t := opts.rgbTolerances(dR == dG && dG == dB)
+	return dR <= t[0] && dG <= t[1] && dB <= t[2]
+}
+
+// linearLevels maps the sRGB encoded channel levels to the levels of linear
+// light, in the same 0-255 range
+var linearLevels = func() [256]uint8 {
+	var levels [256]uint8
+	for i := range levels {
+		v := float64(i) / 255
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		levels[i] = uint8(math.Round(v * 255))
+	}
+	return levels
+}()
+
+// linear returns c with its channels converted to linear light (see
+// Options.Linear)
+func linear(c *color.RGBA) color.RGBA {
+	return color.RGBA{R: linearLevels[c.R], G: linearLevels[c.G], B: linearLevels[c.B], A: c.A}
+}
+
+// grayDiff returns the difference between the gray levels of a and b: the
+// largest difference of their channels, which are all the same for grays
+func grayDiff(a *color.RGBA, b *color.RGBA) uint8 {
+	d := uint8Diff(a.R, b.R)
+	if dG := uint8Diff(a.G, b.G); dG > d {
+		d = dG
+	}
+	if dB := uint8Diff(a.B, b.B); dB > d {
+		d = dB
+	}
+	return d
+}
+
+// rgbTolerances returns the red, green and blue tolerances of the RGB metric
+// for a color whose channels differ by the same amount from the compared one if
+// uniform is set (Options.UniformTolerance, unless Options.NoUniformTolerance
+// is set), otherwise Options.ChannelTolerances or Options.Tolerance
+func (opts *Options) rgbTolerances(uniform bool) [3]uint8 {
+	switch {
+	case uniform && !opts.NoUniformTolerance:
+		return [3]uint8{opts.UniformTolerance, opts.UniformTolerance, opts.UniformTolerance}
+	case opts.ChannelTolerances != nil:
+		return *opts.ChannelTolerances
+	}
+	return [3]uint8{opts.Tolerance, opts.Tolerance, opts.Tolerance}
+}
+
+// colorExcess returns how far beyond the tolerance of the metric of opts a is
+// from b, in 0-255 channel units (for the hue, 180 degrees are 255 units); it is
+// 0 or less if they have the same color (see sameColor). With Options.Matcher
+// there is no distance, so it is either 0 or infinite.
+func (opts *Options) colorExcess(a *color.RGBA, b *color.RGBA) float64 {
+	if opts.Matcher != nil {
+		if opts.Matcher(*a, *b) {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	if opts.Linear && !opts.Exact && opts.Metric != Metrics.HSV {
+		la, lb := linear(a), linear(b)
+		a, b = &la, &lb
+	}
+	dR := float64(uint8Diff(a.R, b.R))
+	dG := float64(uint8Diff(a.G, b.G))
+	dB := float64(uint8Diff(a.B, b.B))
+	switch {
+	case opts.Exact:
+		return math.Max(dR, math.Max(dG, dB))
+	case opts.gray && opts.Metric != Metrics.HSV:
+		return float64(grayDiff(a, b)) - float64(opts.Tolerance)
+	case opts.Metric == Metrics.HSV:
+		hA, sA, vA := rgbToHSV(a)
+		hB, sB, vB := rgbToHSV(b)
+		saturationTolerance := float64(opts.SaturationTolerance)
+		excess := math.Max(math.Abs(sA-sB)-saturationTolerance, math.Abs(vA-vB)-float64(opts.ValueTolerance))
+		if sA > saturationTolerance && sB > saturationTolerance {
+			dH := math.Abs(hA - hB)
+			if dH > 180 {
+				dH = 360 - dH
+			}
+			excess = math.Max(excess, (dH-opts.HueTolerance)*255/180)
+		}
+		return excess
+	case opts.Metric == Metrics.Euclidean:
+		return math.Sqrt(dR*dR+dG*dG+dB*dB) - float64(opts.Tolerance)
+	default:
+		t := opts.rgbTolerances(dR == dG && dG == dB)
+		return math.Max(dR-float64(t[0]), math.Max(dG-float64(t[1]), dB-float64(t[2])))
+	}
+}
+
+// matchesAny reports whether c has the same color as any of colors
+func (opts *Options) matchesAny(c *color.RGBA, colors []color.RGBA) bool {
+	for i := range colors {
+		if opts.sameColor(c, &colors[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isProtected reports whether c is within opts.ProtectTolerance of any of
+// opts.ProtectColors
+func (opts *Options) isProtected(c *color.RGBA) bool {
+	t := opts.ProtectTolerance
+	for _, p := range opts.ProtectColors {
+		if uint8Diff(c.R, p.R) <= t && uint8Diff(c.G, p.G) <= t && uint8Diff(c.B, p.B) <= t {
+			return true
+		}
+	}
+	return false
+}
+
+// isBackground reports whether the pixel color c has to be removed: whether it
+// matches any of colors (or is keyed out by opts.ChromaKey, if set) or, if
+// opts.Invert is set, whether it doesn't; protected colors (see
+// Options.ProtectColors) are never removed
+func (opts *Options) isBackground(c *color.RGBA, colors []color.RGBA) bool {
+	if opts.ChromaKey != nil {
+		return opts.ChromaKey.matches(c) != opts.Invert && !opts.isProtected(c)
+	}
+	return opts.matchesAny(c, colors) != opts.Invert && !opts.isProtected(c)
+}
+
+// backgroundMatcher returns a function reporting whether the pixel at (x, y) of
+// img, having the straight color c, has to be removed (see isBackground): the
+// background colors are bgColors or, if there are none, the ones of the
+// gradient between the corners of img (see BackgroundModes.Gradient); they are
+// ignored if opts.ChromaKey is set. The colors are compared with
+// opts.MatcherAt, if set.
+func (opts *Options) backgroundMatcher(img image.Image, bgColors []color.RGBA) func(x, y int, c *color.RGBA) bool {
+	if opts.MatcherAt != nil && opts.ChromaKey == nil {
+		var corners [4]color.RGBA
+		if len(bgColors) == 0 {
+			corners = DetectGradientCorners(img)
+		}
+		bounds := img.Bounds()
+		return func(x, y int, c *color.RGBA) bool {
+			matched := false
+			if len(bgColors) == 0 {
+				matched = opts.MatcherAt(x, y, *c, gradientColor(&corners, bounds, x, y))
+			}
+			for i := 0; i < len(bgColors) && !matched; i++ {
+				matched = opts.MatcherAt(x, y, *c, bgColors[i])
+			}
+			return matched != opts.Invert && !opts.isProtected(c)
+		}
+	}
+	if len(bgColors) > 0 || opts.ChromaKey != nil {
+		return func(_, _ int, c *color.RGBA) bool {
+			return opts.isBackground(c, bgColors)
+		}
+	}
+	corners := DetectGradientCorners(img)
+	bounds := img.Bounds()
+	return func(x, y int, c *color.RGBA) bool {
+		bg := gradientColor(&corners, bounds, x, y)
+		return opts.sameColor(c, &bg) != opts.Invert && !opts.isProtected(c)
+	}
+}
+
+// ParseColor parses a color given either as a hex string (e.g. #FFFFFF or FFF)
+// or as comma separated decimal channel values (e.g. 255,255,255)
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, ",") {
+		parts := strings.Split(s, ",")
+		if len(parts) != 3 {
+			return color.RGBA{}, fmt.Errorf("color has to have 3 comma separated channel values - got %s", s)
+		}
+		var channels [3]uint8
+		for i, part := range parts {
+			v, err := strconv.ParseUint(strings.TrimSpace(part), 10, 8)
+			if err != nil {
+				return color.RGBA{}, fmt.Errorf("color channel values have to be numbers between 0 and 255 - got %s", s)
+			}
+			channels[i] = uint8(v)
+		}
+		return color.RGBA{R: channels[0], G: channels[1], B: channels[2], A: 255}, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("hex color has to be in #RRGGBB or #RGB format - got %s", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("hex color has to be in #RRGGBB or #RGB format - got %s", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// backgroundExcess returns a function returning how far beyond the tolerance
+// the pixel at (x, y) of img, having the straight color c, is from the closest
+// background color (see colorExcess and backgroundMatcher); protected colors
+// (see Options.ProtectColors) are infinitely far, as are all the colors which
+// don't match with opts.MatcherAt, if set
+func (opts *Options) backgroundExcess(img image.Image, bgColors []color.RGBA) func(x, y int, c *color.RGBA) float64 {
+	if opts.MatcherAt != nil && opts.ChromaKey == nil {
+		isBackground := opts.backgroundMatcher(img, bgColors)
+		return func(x, y int, c *color.RGBA) float64 {
+			if isBackground(x, y, c) {
+				return 0
+			}
+			return math.Inf(1)
+		}
+	}
+	var corners [4]color.RGBA
+	if len(bgColors) == 0 && opts.ChromaKey == nil {
+		corners = DetectGradientCorners(img)
+	}
+	bounds := img.Bounds()
+	return func(x, y int, c *color.RGBA) float64 {
+		if opts.isProtected(c) {
+			return math.Inf(1)
+		}
+		if opts.ChromaKey != nil {
+			return opts.ChromaKey.excess(c)
+		}
+		if len(bgColors) == 0 {
+			bg := gradientColor(&corners, bounds, x, y)
+			return opts.colorExcess(c, &bg)
+		}
+		excess := math.Inf(1)
+		for i := range bgColors {
+			excess = math.Min(excess, opts.colorExcess(c, &bgColors[i]))
+		}
+		return excess
+	}
+}
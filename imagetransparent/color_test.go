@@ -0,0 +1,241 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestUint8Diff(t *testing.T) {
+	tests := []struct {
+		a, b, want uint8
+	}{
+		{0, 0, 0},
+		{10, 3, 7},
+		{3, 10, 7},
+		{0, 255, 255},
+		{255, 0, 255},
+	}
+	for _, tt := range tests {
+		if got := uint8Diff(tt.a, tt.b); got != tt.want {
+			t.Errorf("uint8Diff(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSameColorTolerance(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	tests := []struct {
+		name             string
+		tolerance        uint8
+		uniformTolerance uint8
+		noUniform        bool
+		c                color.RGBA
+		want             bool
+	}{
+		{"identical", 0, 0, false, white, true},
+		{"zero tolerance", 0, 0, false, color.RGBA{R: 254, G: 255, B: 255, A: 255}, false},
+		{"at tolerance", 10, 0, false, color.RGBA{R: 245, G: 250, B: 255, A: 255}, true},
+		{"above tolerance", 10, 0, false, color.RGBA{R: 244, G: 250, B: 255, A: 255}, false},
+		{"uniform at uniform tolerance", 0, 20, false, color.RGBA{R: 235, G: 235, B: 235, A: 255}, true},
+		{"uniform above uniform tolerance", 100, 20, false, color.RGBA{R: 234, G: 234, B: 234, A: 255}, false},
+		{"uniform at tolerance without uniform tolerance", 100, 20, true, color.RGBA{R: 155, G: 155, B: 155, A: 255}, true},
+		{"uniform above tolerance without uniform tolerance", 10, 100, true, color.RGBA{R: 244, G: 244, B: 244, A: 255}, false},
+		{"not uniform without uniform tolerance", 10, 100, true, color.RGBA{R: 245, G: 250, B: 255, A: 255}, true},
+		{"max tolerance", 255, 255, false, color.RGBA{A: 255}, true},
+		{"alpha is ignored", 0, 0, false, color.RGBA{R: 255, G: 255, B: 255, A: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Tolerance, opts.UniformTolerance = tt.tolerance, tt.uniformTolerance
+			opts.NoUniformTolerance = tt.noUniform
+			c := tt.c
+			if got := opts.sameColor(&c, &white); got != tt.want {
+				t.Errorf("sameColor(%v, %v) = %v, want %v", tt.c, white, got, tt.want)
+			}
+			// colorExcess agrees with sameColor
+			if excess := opts.colorExcess(&c, &white); (excess <= 0) != tt.want {
+				t.Errorf("colorExcess(%v, %v) = %v, disagreeing with sameColor", tt.c, white, excess)
+			}
+		})
+	}
+}
+
+func TestSameColorChannelTolerances(t *testing.T) {
+	// a light blue sky, varying mostly in the blue channel
+	sky := color.RGBA{R: 120, G: 170, B: 230, A: 255}
+	tests := []struct {
+		name string
+		c    color.RGBA
+		want bool
+	}{
+		{"at all the tolerances", color.RGBA{R: 110, G: 160, B: 170, A: 255}, true},
+		{"above the red tolerance", color.RGBA{R: 109, G: 170, B: 230, A: 255}, false},
+		{"above the green tolerance", color.RGBA{R: 120, G: 181, B: 230, A: 255}, false},
+		{"above the blue tolerance", color.RGBA{R: 120, G: 170, B: 169, A: 255}, false},
+		// the uniform tolerance still applies when all the channels differ by
+		// the same amount
+		{"uniform at uniform tolerance", color.RGBA{R: 100, G: 150, B: 210, A: 255}, true},
+		{"uniform above uniform tolerance", color.RGBA{R: 99, G: 149, B: 209, A: 255}, false},
+	}
+	opts := DefaultOptions()
+	opts.ChannelTolerances = &[3]uint8{10, 10, 60}
+	opts.UniformTolerance = 20
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.c
+			if got := opts.sameColor(&c, &sky); got != tt.want {
+				t.Errorf("sameColor(%v, %v) = %v, want %v", tt.c, sky, got, tt.want)
+			}
+			if excess := opts.colorExcess(&c, &sky); (excess <= 0) != tt.want {
+				t.Errorf("colorExcess(%v, %v) = %v, disagreeing with sameColor", tt.c, sky, excess)
+			}
+		})
+	}
+}
+
+func TestSameColorEuclideanGradient(t *testing.T) {
+	// a gradient from white in which the red and green channels fall faster
+	// than the blue one, so no pixel differs uniformly from white
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	gradient := make([]color.RGBA, 16)
+	for i := range gradient {
+		gradient[i] = color.RGBA{R: uint8(255 - 4*i), G: uint8(255 - 4*i), B: uint8(255 - 3*i), A: 255}
+	}
+
+	tests := []struct {
+		metric Metric
+		// the per channel RGB metric matches while the largest channel
+		// difference, 4*i, is within the tolerance, while the Euclidean one
+		// matches while the distance, sqrt(41)*i, is
+		want int
+	}{
+		{Metrics.RGB, 11},
+		{Metrics.Euclidean, 7},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.Metric = tt.metric
+		opts.Tolerance = 40
+		matched := 0
+		for i := range gradient {
+			if opts.sameColor(&gradient[i], &white) {
+				matched++
+			} else {
+				break
+			}
+		}
+		if matched != tt.want {
+			t.Errorf("%s metric matched the first %d gradient colors, want %d", tt.metric, matched, tt.want)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.Metric = Metrics.Euclidean
+	opts.Tolerance = 30
+	// differing by 30 in a single channel is within the distance, while by 20
+	// in all of them (a distance of about 34.6) is not, unlike with RGB
+	single := color.RGBA{R: 225, G: 255, B: 255, A: 255}
+	all := color.RGBA{R: 235, G: 235, B: 235, A: 255}
+	if !opts.sameColor(&single, &white) {
+		t.Errorf("euclidean sameColor(%v, %v) = false, want true", single, white)
+	}
+	if opts.sameColor(&all, &white) {
+		t.Errorf("euclidean sameColor(%v, %v) = true, want false", all, white)
+	}
+}
+
+func TestProtectColors(t *testing.T) {
+	// a white background with an off-white square, which matches the
+	// background within the default tolerance
+	img := newTestImage(8).(*image.RGBA)
+	offWhite := color.RGBA{R: 240, G: 240, B: 236, A: 255}
+	img.SetRGBA(1, 1, offWhite)
+
+	opts := DefaultOptions()
+	opts.ProtectColors = []color.RGBA{{R: 244, G: 244, B: 244, A: 255}}
+	for _, mode := range []Mode{Modes.Global, Modes.Flood} {
+		opts.Mode = mode
+		result, err := MakeTransparent(img, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a := result.RGBAAt(1, 1).A; a != 255 {
+			t.Errorf("%s mode: protected pixel alpha = %d, want 255", mode, a)
+		}
+		if a := result.RGBAAt(0, 0).A; a != 0 {
+			t.Errorf("%s mode: background pixel alpha = %d, want 0", mode, a)
+		}
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	// the white background with a red square, and an off-white pixel far from
+	// white but matching the custom predicate
+	img := newTestImage(8).(*image.RGBA)
+	img.SetRGBA(1, 1, color.RGBA{R: 250, G: 160, B: 250, A: 255})
+
+	opts := DefaultOptions()
+	opts.Tolerance = 0
+	opts.Matcher = func(pixel, reference color.RGBA) bool {
+		// ignores the green channel
+		return uint8Diff(pixel.R, reference.R) <= 10 && uint8Diff(pixel.B, reference.B) <= 10
+	}
+	result, err := MakeTransparent(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := result.RGBAAt(1, 1).A; a != 0 {
+		t.Errorf("Matcher: matching pixel alpha = %d, want 0", a)
+	}
+	if a := result.RGBAAt(4, 4).A; a != 255 {
+		t.Errorf("Matcher: subject pixel alpha = %d, want 255", a)
+	}
+
+	// only the left half of the background is matched
+	opts = DefaultOptions()
+	opts.MatcherAt = func(x, _ int, pixel, reference color.RGBA) bool {
+		return x < 4 && pixel == reference
+	}
+	for _, mode := range []Mode{Modes.Global, Modes.Flood} {
+		opts.Mode = mode
+		result, err := MakeTransparent(img, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a := result.RGBAAt(0, 7).A; a != 0 {
+			t.Errorf("%s mode MatcherAt: left pixel alpha = %d, want 0", mode, a)
+		}
+		if a := result.RGBAAt(7, 0).A; a != 255 {
+			t.Errorf("%s mode MatcherAt: right pixel alpha = %d, want 255", mode, a)
+		}
+	}
+}
+
+func TestSameColorLinear(t *testing.T) {
+	// a light and a dark background, each with a shade having 0.06 less light
+	// (in linear light, 0-1): 0.80 and 0.74, 0.10 and 0.04. In sRGB the shade of
+	// the light background differs by 8 levels, the one of the dark background
+	// by 33, while in linear light both differ by about 15 levels.
+	light, lightShade := color.RGBA{R: 231, G: 231, B: 231, A: 255}, color.RGBA{R: 223, G: 223, B: 223, A: 255}
+	dark, darkShade := color.RGBA{R: 89, G: 89, B: 89, A: 255}, color.RGBA{R: 56, G: 56, B: 56, A: 255}
+
+	opts := DefaultOptions()
+	opts.NoUniformTolerance = true
+	// the Euclidean distance of grays is sqrt(3) times their difference
+	for metric, tolerance := range map[Metric]uint8{Metrics.RGB: 20, Metrics.Euclidean: 30} {
+		opts.Metric = metric
+		opts.Tolerance = tolerance
+		opts.Linear = false
+		if !opts.sameColor(&lightShade, &light) || opts.sameColor(&darkShade, &dark) {
+			t.Errorf("%s metric in sRGB: light shade matches %v, dark shade matches %v, want true and false",
+				metric, opts.sameColor(&lightShade, &light), opts.sameColor(&darkShade, &dark))
+		}
+		opts.Linear = true
+		if !opts.sameColor(&lightShade, &light) || !opts.sameColor(&darkShade, &dark) {
+			t.Errorf("%s metric in linear light: light shade matches %v, dark shade matches %v, want both",
+				metric, opts.sameColor(&lightShade, &light), opts.sameColor(&darkShade, &dark))
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+)
+
+// maxPaletteColors is the max number of colors of a paletted image
+const maxPaletteColors = 256
+
+// clampedRGBA64At returns the alpha-premultiplied color of the pixel of img at
+// (x, y), with the color channels of the transparent pixels, which
+// MakeTransparent keeps, cleared and the other ones clamped to the alpha
+func clampedRGBA64At(img image.Image, x, y int) color.RGBA64 {
+	r, g, b, a := img.At(x, y).RGBA()
+	clamp := func(c uint32) uint16 {
+		if c > a {
+			c = a
+		}
+		return uint16(c)
+	}
+	return color.RGBA64{R: clamp(r), G: clamp(g), B: clamp(b), A: uint16(a)}
+}
+
+// ToRGBA returns a copy of img with 8 bits per channel, e.g. to save the result
+// of MakeTransparent64 as an 8 bits PNG; its transparent pixels are black
+func ToRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := clampedRGBA64At(img, x, y)
+			result.SetRGBA(x, y, color.RGBA{R: uint8(c.R >> 8), G: uint8(c.G >> 8), B: uint8(c.B >> 8), A: uint8(c.A >> 8)})
+		}
+	}
+	return result
+}
+
+// ToRGBA64 returns a copy of img with 16 bits per channel, e.g. to save the
+// result of MakeTransparent as a 16 bits PNG; its transparent pixels are black
+func ToRGBA64(img image.Image) *image.RGBA64 {
+	bounds := img.Bounds()
+	result := image.NewRGBA64(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			result.SetRGBA64(x, y, clampedRGBA64At(img, x, y))
+		}
+	}
+	return result
+}
+
+// ToPaletted returns a copy of img as a paletted image whose palette has
+// exactly its colors (all the transparent pixels sharing a single entry), which
+// PNG encodes much smaller than RGBA. It reports false if img has more than 256
+// colors, as no colors are merged.
+func ToPaletted(img image.Image) (*image.Paletted, bool) {
+	bounds := img.Bounds()
+	indexes := make(map[color.RGBA64]uint8)
+	var palette color.Palette
+	pix := make([]uint8, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := clampedRGBA64At(img, x, y)
+			i, ok := indexes[c]
+			if !ok {
+				if len(palette) == maxPaletteColors {
+					return nil, false
+				}
+				i = uint8(len(palette))
+				indexes[c] = i
+				palette = append(palette, c)
+			}
+			pix = append(pix, i)
+		}
+	}
+	result := image.NewPaletted(bounds, palette)
+	result.Pix = pix
+	return result, true
+}
+
+// ToGrayAlpha returns a copy of img converted to grayscale, keeping its alpha:
+// an image.Gray if img is opaque, otherwise an image.NRGBA whose color channels
+// are the gray levels, since image/png can't encode the gray with alpha color
+// type
+func ToGrayAlpha(img image.Image) image.Image {
+	bounds := img.Bounds()
+	result := image.NewNRGBA(bounds)
+	opaque := true
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := clampedRGBA64At(img, x, y)
+			if c.A == 0 {
+				opaque = false
+				continue
+			}
+			// the luminance of the straight color, like color.GrayModel does
+			r, g, b := uint32(c.R)*0xffff/uint32(c.A), uint32(c.G)*0xffff/uint32(c.A), uint32(c.B)*0xffff/uint32(c.A)
+			level := uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+			result.SetNRGBA(x, y, color.NRGBA{R: level, G: level, B: level, A: uint8(c.A >> 8)})
+			opaque = opaque && c.A == 0xffff
+		}
+	}
+	if !opaque {
+		return result
+	}
+	gray := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray.SetGray(x, y, color.Gray{Y: result.NRGBAAt(x, y).R})
+		}
+	}
+	return gray
+}
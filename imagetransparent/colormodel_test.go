@@ -0,0 +1,56 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestToPaletted(t *testing.T) {
+	// the transparent pixels keep their color channels, but share a single
+	// palette entry
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	img.SetRGBA(0, 0, color.RGBA{R: 255, A: 255})
+	img.SetRGBA(1, 0, color.RGBA{R: 10, G: 20, B: 30})
+	img.SetRGBA(2, 0, color.RGBA{R: 40, G: 50, B: 60})
+	img.SetRGBA(3, 0, color.RGBA{R: 255, A: 255})
+	paletted, ok := ToPaletted(img)
+	if !ok {
+		t.Fatal("ToPaletted of 2 colors failed")
+	}
+	if len(paletted.Palette) != 2 {
+		t.Errorf("palette of %d colors, want 2", len(paletted.Palette))
+	}
+	for x, want := range []color.RGBA{{R: 255, A: 255}, {}, {}, {R: 255, A: 255}} {
+		if got := color.RGBAModel.Convert(paletted.At(x, 0)); got != want {
+			t.Errorf("pixel %d = %v, want %v", x, got, want)
+		}
+	}
+
+	many := image.NewRGBA(image.Rect(0, 0, 257, 1))
+	for x := 0; x < 257; x++ {
+		many.SetRGBA(x, 0, color.RGBA{R: uint8(x), G: uint8(x >> 8), A: 255})
+	}
+	if _, ok := ToPaletted(many); ok {
+		t.Error("ToPaletted of 257 colors succeeded")
+	}
+}
+
+func TestToGrayAlpha(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	img.SetRGBA(1, 0, color.RGBA{R: 128, A: 128})
+	gray := ToGrayAlpha(img)
+	if _, ok := gray.(*image.NRGBA); !ok {
+		t.Fatalf("ToGrayAlpha of a transparent image = %T, want *image.NRGBA", gray)
+	}
+	// the luminance of red is about 30%
+	if got, want := gray.(*image.NRGBA).NRGBAAt(1, 0), (color.NRGBA{R: 76, G: 76, B: 76, A: 128}); got != want {
+		t.Errorf("semi-transparent red = %v, want %v", got, want)
+	}
+
+	img.SetRGBA(1, 0, color.RGBA{A: 255})
+	if opaque, ok := ToGrayAlpha(img).(*image.Gray); !ok || opaque.GrayAt(0, 0).Y != 255 {
+		t.Errorf("ToGrayAlpha of an opaque image = %T, want a white *image.Gray pixel", opaque)
+	}
+}
@@ -0,0 +1,55 @@
+package imagetransparent
+
+import (
+	"fmt"
+	"image"
+)
+
+// Difference between an image and the expected one, see Compare
+type Difference struct {
+	// Pixels is the number of pixels which differ
+	Pixels int
+	// Total is the number of pixels of each image
+	Total int
+	// MaxChannelDiff is the largest difference of a channel (red, green, blue
+	// or alpha) of the pixels which differ
+	MaxChannelDiff uint8
+}
+
+// Similarity is the percentage (0-100) of the pixels which are the same
+func (d Difference) Similarity() float64 {
+	if d.Total == 0 {
+		return 100
+	}
+	return 100 * float64(d.Total-d.Pixels) / float64(d.Total)
+}
+
+// Compare compares img with the expected image pixel by pixel, e.g. to check
+// that the output of a pipeline doesn't change across versions. The pixels are
+// compared as 8 bits straight colors, as saved in PNG images; the colors of the
+// transparent pixels, which are meaningless, don't count. The images have to be
+// of the same size, but their bounds may be offset.
+func Compare(img, expected image.Image) (Difference, error) {
+	bounds, expectedBounds := img.Bounds(), expected.Bounds()
+	if bounds.Size() != expectedBounds.Size() {
+		return Difference{}, fmt.Errorf("the image is %dx%d, while the expected one is %dx%d", bounds.Dx(), bounds.Dy(), expectedBounds.Dx(), expectedBounds.Dy())
+	}
+	diff := Difference{Total: bounds.Dx() * bounds.Dy()}
+	offset := expectedBounds.Min.Sub(bounds.Min)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			a := straightColor(img.At(x, y))
+			b := straightColor(expected.At(x+offset.X, y+offset.Y))
+			if a == b || (a.A == 0 && b.A == 0) {
+				continue
+			}
+			diff.Pixels++
+			for _, d := range [4]uint8{uint8Diff(a.R, b.R), uint8Diff(a.G, b.G), uint8Diff(a.B, b.B), uint8Diff(a.A, b.A)} {
+				if d > diff.MaxChannelDiff {
+					diff.MaxChannelDiff = d
+				}
+			}
+		}
+	}
+	return diff, nil
+}
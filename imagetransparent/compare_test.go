@@ -0,0 +1,37 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	img := newTestImage(8).(*image.RGBA)
+	// the same pixels, offset, but with a different color under a transparent
+	// pixel and a slightly different one
+	expected := image.NewNRGBA(image.Rect(10, 10, 18, 18))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			expected.Set(x+10, y+10, img.At(x, y))
+		}
+	}
+	img.SetRGBA(0, 0, color.RGBA{})
+	expected.SetNRGBA(10, 10, color.NRGBA{R: 12, G: 34, B: 56})
+	expected.SetNRGBA(14, 14, color.NRGBA{R: 250, A: 255})
+
+	diff, err := Compare(img, expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Difference{Pixels: 1, Total: 64, MaxChannelDiff: 5}); diff != want {
+		t.Errorf("Compare = %+v, want %+v", diff, want)
+	}
+	if got, want := diff.Similarity(), 100*63/64.0; got != want {
+		t.Errorf("Similarity = %v, want %v", got, want)
+	}
+
+	if _, err := Compare(img, image.NewRGBA(image.Rect(0, 0, 8, 7))); err == nil {
+		t.Error("Compare of images of different sizes error = nil, want an error")
+	}
+}
@@ -0,0 +1,85 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// IsDeep reports whether img has 16 bits per channel
+func IsDeep(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		return true
+	default:
+		return false
+	}
+}
+
+// MakeTransparent64 is like MakeTransparentCount, but returns an image with 16
+// bits per channel, so the tonal data of deep images (see IsDeep) is kept. The
+// background is matched with the 8 bits per channel precision of the tolerances;
+// the kept pixels keep all their 16 bits.
+func MakeTransparent64(img image.Image, opts Options) (*image.RGBA64, int, error) {
+	replaceWith := opts.ReplaceWith
+	opts.ReplaceWith = nil
+	stats, imageRGBA, err := makeBackgroundTransparent(img, &opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	changed := stats.PixelsChanged
+	if changed == 0 {
+		return nil, 0, notConverted(stats)
+	}
+
+	bounds := img.Bounds()
+	deep := image.NewRGBA64(bounds)
+	draw.Draw(deep, bounds, img, bounds.Min, draw.Src)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// the 8 bits alpha only differs from the original one if the pixel
+			// was made (partially, when feathering) transparent
+			a := imageRGBA.RGBAAt(x, y).A
+			c := deep.RGBA64At(x, y)
+			if a == uint8(c.A>>8) {
+				continue
+			}
+			if a == 0 {
+				deep.SetRGBA64(x, y, color.RGBA64{})
+				continue
+			}
+			f := float64(a) / float64(c.A>>8)
+			deep.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(float64(c.R) * f),
+				G: uint16(float64(c.G) * f),
+				B: uint16(float64(c.B) * f),
+				A: uint16(float64(c.A) * f),
+			})
+		}
+	}
+	if replaceWith != nil {
+		fillBackground64(deep, *replaceWith)
+	}
+	return deep, changed, nil
+}
+
+// fillBackground64 is the 16 bits per channel version of fillBackground
+func fillBackground64(img *image.RGBA64, c color.RGBA) {
+	r, g, b := uint32(c.R)*0x101, uint32(c.G)*0x101, uint32(c.B)*0x101
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			p := img.RGBA64At(x, y)
+			if p.A == 0xffff {
+				continue
+			}
+			rest := 0xffff - uint32(p.A)
+			img.SetRGBA64(x, y, color.RGBA64{
+				R: p.R + uint16(r*rest/0xffff),
+				G: p.G + uint16(g*rest/0xffff),
+				B: p.B + uint16(b*rest/0xffff),
+				A: 0xffff,
+			})
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestMakeTransparent64KeepsDepth(t *testing.T) {
+	// white background with a square whose color needs 16 bits
+	fg := color.NRGBA64{R: 0x1234, G: 0x5678, B: 0x9abc, A: 0xffff}
+	img := image.NewNRGBA64(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if x >= 2 && x < 6 && y >= 2 && y < 6 {
+				img.SetNRGBA64(x, y, fg)
+			} else {
+				img.SetNRGBA64(x, y, color.NRGBA64{R: 0xffff, G: 0xffff, B: 0xffff, A: 0xffff})
+			}
+		}
+	}
+	if !IsDeep(img) {
+		t.Fatal("16 bits per channel image is not deep")
+	}
+
+	result, changed, err := MakeTransparent64(img, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 64-16 {
+		t.Errorf("changed %d pixels, want %d", changed, 64-16)
+	}
+	if a := result.RGBA64At(0, 0).A; a != 0 {
+		t.Errorf("background alpha = %#x, want 0", a)
+	}
+	if c := result.RGBA64At(3, 3); c != (color.RGBA64{R: fg.R, G: fg.G, B: fg.B, A: fg.A}) {
+		t.Errorf("foreground = %#v, want %#v", c, fg)
+	}
+}
@@ -0,0 +1,134 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+)
+
+// despeckle removes the stray pixels left by the background removal: it makes
+// transparent the islands (4-connected) of pixels which aren't transparent
+// having less than size pixels, and fills the transparent holes having less than
+// size pixels back with the pixels of src, unless they touch the image edges
+// (they are background then). Returns the number of pixels made transparent
+// minus the number of pixels filled.
+func despeckle(img *image.RGBA, src image.Image, size int) int {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	visited := make([]bool, width*bounds.Dy())
+	var component, queue []image.Point
+
+	// collect returns the component of the pixel at (x, y) in component and
+	// whether it touches the image edges
+	collect := func(x, y int, transparent bool) bool {
+		component = component[:0]
+		queue = append(queue[:0], image.Point{x, y})
+		visited[(y-bounds.Min.Y)*width+(x-bounds.Min.X)] = true
+		touchesEdge := false
+		for len(queue) > 0 {
+			p := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			component = append(component, p)
+			if p.X == bounds.Min.X || p.X == bounds.Max.X-1 || p.Y == bounds.Min.Y || p.Y == bounds.Max.Y-1 {
+				touchesEdge = true
+			}
+			for _, n := range [4]image.Point{{p.X + 1, p.Y}, {p.X - 1, p.Y}, {p.X, p.Y + 1}, {p.X, p.Y - 1}} {
+				if !n.In(bounds) {
+					continue
+				}
+				i := (n.Y-bounds.Min.Y)*width + (n.X - bounds.Min.X)
+				if visited[i] || (img.RGBAAt(n.X, n.Y).A == 0) != transparent {
+					continue
+				}
+				visited[i] = true
+				queue = append(queue, n)
+			}
+		}
+		return touchesEdge
+	}
+
+	changed := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if visited[(y-bounds.Min.Y)*width+(x-bounds.Min.X)] {
+				continue
+			}
+			transparent := img.RGBAAt(x, y).A == 0
+			touchesEdge := collect(x, y, transparent)
+			if len(component) >= size {
+				continue
+			}
+			switch {
+			case !transparent:
+				for _, p := range component {
+					c := img.RGBAAt(p.X, p.Y)
+					c.A = 0
+					img.SetRGBA(p.X, p.Y, c)
+					changed++
+				}
+			case !touchesEdge:
+				for _, p := range component {
+					c := color.RGBAModel.Convert(src.At(p.X, p.Y)).(color.RGBA)
+					img.SetRGBA(p.X, p.Y, c)
+					if c.A != 0 {
+						changed--
+					}
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// restoreSmallRegions keeps the small matches of the background removal: the
+// areas (4-connected) of pixels made transparent, i.e. which aren't transparent
+// in src, having less than size pixels are filled back with the pixels of src,
+// wherever they are. Returns the number of pixels filled.
+func restoreSmallRegions(img *image.RGBA, src image.Image, size int) int {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	removed := func(p image.Point) bool {
+		if img.RGBAAt(p.X, p.Y).A != 0 {
+			return false
+		}
+		_, _, _, a := src.At(p.X, p.Y).RGBA()
+		return a != 0
+	}
+	visited := make([]bool, width*bounds.Dy())
+	var component, queue []image.Point
+	restored := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i := (y-bounds.Min.Y)*width + (x - bounds.Min.X)
+			if visited[i] || !removed(image.Point{x, y}) {
+				continue
+			}
+			visited[i] = true
+			component = component[:0]
+			queue = append(queue[:0], image.Point{x, y})
+			for len(queue) > 0 {
+				p := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+				component = append(component, p)
+				for _, n := range [4]image.Point{{p.X + 1, p.Y}, {p.X - 1, p.Y}, {p.X, p.Y + 1}, {p.X, p.Y - 1}} {
+					if !n.In(bounds) {
+						continue
+					}
+					j := (n.Y-bounds.Min.Y)*width + (n.X - bounds.Min.X)
+					if visited[j] || !removed(n) {
+						continue
+					}
+					visited[j] = true
+					queue = append(queue, n)
+				}
+			}
+			if len(component) >= size {
+				continue
+			}
+			for _, p := range component {
+				img.SetRGBA(p.X, p.Y, color.RGBAModel.Convert(src.At(p.X, p.Y)).(color.RGBA))
+				restored++
+			}
+		}
+	}
+	return restored
+}
@@ -0,0 +1,253 @@
+package imagetransparent
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// BackgroundMode ...
+type BackgroundMode string
+
+// BackgroundModes of detecting the background color: Corners samples the image
+// corners, Mode picks the most frequent color of the image, while Gradient
+// interpolates the background color of each pixel between the colors of the
+// corners (see DetectGradientCorners), for backgrounds with a lighting falloff
+var BackgroundModes = struct {
+	Corners  BackgroundMode
+	Mode     BackgroundMode
+	Gradient BackgroundMode
+}{
+	Corners:  "corners",
+	Mode:     "mode",
+	Gradient: "gradient",
+}
+
+// Corner ...
+type Corner string
+
+// Corners of an image
+var Corners = struct {
+	TopLeft     Corner
+	TopRight    Corner
+	BottomLeft  Corner
+	BottomRight Corner
+}{
+	TopLeft:     "top-left",
+	TopRight:    "top-right",
+	BottomLeft:  "bottom-left",
+	BottomRight: "bottom-right",
+}
+
+// MismatchedCorners returns the corners of img whose pixel doesn't match any of
+// opts.BackgroundColors (within the tolerances of opts), ignoring opts.Invert;
+// transparent corners match. A detected background color which doesn't match
+// all the corners is suspect, e.g. the subject may extend into a corner.
+func MismatchedCorners(img image.Image, opts Options) []Corner {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil
+	}
+	opts.gray = opts.gray || isGray(img)
+	corners := []struct {
+		corner Corner
+		p      image.Point
+	}{
+		{Corners.TopLeft, bounds.Min},
+		{Corners.TopRight, image.Point{bounds.Max.X - 1, bounds.Min.Y}},
+		{Corners.BottomLeft, image.Point{bounds.Min.X, bounds.Max.Y - 1}},
+		{Corners.BottomRight, image.Point{bounds.Max.X - 1, bounds.Max.Y - 1}},
+	}
+	var mismatched []Corner
+	for _, c := range corners {
+		sample := straightColor(img.At(c.p.X, c.p.Y))
+		if sample.A != 0 && !opts.matchesAny(&sample, opts.BackgroundColors) {
+			mismatched = append(mismatched, c.corner)
+		}
+	}
+	return mismatched
+}
+
+// DetectBackgroundColor detects the background color of img as configured by
+// opts.BackgroundMode (see detectCornersColor and detectModalColor; for
+// Gradient it is the average of the DetectGradientCorners colors). With
+// opts.BorderSample, the Corners and Mode ones pick the most frequent color of
+// the band that thick along the image edges instead, while with opts.SeedPoint
+// (in the Flood mode) it is the color of the seed pixel. The second return
+// value reports whether the result is ambiguous.
+func DetectBackgroundColor(img image.Image, opts Options) (color.RGBA, bool) {
+	opts.gray = opts.gray || isGray(img)
+	if p, ok := opts.seed(img.Bounds()); ok {
+		return straightColor(img.At(p.X, p.Y)), false
+	}
+	if opts.BorderSample > 0 && opts.BackgroundMode != BackgroundModes.Gradient {
+		return detectModalColor(img, opts.BorderSample)
+	}
+	switch opts.BackgroundMode {
+	case BackgroundModes.Mode:
+		return detectModalColor(img, 0)
+	case BackgroundModes.Gradient:
+		corners := DetectGradientCorners(img)
+		var r, g, b, a int
+		for _, c := range corners {
+			r += int(c.R)
+			g += int(c.G)
+			b += int(c.B)
+			a += int(c.A)
+		}
+		return color.RGBA{R: uint8(r / 4), G: uint8(g / 4), B: uint8(b / 4), A: uint8(a / 4)}, false
+	default:
+		return detectCornersColor(img, &opts)
+	}
+}
+
+// detectCornersColor samples the corners (and, if opts.SampleEdgeMidpoints is
+// set, the edge midpoints) of the image, groups the samples which have the same
+// color and returns the average color of the largest group. The transparent
+// samples, whose color is meaningless, are skipped: if no two of the other
+// samples have the same color, the background is considered already removed
+// when at least two samples are transparent, otherwise the result is ambiguous
+// and the first sample which isn't transparent is returned.
+func detectCornersColor(img image.Image, opts *Options) (color.RGBA, bool) {
+	bounds := img.Bounds()
+	minX, minY := bounds.Min.X, bounds.Min.Y
+	maxX, maxY := bounds.Max.X-1, bounds.Max.Y-1
+	points := []image.Point{{minX, minY}, {maxX, minY}, {minX, maxY}, {maxX, maxY}}
+	if opts.SampleEdgeMidpoints {
+		midX, midY := (minX+maxX)/2, (minY+maxY)/2
+		points = append(points, image.Point{midX, minY}, image.Point{midX, maxY}, image.Point{minX, midY}, image.Point{maxX, midY})
+	}
+
+	samples := make([]color.RGBA, len(points))
+	for i, p := range points {
+		samples[i] = straightColor(img.At(p.X, p.Y))
+	}
+
+	best, firstTransparent, transparent := 0, -1, 0
+	var bestGroup []color.RGBA
+	for i := range samples {
+		if samples[i].A == 0 {
+			if firstTransparent < 0 {
+				firstTransparent = i
+			}
+			transparent++
+			continue
+		}
+		var group []color.RGBA
+		for j := range samples {
+			if samples[j].A != 0 && opts.sameColor(&samples[j], &samples[i]) {
+				group = append(group, samples[j])
+			}
+		}
+		if len(group) > len(bestGroup) {
+			best, bestGroup = i, group
+		}
+	}
+	if len(bestGroup) < 2 {
+		if transparent >= 2 {
+			return samples[firstTransparent], false
+		}
+		return samples[best], true
+	}
+
+	var r, g, b int
+	for _, c := range bestGroup {
+		r += int(c.R)
+		g += int(c.G)
+		b += int(c.B)
+	}
+	n := len(bestGroup)
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: samples[best].A}, false
+}
+
+// modalBucketBits is the number of the most significant bits of each color
+// channel which identify the histogram bucket of a color in detectModalColor
+const modalBucketBits = 4
+
+// detectModalColor builds a histogram of the colors of the pixels of img which
+// are not transparent, quantized to buckets of similar colors, and returns the
+// average color of the fullest bucket. If border is greater than 0, only the
+// pixels of the band that thick along the image edges are counted. If all the
+// pixels are transparent the result is ambiguous and the top-left pixel color is
+// returned.
+func detectModalColor(img image.Image, border int) (color.RGBA, bool) {
+	imageRGBA, ok := img.(*image.RGBA)
+	if !ok {
+		imageRGBA = image.NewRGBA(img.Bounds())
+		draw.Draw(imageRGBA, img.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+
+	type bucket struct {
+		count, r, g, b int
+	}
+	const shift = 8 - modalBucketBits
+	buckets := make([]bucket, 1<<(3*modalBucketBits))
+	bounds := imageRGBA.Bounds()
+	best := -1
+	// the interior, which isn't counted; empty if the whole image is
+	var inner image.Rectangle
+	if border > 0 && bounds.Dx() > 2*border && bounds.Dy() > 2*border {
+		inner = bounds.Inset(border)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if x == inner.Min.X && y >= inner.Min.Y && y < inner.Max.Y {
+				x = inner.Max.X - 1
+				continue
+			}
+			c := straightRGBAAt(imageRGBA, x, y)
+			if c.A == 0 {
+				continue
+			}
+			i := int(c.R>>shift)<<(2*modalBucketBits) | int(c.G>>shift)<<modalBucketBits | int(c.B>>shift)
+			bk := &buckets[i]
+			bk.count++
+			bk.r += int(c.R)
+			bk.g += int(c.G)
+			bk.b += int(c.B)
+			if best < 0 || bk.count > buckets[best].count {
+				best = i
+			}
+		}
+	}
+	if best < 0 {
+		return straightColor(img.At(bounds.Min.X, bounds.Min.Y)), true
+	}
+	bk := buckets[best]
+	return color.RGBA{R: uint8(bk.r / bk.count), G: uint8(bk.g / bk.count), B: uint8(bk.b / bk.count), A: 255}, false
+}
+
+// ErrEmptySwatch is returned by SwatchColor when the swatch has no pixels which
+// are not transparent
+var ErrEmptySwatch = errors.New("swatch is empty - it has no pixels which are not transparent")
+
+// SwatchColor returns the average color of the pixels of img which are not
+// transparent, e.g. of a sample of the backdrop photographed separately, to be
+// used as a background color (see Options.BackgroundColors)
+func SwatchColor(img image.Image) (color.RGBA, error) {
+	imageRGBA, ok := img.(*image.RGBA)
+	if !ok {
+		imageRGBA = image.NewRGBA(img.Bounds())
+		draw.Draw(imageRGBA, img.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+	bounds := imageRGBA.Bounds()
+	var count, r, g, b int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := straightRGBAAt(imageRGBA, x, y)
+			if c.A == 0 {
+				continue
+			}
+			count++
+			r += int(c.R)
+			g += int(c.G)
+			b += int(c.B)
+		}
+	}
+	if count == 0 {
+		return color.RGBA{}, ErrEmptySwatch
+	}
+	// rounded to the nearest
+	return color.RGBA{R: uint8((r + count/2) / count), G: uint8((g + count/2) / count), B: uint8((b + count/2) / count), A: 255}, nil
+}
@@ -0,0 +1,129 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"testing"
+)
+
+func TestMismatchedCorners(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	img := newTestImage(8).(*image.RGBA)
+	opts := DefaultOptions()
+	opts.BackgroundColors = []color.RGBA{white}
+
+	if corners := MismatchedCorners(img, opts); len(corners) != 0 {
+		t.Errorf("corners of a white background = %v, want none mismatched", corners)
+	}
+
+	// the subject extends into the bottom-right corner, the top-right one is
+	// transparent
+	img.SetRGBA(7, 7, color.RGBA{B: 255, A: 255})
+	img.SetRGBA(7, 0, color.RGBA{})
+	opts.Invert = true
+	want := []Corner{Corners.BottomRight}
+	if corners := MismatchedCorners(img, opts); !reflect.DeepEqual(corners, want) {
+		t.Errorf("mismatched corners = %v, want %v", corners, want)
+	}
+}
+
+func TestDetectBackgroundColorBorderSample(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	red := color.RGBA{R: 255, A: 255}
+	// a white border 2 pixels thick with a small red patch in it, around a red
+	// subject filling most of the image
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			c := white
+			if (x >= 2 && x < 18 && y >= 2 && y < 18) || (x < 2 && y < 3) {
+				c = red
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.BackgroundMode = BackgroundModes.Mode
+	if got, _ := DetectBackgroundColor(img, opts); got != red {
+		t.Fatalf("modal color of the whole image = %v, want %v", got, red)
+	}
+	for _, mode := range []BackgroundMode{BackgroundModes.Mode, BackgroundModes.Corners} {
+		opts.BackgroundMode = mode
+		opts.BorderSample = 2
+		got, ambiguous := DetectBackgroundColor(img, opts)
+		if got != white || ambiguous {
+			t.Errorf("%s with a border sample of 2 = %v (ambiguous %t), want %v", mode, got, ambiguous, white)
+		}
+	}
+
+	// a border thicker than half the image samples all of it
+	opts.BorderSample = 10
+	if got, _ := DetectBackgroundColor(img, opts); got != red {
+		t.Errorf("border sample of 10 = %v, want %v", got, red)
+	}
+}
+
+func TestDetectBackgroundColorTransparentCorners(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	// a white background with a red square in its middle, whose top corners
+	// were already made transparent (as 3x3 patches)
+	img := image.NewRGBA(image.Rect(0, 0, 12, 12))
+	draw.Draw(img, img.Bounds(), image.NewUniform(white), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(5, 5, 7, 7), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	transparentCorners := func(y0 int) {
+		draw.Draw(img, image.Rect(0, y0, 3, y0+3), image.Transparent, image.Point{}, draw.Src)
+		draw.Draw(img, image.Rect(9, y0, 12, y0+3), image.Transparent, image.Point{}, draw.Src)
+	}
+	transparentCorners(0)
+
+	for _, mode := range []BackgroundMode{BackgroundModes.Corners, BackgroundModes.Mode, BackgroundModes.Gradient} {
+		opts := DefaultOptions()
+		opts.BackgroundMode = mode
+		got, ambiguous := DetectBackgroundColor(img, opts)
+		if got != white || ambiguous {
+			t.Errorf("%s background = %v (ambiguous %t), want %v", mode, got, ambiguous, white)
+		}
+		// the pixels which were already transparent aren't made transparent
+		// again
+		_, changed, err := MakeTransparentCount(img, opts)
+		if err != nil {
+			t.Fatalf("%s background: %v", mode, err)
+		}
+		if want := 144 - 4 - 18; changed != want {
+			t.Errorf("%s background: changed %d pixels, want %d", mode, changed, want)
+		}
+	}
+	if corners := DetectGradientCorners(img); corners[0] != white || corners[1] != white {
+		t.Errorf("gradient corners = %v, want white top corners", corners)
+	}
+
+	// all the corners are transparent
+	transparentCorners(9)
+	if _, err := MakeTransparent(img, DefaultOptions()); err != ErrAlreadyTransparent {
+		t.Errorf("MakeTransparent of an image with transparent corners returned %v, want ErrAlreadyTransparent", err)
+	}
+}
+
+func TestSwatchColor(t *testing.T) {
+	// a noisy backdrop around 200,100,50 with a transparent pixel, which isn't
+	// counted
+	swatch := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	swatch.SetNRGBA(0, 0, color.NRGBA{R: 198, G: 101, B: 50, A: 255})
+	swatch.SetNRGBA(1, 0, color.NRGBA{R: 202, G: 99, B: 48, A: 255})
+	swatch.SetNRGBA(0, 1, color.NRGBA{R: 200, G: 100, B: 53, A: 255})
+	swatch.SetNRGBA(1, 1, color.NRGBA{R: 255, A: 0})
+	got, err := SwatchColor(swatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (color.RGBA{R: 200, G: 100, B: 50, A: 255}); got != want {
+		t.Errorf("SwatchColor = %v, want %v", got, want)
+	}
+
+	if _, err := SwatchColor(image.NewRGBA(image.Rect(0, 0, 2, 2))); err != ErrEmptySwatch {
+		t.Errorf("SwatchColor of a transparent image error = %v, want ErrEmptySwatch", err)
+	}
+}
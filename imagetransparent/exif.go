@@ -0,0 +1,187 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// exif is the TIFF structure holding the EXIF metadata of an image
+type exif struct {
+	tiff  []byte
+	order binary.ByteOrder
+}
+
+// findEXIF locates the EXIF metadata in JPEG (APP1 segment) or TIFF image data
+func findEXIF(data []byte) (*exif, bool) {
+	tiff := data
+	if bytes.HasPrefix(data, []byte{0xFF, 0xD8}) {
+		tiff = nil
+		for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+			marker := data[i+1]
+			if marker == 0xDA || marker == 0xD9 { // start of scan / end of image
+				break
+			}
+			length := int(binary.BigEndian.Uint16(data[i+2:]))
+			end := i + 2 + length
+			if length < 2 || end > len(data) {
+				break
+			}
+			segment := data[i+4 : end]
+			if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+				tiff = segment[6:]
+				break
+			}
+			i = end
+		}
+	}
+
+	// the byte order mark and the offset of the first IFD
+	if len(tiff) < 8 {
+		return nil, false
+	}
+	switch {
+	case bytes.HasPrefix(tiff, []byte("II*\x00")):
+		return &exif{tiff: tiff, order: binary.LittleEndian}, true
+	case bytes.HasPrefix(tiff, []byte("MM\x00*")):
+		return &exif{tiff: tiff, order: binary.BigEndian}, true
+	default:
+		return nil, false
+	}
+}
+
+// firstIFD returns the offset of the first IFD, or -1 if it is out of the
+// TIFF structure
+func (e *exif) firstIFD() int {
+	offset := e.order.Uint32(e.tiff[4:])
+	if uint64(offset)+2 > uint64(len(e.tiff)) {
+		return -1
+	}
+	return int(offset)
+}
+
+// tag returns the 4 bytes value (or value offset) field of the given tag from
+// the first IFD, together with the tag's type and count
+func (e *exif) tag(tag uint16) (uint16, uint32, []byte, bool) {
+	return e.ifdTag(e.firstIFD(), tag)
+}
+
+// ifdTag is like tag, but looks for the tag in the IFD at the given offset;
+// the entries beyond the end of the TIFF structure are ignored
+func (e *exif) ifdTag(ifd int, tag uint16) (uint16, uint32, []byte, bool) {
+	if ifd < 8 || ifd > len(e.tiff)-2 {
+		return 0, 0, nil, false
+	}
+	entries := int(e.order.Uint16(e.tiff[ifd:]))
+	if max := (len(e.tiff) - ifd - 2) / 12; entries > max {
+		entries = max
+	}
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if e.order.Uint16(e.tiff[entry:]) == tag {
+			return e.order.Uint16(e.tiff[entry+2:]), e.order.Uint32(e.tiff[entry+4:]), e.tiff[entry+8 : entry+12], true
+		}
+	}
+	return 0, 0, nil, false
+}
+
+// ascii returns the value of the given ASCII tag from the IFD at the given
+// offset, without its NUL terminator and surrounding spaces
+func (e *exif) ascii(ifd int, tag uint16) string {
+	typ, count, value, ok := e.ifdTag(ifd, tag)
+	if !ok || typ != 2 || count == 0 {
+		return ""
+	}
+	if count > 4 {
+		offset := int(e.order.Uint32(value))
+		if offset < 0 || uint64(offset)+uint64(count) > uint64(len(e.tiff)) {
+			return ""
+		}
+		value = e.tiff[offset : offset+int(count)]
+	} else {
+		value = value[:count]
+	}
+	if i := bytes.IndexByte(value, 0); i >= 0 {
+		value = value[:i]
+	}
+	return string(bytes.TrimSpace(value))
+}
+
+const exifOrientationTag = 0x0112
+
+// ExifOrientation returns the EXIF Orientation (1-8) of the JPEG or TIFF image
+// data, or 1 (normal) if there is none
+func ExifOrientation(data []byte) int {
+	e, ok := findEXIF(data)
+	if !ok {
+		return 1
+	}
+	typ, count, value, ok := e.tag(exifOrientationTag)
+	if !ok || typ != 3 || count != 1 { // a single SHORT
+		return 1
+	}
+	if orientation := int(e.order.Uint16(value)); orientation >= 1 && orientation <= 8 {
+		return orientation
+	}
+	return 1
+}
+
+// Orient rotates and/or flips img as indicated by the EXIF orientation, so that
+// it is displayed upright; orientation 1 (or an unknown one) returns img as is.
+// 16 bits per channel images (see IsDeep) keep their depth.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	if IsDeep(img) {
+		src := image.NewRGBA64(image.Rect(0, 0, w, h))
+		draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+		dst := image.NewRGBA64(image.Rect(0, 0, dstW, dstH))
+		forEachOrientedPixel(w, h, orientation, func(x, y, dx, dy int) {
+			dst.SetRGBA64(dx, dy, src.RGBA64At(x, y))
+		})
+		return dst
+	}
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	forEachOrientedPixel(w, h, orientation, func(x, y, dx, dy int) {
+		dst.SetRGBA(dx, dy, src.RGBAAt(x, y))
+	})
+	return dst
+}
+
+// forEachOrientedPixel calls fn with the coordinates of every pixel of a w x h
+// image and the ones it has after being oriented as indicated by orientation
+func forEachOrientedPixel(w, h, orientation int, fn func(x, y, dx, dy int)) {
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // flip horizontal
+				dx, dy = w-1-x, y
+			case 3: // rotate 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // flip vertical
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // rotate 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotate 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			fn(x, y, dx, dy)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package imagetransparent
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// exifTIFF returns a TIFF structure in the given byte order whose first IFD
+// has a single SHORT entry of the given tag and value
+func exifTIFF(order binary.ByteOrder, tag, value uint16) []byte {
+	tiff := []byte("II*\x00")
+	if order == binary.BigEndian {
+		tiff = []byte("MM\x00*")
+	}
+	tiff = append(tiff, make([]byte, 4+2+12+4)...)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], tag)
+	order.PutUint16(tiff[12:], 3) // SHORT
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], value)
+	return tiff // no next IFD
+}
+
+// exifJPEG returns the start of a JPEG having the given EXIF TIFF structure in
+// its APP1 segment
+func exifJPEG(tiff []byte) []byte {
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE1, byte((2 + len(segment)) >> 8), byte(2 + len(segment))}
+	data = append(data, segment...)
+	return append(data, 0xFF, 0xD9)
+}
+
+func TestExifOrientation(t *testing.T) {
+	truncatedEntries := exifTIFF(binary.LittleEndian, exifOrientationTag, 6)
+	// 1000 entries, of which only the first one is there
+	binary.LittleEndian.PutUint16(truncatedEntries[8:], 1000)
+	badOffset := exifTIFF(binary.BigEndian, exifOrientationTag, 6)
+	binary.BigEndian.PutUint32(badOffset[4:], 0xFFFFFFF0)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"little endian JPEG", exifJPEG(exifTIFF(binary.LittleEndian, exifOrientationTag, 6)), 6},
+		{"big endian JPEG", exifJPEG(exifTIFF(binary.BigEndian, exifOrientationTag, 3)), 3},
+		{"TIFF", exifTIFF(binary.LittleEndian, exifOrientationTag, 8), 8},
+		{"truncated entries", exifJPEG(truncatedEntries), 6},
+		{"out of range orientation", exifJPEG(exifTIFF(binary.LittleEndian, exifOrientationTag, 9)), 1},
+		{"no orientation", exifJPEG(exifTIFF(binary.LittleEndian, 0x010F, 6)), 1},
+		{"header only", exifJPEG([]byte("II*\x00")), 1},
+		{"truncated IFD offset", exifJPEG([]byte("MM\x00*\x00\x00")), 1},
+		{"IFD offset out of range", exifJPEG(badOffset), 1},
+		{"IFD offset at the end", exifJPEG([]byte("II*\x00\x08\x00\x00\x00\x01")), 1},
+		{"garbage", []byte("II*\x00\xFF\xFF\xFF\xFF\x12\x34"), 1},
+		{"no EXIF", []byte{0xFF, 0xD8, 0xFF, 0xD9}, 1},
+		{"empty", nil, 1},
+	}
+	for _, tt := range tests {
+		if got := ExifOrientation(tt.data); got != tt.want {
+			t.Errorf("%s: ExifOrientation = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// a 3 x 2 image whose top-left pixel is red
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	red := color.RGBA{R: 255, A: 255}
+	img.SetRGBA(0, 0, red)
+
+	tests := []struct {
+		orientation int
+		size, red   image.Point
+	}{
+		{1, image.Point{3, 2}, image.Point{0, 0}},
+		{2, image.Point{3, 2}, image.Point{2, 0}},
+		{3, image.Point{3, 2}, image.Point{2, 1}},
+		{4, image.Point{3, 2}, image.Point{0, 1}},
+		{5, image.Point{2, 3}, image.Point{0, 0}},
+		{6, image.Point{2, 3}, image.Point{1, 0}},
+		{7, image.Point{2, 3}, image.Point{1, 2}},
+		{8, image.Point{2, 3}, image.Point{0, 2}},
+		{9, image.Point{3, 2}, image.Point{0, 0}},
+	}
+	for _, tt := range tests {
+		oriented := Orient(img, tt.orientation)
+		if got := oriented.Bounds().Size(); got != tt.size {
+			t.Errorf("orientation %d: size = %v, want %v", tt.orientation, got, tt.size)
+			continue
+		}
+		if got := color.RGBAModel.Convert(oriented.At(tt.red.X, tt.red.Y)); got != red {
+			t.Errorf("orientation %d: pixel %v = %v, want red", tt.orientation, tt.red, got)
+		}
+	}
+}
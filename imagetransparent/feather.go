@@ -0,0 +1,71 @@
+package imagetransparent
+
+import (
+	"image"
+	"math"
+)
+
+// featherEdges softens the cutout edges: the alpha of the pixels closer than
+// radius+1 to a transparent pixel is scaled proportionally to that distance
+func featherEdges(img *image.RGBA, radius int) {
+	if radius <= 0 {
+		return
+	}
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	// two-pass chamfer distance transform to the nearest transparent pixel
+	const diagonal = math.Sqrt2
+	inf := float64(width + height)
+	dist := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if img.RGBAAt(bounds.Min.X+x, bounds.Min.Y+y).A != 0 {
+				dist[y*width+x] = inf
+			}
+		}
+	}
+	relax := func(x, y, nx, ny int, d float64) {
+		if nx < 0 || nx >= width || ny < 0 || ny >= height {
+			return
+		}
+		if nd := dist[ny*width+nx] + d; nd < dist[y*width+x] {
+			dist[y*width+x] = nd
+		}
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			relax(x, y, x-1, y, 1)
+			relax(x, y, x-1, y-1, diagonal)
+			relax(x, y, x, y-1, 1)
+			relax(x, y, x+1, y-1, diagonal)
+		}
+	}
+	for y := height - 1; y >= 0; y-- {
+		for x := width - 1; x >= 0; x-- {
+			relax(x, y, x+1, y, 1)
+			relax(x, y, x+1, y+1, diagonal)
+			relax(x, y, x, y+1, 1)
+			relax(x, y, x-1, y+1, diagonal)
+		}
+	}
+
+	ramp := float64(radius + 1)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			d := dist[y*width+x]
+			if d == 0 || d >= ramp {
+				continue
+			}
+			// scale all the channels since the image is alpha-premultiplied
+			f := d / ramp
+			c := img.RGBAAt(bounds.Min.X+x, bounds.Min.Y+y)
+			c.R = uint8(float64(c.R) * f)
+			c.G = uint8(float64(c.G) * f)
+			c.B = uint8(float64(c.B) * f)
+			c.A = uint8(float64(c.A) * f)
+			img.SetRGBA(bounds.Min.X+x, bounds.Min.Y+y, c)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// fillBackground composites img over the color c (made opaque), so that its
+// transparent pixels get that color and the semi-transparent ones (e.g. the
+// feathered edges) are blended with it
+func fillBackground(img *image.RGBA, c color.RGBA) {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			p := img.RGBAAt(x, y)
+			if p.A == 255 {
+				continue
+			}
+			// the pixels made transparent keep their color channels, so they
+			// can't be composited as alpha-premultiplied ones
+			if p.A == 0 {
+				img.SetRGBA(x, y, color.RGBA{R: c.R, G: c.G, B: c.B, A: 255})
+				continue
+			}
+			rest := uint32(255 - p.A)
+			img.SetRGBA(x, y, color.RGBA{
+				R: p.R + uint8(uint32(c.R)*rest/255),
+				G: p.G + uint8(uint32(c.G)*rest/255),
+				B: p.B + uint8(uint32(c.B)*rest/255),
+				A: 255,
+			})
+		}
+	}
+}
+
+// fadeBackground raises the alpha of the pixels of img made (partially, when
+// feathered) transparent to alpha, instead of fully removing them: the removed
+// part of their original alpha (from original, which img is a processed copy
+// of) is scaled from [0, original] to [alpha, original]
+func fadeBackground(img *image.RGBA, original image.Image, alpha uint8) {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			o := straightColor(original.At(x, y))
+			a := img.RGBAAt(x, y).A
+			if a >= o.A || alpha == 0 {
+				continue
+			}
+			floor := alpha
+			if floor > o.A {
+				floor = o.A
+			}
+			newA := uint32(floor) + uint32(a)*uint32(o.A-floor)/uint32(o.A)
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(uint32(o.R) * newA / 255),
+				G: uint8(uint32(o.G) * newA / 255),
+				B: uint8(uint32(o.B) * newA / 255),
+				A: uint8(newA),
+			})
+		}
+	}
+}
+
+// filledPaletted returns a copy of frame with the pixels of imageRGBA, which
+// has its background filled with the color c, mapped to the palette of the
+// frame; c is added to the palette if it has room for it
+func filledPaletted(frame *image.Paletted, imageRGBA *image.RGBA, c color.RGBA) *image.Paletted {
+	c.A = 255
+	palette := make(color.Palette, len(frame.Palette), len(frame.Palette)+1)
+	copy(palette, frame.Palette)
+	if palette[palette.Index(c)] != color.Color(c) && len(palette) < 256 {
+		palette = append(palette, c)
+	}
+	result := image.NewPaletted(frame.Bounds(), palette)
+	draw.Draw(result, result.Bounds(), imageRGBA, result.Bounds().Min, draw.Src)
+	return result
+}
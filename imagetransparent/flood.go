@@ -0,0 +1,71 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+)
+
+// floodFillTransparent makes transparent the background pixels (see
+// Options.backgroundMatcher) which are reachable (4-connected) from the
+// background pixels on the image edges or, if there are any, from the seeds
+// (already transparent pixels are considered background too); returns the
+// number of pixels it made transparent and the number of pixels it compared
+// with the background
+func floodFillTransparent(img *image.RGBA, isBackground func(x, y int, c *color.RGBA) bool, seeds []image.Point) (int, int) {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+	visited := make([]bool, width*height)
+	queue := make([]image.Point, 0, 2*(width+height))
+
+	examined := 0
+	push := func(x, y int) {
+		if x < bounds.Min.X || x >= bounds.Max.X || y < bounds.Min.Y || y >= bounds.Max.Y {
+			return
+		}
+		i := (y-bounds.Min.Y)*width + (x - bounds.Min.X)
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		c := straightRGBAAt(img, x, y)
+		if c.A == 0 {
+			queue = append(queue, image.Point{x, y})
+			return
+		}
+		examined++
+		if isBackground(x, y, &c) {
+			queue = append(queue, image.Point{x, y})
+		}
+	}
+
+	for _, p := range seeds {
+		push(p.X, p.Y)
+	}
+	if len(seeds) == 0 {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			push(x, bounds.Min.Y)
+			push(x, bounds.Max.Y-1)
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			push(bounds.Min.X, y)
+			push(bounds.Max.X-1, y)
+		}
+	}
+
+	changed := 0
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if c := img.RGBAAt(p.X, p.Y); c.A != 0 {
+			c.A = 0
+			img.SetRGBA(p.X, p.Y, c)
+			changed++
+		}
+		push(p.X+1, p.Y)
+		push(p.X-1, p.Y)
+		push(p.X, p.Y+1)
+		push(p.X, p.Y-1)
+	}
+	return changed, examined
+}
@@ -0,0 +1,298 @@
+package imagetransparent
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"sort"
+)
+
+// MakeTransparentGIF makes the background of every frame of the (animated) GIF
+// transparent, in place, keeping the frame timings and the loop count. The
+// background colors are the same for all the frames: opts.BackgroundColors or,
+// if there are none, the one detected from the first frame (if it is transparent,
+// ErrAlreadyTransparent is returned). The removed background
+// pixels are mapped to a transparent palette entry, since GIF has no alpha.
+// Returns the number of pixels made transparent in all the frames.
+func MakeTransparentGIF(g *gif.GIF, opts Options) (int, error) {
+	if len(g.Image) == 0 {
+		return 0, ErrNotConverted
+	}
+	if len(opts.BackgroundColors) == 0 && opts.BackgroundMode != BackgroundModes.Gradient && opts.ChromaKey == nil {
+		detected, _ := DetectBackgroundColor(g.Image[0], opts)
+		if detected.A == 0 {
+			return 0, ErrAlreadyTransparent
+		}
+		opts.BackgroundColors = []color.RGBA{detected}
+	}
+
+	total := 0
+	for i, frame := range g.Image {
+		result, changed, err := MakeTransparentPaletted(frame, opts)
+		if errors.Is(err, ErrNotConverted) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error when processing frame %d: %w", i, err)
+		}
+		total += changed
+		g.Image[i] = result
+		// without disposal the previous frames would show through the now
+		// transparent background; frames covering only part of the canvas are
+		// left alone as they rely on the previous frames being kept
+		if opts.ReplaceWith == nil && frame.Bounds() == g.Image[0].Bounds() && i < len(g.Disposal) {
+			g.Disposal[i] = gif.DisposalBackground
+		}
+	}
+	if total == 0 {
+		return 0, ErrNotConverted
+	}
+	return total, nil
+}
+
+// transparentPaletted returns a copy of frame in which the pixels made
+// transparent in imageRGBA use a transparent palette entry; the other pixels
+// keep their original palette index
+func transparentPaletted(frame *image.Paletted, imageRGBA *image.RGBA) *image.Paletted {
+	bounds := frame.Bounds()
+	palette := make(color.Palette, len(frame.Palette))
+	copy(palette, frame.Palette)
+	result := image.NewPaletted(bounds, palette)
+	copy(result.Pix, frame.Pix)
+
+	transparent := func(x, y int) bool {
+		return imageRGBA.RGBAAt(x, y).A < 128
+	}
+	transparentIndex := transparentPaletteIndex(result, transparent)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if transparent(x, y) {
+				result.SetColorIndex(x, y, transparentIndex)
+			}
+		}
+	}
+	return result
+}
+
+// transparentPaletteIndex returns the index of a transparent entry of the
+// palette of img, adding it if needed. If the palette is full, the entry least
+// used by the pixels which stay opaque is turned transparent and those pixels
+// are remapped to the closest remaining color.
+func transparentPaletteIndex(img *image.Paletted, transparent func(x, y int) bool) uint8 {
+	for i, c := range img.Palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return uint8(i)
+		}
+	}
+	if len(img.Palette) < 256 {
+		img.Palette = append(img.Palette, color.RGBA{})
+		return uint8(len(img.Palette) - 1)
+	}
+
+	bounds := img.Bounds()
+	var usage [256]int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if !transparent(x, y) {
+				usage[img.ColorIndexAt(x, y)]++
+			}
+		}
+	}
+	leastUsed := 0
+	for i := range usage {
+		if usage[i] < usage[leastUsed] {
+			leastUsed = i
+		}
+	}
+
+	if usage[leastUsed] > 0 {
+		others := make(color.Palette, 0, len(img.Palette)-1)
+		indexes := make([]uint8, 0, len(img.Palette)-1)
+		for i, c := range img.Palette {
+			if i != leastUsed {
+				others = append(others, c)
+				indexes = append(indexes, uint8(i))
+			}
+		}
+		replacement := indexes[others.Index(img.Palette[leastUsed])]
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if !transparent(x, y) && img.ColorIndexAt(x, y) == uint8(leastUsed) {
+					img.SetColorIndex(x, y, replacement)
+				}
+			}
+		}
+	}
+	img.Palette[leastUsed] = color.RGBA{}
+	return uint8(leastUsed)
+}
+
+// encodeGIF writes img to w as a GIF of up to opts.GIFNumColors colors,
+// quantized and drawn with opts.GIFQuantizer and opts.GIFDrawer. Unlike with
+// gif.Encode, whose palettes have no transparent entry, the pixels whose alpha
+// is below 128 stay transparent: a palette entry is reserved for them. Paletted
+// images which have few enough colors keep their palette.
+func encodeGIF(w io.Writer, img image.Image, opts EncodeOptions) error {
+	numColors := opts.GIFNumColors
+	if numColors == 0 {
+		numColors = 256
+	}
+	if numColors < 1 || numColors > 256 {
+		return fmt.Errorf("GIF number of colors has to be between 1 and 256 - got %d", numColors)
+	}
+	if paletted, ok := img.(*image.Paletted); ok && len(paletted.Palette) <= numColors {
+		return gif.Encode(w, paletted, nil)
+	}
+
+	// the colors the transparent pixels had before being made transparent are
+	// drawn too, so that their alpha doesn't spread into the kept ones
+	bounds := img.Bounds()
+	opaque := image.NewRGBA(bounds)
+	transparent := false
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := straightColor(img.At(x, y))
+			transparent = transparent || c.A < 128
+			c.A = 255
+			opaque.SetRGBA(x, y, c)
+		}
+	}
+	n := numColors
+	if transparent && n > 1 {
+		n--
+	}
+	var colors color.Palette
+	if opts.GIFQuantizer != nil {
+		colors = opts.GIFQuantizer.Quantize(make(color.Palette, 0, n), img)
+	} else {
+		colors = append(make(color.Palette, 0, n+1), palette.Plan9[:n]...)
+	}
+	if len(colors) == 0 {
+		// e.g. all the pixels are transparent
+		colors = append(colors, color.RGBA{A: 255})
+	}
+	drawer := opts.GIFDrawer
+	if drawer == nil {
+		drawer = draw.FloydSteinberg
+	}
+	paletted := image.NewPaletted(bounds, colors)
+	drawer.Draw(paletted, bounds, opaque, bounds.Min)
+	if transparent {
+		paletted.Palette = append(paletted.Palette, color.RGBA{})
+		transparentIndex := uint8(len(paletted.Palette) - 1)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if _, _, _, a := img.At(x, y).RGBA(); a < 0x8000 {
+					paletted.SetColorIndex(x, y, transparentIndex)
+				}
+			}
+		}
+	}
+	return gif.Encode(w, paletted, nil)
+}
+
+// MedianCutQuantizer is a draw.Quantizer building a palette adapted to the
+// colors of the image, e.g. for GIFs of few colors (see
+// EncodeOptions.GIFQuantizer): the box of the colors of the pixels which aren't
+// transparent is split at the median of its widest channel, and so on for the
+// widest of the resulting boxes, until there are as many boxes as palette
+// entries; each entry is the average color of a box
+type MedianCutQuantizer struct{}
+
+// Quantize appends up to cap(p) - len(p) colors to p, adapted to m
+func (MedianCutQuantizer) Quantize(p color.Palette, m image.Image) color.Palette {
+	n := cap(p) - len(p)
+	if n <= 0 {
+		return p
+	}
+	// the colors are counted with 5 bits per channel
+	type bucket struct {
+		count, r, g, b int
+	}
+	buckets := make([]bucket, 1<<15)
+	bounds := m.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := straightColor(m.At(x, y))
+			if c.A < 128 {
+				continue
+			}
+			bk := &buckets[int(c.R>>3)<<10|int(c.G>>3)<<5|int(c.B>>3)]
+			bk.count++
+			bk.r += int(c.R)
+			bk.g += int(c.G)
+			bk.b += int(c.B)
+		}
+	}
+	var used []int
+	for i := range buckets {
+		if buckets[i].count > 0 {
+			used = append(used, i)
+		}
+	}
+	if len(used) == 0 {
+		return p
+	}
+	// channel returns the red (0), green (1) or blue (2) channel of the bucket i
+	channel := func(i, ch int) int {
+		return i >> (10 - 5*ch) & 31
+	}
+
+	boxes := [][]int{used}
+	for len(boxes) < n {
+		best, bestChannel, bestRange := -1, 0, 0
+		for bi, box := range boxes {
+			for ch := 0; ch < 3; ch++ {
+				lo, hi := 31, 0
+				for _, i := range box {
+					v := channel(i, ch)
+					if v < lo {
+						lo = v
+					}
+					if v > hi {
+						hi = v
+					}
+				}
+				if hi-lo > bestRange {
+					best, bestChannel, bestRange = bi, ch, hi-lo
+				}
+			}
+		}
+		if best < 0 {
+			// every box holds a single bucket
+			break
+		}
+		box := boxes[best]
+		sort.Slice(box, func(a, b int) bool { return channel(box[a], bestChannel) < channel(box[b], bestChannel) })
+		total := 0
+		for _, i := range box {
+			total += buckets[i].count
+		}
+		// the first box gets the buckets up to the median pixel, leaving at
+		// least one for the second
+		split, half := 1, buckets[box[0]].count
+		for split < len(box)-1 && 2*half < total {
+			half += buckets[box[split]].count
+			split++
+		}
+		boxes[best] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	for _, box := range boxes {
+		var sum bucket
+		for _, i := range box {
+			sum.count += buckets[i].count
+			sum.r += buckets[i].r
+			sum.g += buckets[i].g
+			sum.b += buckets[i].b
+		}
+		p = append(p, color.RGBA{R: uint8(sum.r / sum.count), G: uint8(sum.g / sum.count), B: uint8(sum.b / sum.count), A: 255})
+	}
+	return p
+}
@@ -0,0 +1,116 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestMakeTransparentGIFMultiFrame(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	red := color.RGBA{R: 255, A: 255}
+	palette := color.Palette{white, red}
+
+	// two frames: a white background with a red square moving to the right
+	src := &gif.GIF{LoopCount: 3}
+	for i := 0; i < 2; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 8, 8), palette)
+		for y := 3; y < 5; y++ {
+			for x := 1 + 3*i; x < 3+3*i; x++ {
+				frame.SetColorIndex(x, y, 1)
+			}
+		}
+		src.Image = append(src.Image, frame)
+		src.Delay = append(src.Delay, 10*(i+1))
+		src.Disposal = append(src.Disposal, gif.DisposalNone)
+	}
+	var buff bytes.Buffer
+	if err := gif.EncodeAll(&buff, src); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(&buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := MakeTransparentGIF(g, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 2*(64-4) {
+		t.Errorf("changed %d pixels, want %d", changed, 2*(64-4))
+	}
+
+	if len(g.Image) != 2 {
+		t.Fatalf("got %d frames, want 2", len(g.Image))
+	}
+	if g.LoopCount != 3 {
+		t.Errorf("loop count = %d, want 3", g.LoopCount)
+	}
+	for i, frame := range g.Image {
+		if g.Delay[i] != 10*(i+1) {
+			t.Errorf("frame %d delay = %d, want %d", i, g.Delay[i], 10*(i+1))
+		}
+		if _, _, _, a := frame.At(0, 0).RGBA(); a != 0 {
+			t.Errorf("frame %d background is not transparent", i)
+		}
+		if c := frame.At(1+3*i, 3); c != color.Color(red) {
+			t.Errorf("frame %d foreground = %v, want %v", i, c, red)
+		}
+	}
+
+	// the result has to survive a round-trip through the GIF encoder
+	buff.Reset()
+	if err := gif.EncodeAll(&buff, g); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeGIF(t *testing.T) {
+	transparent, err := MakeTransparent(newTestImage(8), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []EncodeOptions{{}, {GIFNumColors: 2, GIFQuantizer: MedianCutQuantizer{}}} {
+		var buff bytes.Buffer
+		if err := EncodeImageWithOptions(&buff, transparent, ImageTypes.GIF, opts); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := gif.Decode(&buff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paletted := decoded.(*image.Paletted)
+		if opts.GIFNumColors > 0 && len(paletted.Palette) > opts.GIFNumColors {
+			t.Errorf("%d colors: palette of %d colors", opts.GIFNumColors, len(paletted.Palette))
+		}
+		if _, _, _, a := paletted.At(0, 0).RGBA(); a != 0 {
+			t.Errorf("%d colors: background alpha = %d, want 0", opts.GIFNumColors, a)
+		}
+		if c := color.RGBAModel.Convert(paletted.At(4, 4)); c != (color.RGBA{R: 255, A: 255}) {
+			t.Errorf("%d colors: foreground = %v, want red", opts.GIFNumColors, c)
+		}
+	}
+}
+
+func TestMedianCutQuantizer(t *testing.T) {
+	// two reds, two blues and a transparent pixel, which is ignored
+	img := image.NewNRGBA(image.Rect(0, 0, 5, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 250, A: 255})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 240, A: 255})
+	img.SetNRGBA(2, 0, color.NRGBA{B: 250, A: 255})
+	img.SetNRGBA(3, 0, color.NRGBA{B: 240, A: 255})
+	img.SetNRGBA(4, 0, color.NRGBA{G: 255})
+
+	p := MedianCutQuantizer{}.Quantize(make(color.Palette, 0, 2), img)
+	if len(p) != 2 {
+		t.Fatalf("palette of %d colors, want 2", len(p))
+	}
+	for _, want := range []color.RGBA{{R: 245, A: 255}, {B: 245, A: 255}} {
+		if c := color.RGBAModel.Convert(p.Convert(want)); c != want {
+			t.Errorf("palette color closest to %v = %v, want it in the palette", want, c)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+)
+
+// gradientPatchSize is the size of the square patch of pixels averaged in each
+// corner by DetectGradientCorners, so that noise doesn't skew the gradient
+const gradientPatchSize = 3
+
+// DetectGradientCorners returns the background colors at the top-left,
+// top-right, bottom-left and bottom-right corners of img (in this order), used
+// by BackgroundModes.Gradient; each is the average of the pixels of a small
+// patch in that corner which aren't transparent. The corners whose patch is
+// all transparent get the average of the other ones, unless all of them are
+// transparent (the background was already removed).
+func DetectGradientCorners(img image.Image) [4]color.RGBA {
+	bounds := img.Bounds()
+	patch := func(x0, y0, dx, dy int) color.RGBA {
+		var r, g, b, a, n int
+		for j := 0; j < gradientPatchSize; j++ {
+			for i := 0; i < gradientPatchSize; i++ {
+				p := image.Point{x0 + i*dx, y0 + j*dy}
+				if !p.In(bounds) {
+					continue
+				}
+				c := straightColor(img.At(p.X, p.Y))
+				if c.A == 0 {
+					continue
+				}
+				r += int(c.R)
+				g += int(c.G)
+				b += int(c.B)
+				a += int(c.A)
+				n++
+			}
+		}
+		if n == 0 {
+			return color.RGBA{}
+		}
+		return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)}
+	}
+	maxX, maxY := bounds.Max.X-1, bounds.Max.Y-1
+	corners := [4]color.RGBA{
+		patch(bounds.Min.X, bounds.Min.Y, 1, 1),
+		patch(maxX, bounds.Min.Y, -1, 1),
+		patch(bounds.Min.X, maxY, 1, -1),
+		patch(maxX, maxY, -1, -1),
+	}
+	var r, g, b, a, n int
+	for _, c := range corners {
+		if c.A != 0 {
+			r += int(c.R)
+			g += int(c.G)
+			b += int(c.B)
+			a += int(c.A)
+			n++
+		}
+	}
+	if n == 0 || n == len(corners) {
+		return corners
+	}
+	for i := range corners {
+		if corners[i].A == 0 {
+			corners[i] = color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)}
+		}
+	}
+	return corners
+}
+
+// gradientColor returns the background color at (x, y) of an image with the
+// given bounds, interpolated bilinearly between the corner colors
+func gradientColor(corners *[4]color.RGBA, bounds image.Rectangle, x, y int) color.RGBA {
+	var fx, fy float64
+	if bounds.Dx() > 1 {
+		fx = float64(x-bounds.Min.X) / float64(bounds.Dx()-1)
+	}
+	if bounds.Dy() > 1 {
+		fy = float64(y-bounds.Min.Y) / float64(bounds.Dy()-1)
+	}
+	lerp := func(tl, tr, bl, br uint8) uint8 {
+		top := float64(tl) + (float64(tr)-float64(tl))*fx
+		bottom := float64(bl) + (float64(br)-float64(bl))*fx
+		return uint8(top + (bottom-top)*fy + 0.5)
+	}
+	tl, tr, bl, br := &corners[0], &corners[1], &corners[2], &corners[3]
+	return color.RGBA{
+		R: lerp(tl.R, tr.R, bl.R, br.R),
+		G: lerp(tl.G, tr.G, bl.G, br.G),
+		B: lerp(tl.B, tr.B, bl.B, br.B),
+		A: 255,
+	}
+}
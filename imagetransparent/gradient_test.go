@@ -0,0 +1,45 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestMakeTransparentGradientBackground(t *testing.T) {
+	// a gray background going from light at the top to dark at the bottom, with
+	// a red square in the center
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		gray := uint8(250 - 8*y)
+		for x := 0; x < 16; x++ {
+			if x >= 6 && x < 10 && y >= 6 && y < 10 {
+				img.SetRGBA(x, y, color.RGBA{R: 200, G: 40, B: 40, A: 255})
+			} else {
+				img.SetRGBA(x, y, color.RGBA{R: gray, G: gray, B: gray, A: 255})
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.Tolerance, opts.UniformTolerance = 20, 20
+	result, _, err := MakeTransparentCount(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := result.RGBAAt(8, 15).A; a == 0 {
+		t.Error("with corners detection the bottom of the gradient is transparent, want opaque")
+	}
+
+	opts.BackgroundMode = BackgroundModes.Gradient
+	result, changed, err := MakeTransparentCount(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 256-16 {
+		t.Errorf("changed %d pixels, want %d", changed, 256-16)
+	}
+	if a := result.RGBAAt(8, 8).A; a != 255 {
+		t.Errorf("foreground alpha = %d, want 255", a)
+	}
+}
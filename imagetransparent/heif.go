@@ -0,0 +1,16 @@
+//go:build heif
+
+package imagetransparent
+
+import (
+	"github.com/gen2brain/avif"
+	"github.com/gen2brain/heic"
+)
+
+// the AVIF and HEIC decoders are pure Go (libavif and libheif compiled to
+// WebAssembly) but make the binary much larger, hence only built with the heif
+// tag
+func init() {
+	decoders[ImageTypes.AVIF] = decoder{avif.Decode, avif.DecodeConfig}
+	decoders[ImageTypes.HEIC] = decoder{heic.Decode, heic.DecodeConfig}
+}
@@ -0,0 +1,307 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// icoHeader is the magic of ICO files: a reserved 0 and the type 1 (icon)
+const icoHeader = "\x00\x00\x01\x00"
+
+// icoMaxSize is the max width and height of the images of an ICO file
+const icoMaxSize = 256
+
+func init() {
+	image.RegisterFormat(string(ImageTypes.ICO), icoHeader, DecodeICO, DecodeICOConfig)
+}
+
+// icoEntry is an entry of the directory of an ICO file
+type icoEntry struct {
+	width, height int
+	bitCount      int
+	size, offset  uint32
+}
+
+// readICODirectory returns the largest image of the ICO file data (the one with
+// the most bits per pixel, among the equally large ones)
+func readICODirectory(data []byte) (icoEntry, error) {
+	if len(data) < 6 || string(data[:4]) != icoHeader {
+		return icoEntry{}, errors.New("ico: invalid header")
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:6]))
+	if count == 0 || len(data) < 6+16*count {
+		return icoEntry{}, errors.New("ico: invalid directory")
+	}
+	var best icoEntry
+	for i := 0; i < count; i++ {
+		e := data[6+16*i : 6+16*(i+1)]
+		entry := icoEntry{
+			width:    int(e[0]),
+			height:   int(e[1]),
+			bitCount: int(binary.LittleEndian.Uint16(e[6:8])),
+			size:     binary.LittleEndian.Uint32(e[8:12]),
+			offset:   binary.LittleEndian.Uint32(e[12:16]),
+		}
+		// 0 means 256
+		if entry.width == 0 {
+			entry.width = icoMaxSize
+		}
+		if entry.height == 0 {
+			entry.height = icoMaxSize
+		}
+		area, bestArea := entry.width*entry.height, best.width*best.height
+		if area > bestArea || (area == bestArea && entry.bitCount > best.bitCount) {
+			best = entry
+		}
+	}
+	if uint64(best.offset)+uint64(best.size) > uint64(len(data)) {
+		return icoEntry{}, errors.New("ico: image data out of bounds")
+	}
+	return best, nil
+}
+
+// isICOPNG reports whether the image data of an ICO file entry is PNG encoded
+func isICOPNG(imageData []byte) bool {
+	return bytes.HasPrefix(imageData, []byte("\x89PNG\r\n\x1a\n"))
+}
+
+// icoPNGConfig returns the config of a PNG encoded image of an ICO file, from
+// its header; the ones larger than the ICO max size are rejected, so that the
+// directory entry can't hide the size of what is decoded
+func icoPNGConfig(imageData []byte) (image.Config, error) {
+	config, err := png.DecodeConfig(bytes.NewReader(imageData))
+	if err != nil {
+		return image.Config{}, err
+	}
+	if config.Width > icoMaxSize || config.Height > icoMaxSize {
+		return image.Config{}, fmt.Errorf("ico: %dx%d PNG image larger than %dx%d", config.Width, config.Height, icoMaxSize, icoMaxSize)
+	}
+	return config, nil
+}
+
+// DecodeICO decodes the largest image of an ICO (Windows icon) file; both the
+// PNG and the BMP encoded images are supported
+func DecodeICO(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := readICODirectory(data)
+	if err != nil {
+		return nil, err
+	}
+	imageData := data[entry.offset : entry.offset+entry.size]
+	if isICOPNG(imageData) {
+		if _, err := icoPNGConfig(imageData); err != nil {
+			return nil, err
+		}
+		return png.Decode(bytes.NewReader(imageData))
+	}
+	return decodeICODIB(imageData)
+}
+
+// DecodeICOConfig returns the dimensions of the largest image of an ICO file:
+// the ones in the header of PNG encoded images, else the ones of the directory
+func DecodeICOConfig(r io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	entry, err := readICODirectory(data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if imageData := data[entry.offset : entry.offset+entry.size]; isICOPNG(imageData) {
+		return icoPNGConfig(imageData)
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: entry.width, Height: entry.height}, nil
+}
+
+// decodeICODIB decodes a BMP encoded image of an ICO file: a BITMAPINFOHEADER
+// (with the height doubled), the palette, the bottom-up color rows and the
+// 1 bit per pixel transparency (AND) mask rows
+func decodeICODIB(data []byte) (image.Image, error) {
+	if len(data) < 40 {
+		return nil, errors.New("ico: invalid bitmap header")
+	}
+	headerSize := binary.LittleEndian.Uint32(data[0:4])
+	width := int(int32(binary.LittleEndian.Uint32(data[4:8])))
+	height := int(int32(binary.LittleEndian.Uint32(data[8:12]))) / 2
+	bitCount := int(binary.LittleEndian.Uint16(data[14:16]))
+	compression := binary.LittleEndian.Uint32(data[16:20])
+	colorsUsed := int(binary.LittleEndian.Uint32(data[32:36]))
+	if width <= 0 || height <= 0 || width > icoMaxSize || height > icoMaxSize || headerSize < 40 || uint64(headerSize) > uint64(len(data)) {
+		return nil, errors.New("ico: invalid bitmap header")
+	}
+	// BI_RGB, or BI_BITFIELDS with the default masks for 32 bits per pixel
+	if compression != 0 && !(compression == 3 && bitCount == 32) {
+		return nil, fmt.Errorf("ico: unsupported bitmap compression %d", compression)
+	}
+
+	var palette []color.NRGBA
+	switch bitCount {
+	case 1, 4, 8:
+		if colorsUsed == 0 || colorsUsed > 1<<bitCount {
+			colorsUsed = 1 << bitCount
+		}
+		palette = make([]color.NRGBA, colorsUsed)
+	case 24, 32:
+	default:
+		return nil, fmt.Errorf("ico: unsupported %d bits per pixel", bitCount)
+	}
+	p := data[headerSize:]
+	if len(p) < 4*len(palette) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	for i := range palette {
+		palette[i] = color.NRGBA{R: p[4*i+2], G: p[4*i+1], B: p[4*i], A: 255}
+	}
+	p = p[4*len(palette):]
+
+	stride := (width*bitCount + 31) / 32 * 4
+	maskStride := (width + 31) / 32 * 4
+	if len(p) < stride*height {
+		return nil, io.ErrUnexpectedEOF
+	}
+	mask := p[stride*height:]
+	hasMask := len(mask) >= maskStride*height
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		row := p[(height-1-y)*stride:]
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+			switch bitCount {
+			case 24:
+				c = color.NRGBA{R: row[3*x+2], G: row[3*x+1], B: row[3*x], A: 255}
+			case 32:
+				c = color.NRGBA{R: row[4*x+2], G: row[4*x+1], B: row[4*x], A: row[4*x+3]}
+				hasAlpha = hasAlpha || c.A != 0
+			default:
+				bit := x * bitCount
+				index := int(row[bit/8]>>(8-bitCount-bit%8)) & (1<<bitCount - 1)
+				if index < len(palette) {
+					c = palette[index]
+				}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	// the 32 bits per pixel images have an alpha channel, but old ones may leave
+	// it empty and use the mask instead
+	if bitCount == 32 && hasAlpha {
+		return img, nil
+	}
+	for y := 0; y < height; y++ {
+		var row []byte
+		if hasMask {
+			row = mask[(height-1-y)*maskStride:]
+		}
+		for x := 0; x < width; x++ {
+			transparent := hasMask && row[x/8]&(0x80>>(x%8)) != 0
+			c := img.NRGBAAt(x, y)
+			c.A = 255
+			if transparent {
+				c.A = 0
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img, nil
+}
+
+// EncodeICO writes img to w as an ICO (Windows icon) file, e.g. a favicon,
+// having an image of each of the given sizes (1-256 pixels): img is scaled to
+// fit in a size x size square, keeping its aspect ratio, and centered in it. If
+// there are no sizes, the ICO has a single image of the size of img (scaled down
+// to fit in 256 x 256 if larger). The images are stored as PNGs.
+func EncodeICO(w io.Writer, img image.Image, sizes []int) error {
+	var images []image.Image
+	if len(sizes) == 0 {
+		bounds := img.Bounds()
+		if bounds.Dx() <= icoMaxSize && bounds.Dy() <= icoMaxSize {
+			images = append(images, img)
+		} else {
+			images = append(images, fitICO(img, icoMaxSize, false))
+		}
+	}
+	for _, size := range sizes {
+		if size < 1 || size > icoMaxSize {
+			return fmt.Errorf("ico: image size has to be between 1 and %d - got %d", icoMaxSize, size)
+		}
+		images = append(images, fitICO(img, size, true))
+	}
+
+	encoded := make([][]byte, len(images))
+	for i, icon := range images {
+		var buff bytes.Buffer
+		if err := png.Encode(&buff, icon); err != nil {
+			return err
+		}
+		encoded[i] = buff.Bytes()
+	}
+
+	header := make([]byte, 6+16*len(images))
+	copy(header, icoHeader)
+	binary.LittleEndian.PutUint16(header[4:6], uint16(len(images)))
+	offset := len(header)
+	for i, icon := range images {
+		e := header[6+16*i : 6+16*(i+1)]
+		// 256 is stored as 0
+		e[0] = uint8(icon.Bounds().Dx())
+		e[1] = uint8(icon.Bounds().Dy())
+		binary.LittleEndian.PutUint16(e[4:6], 1)
+		binary.LittleEndian.PutUint16(e[6:8], 32)
+		binary.LittleEndian.PutUint32(e[8:12], uint32(len(encoded[i])))
+		binary.LittleEndian.PutUint32(e[12:16], uint32(offset))
+		offset += len(encoded[i])
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for _, data := range encoded {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fitICO scales img down (or up) to fit in a size x size square, keeping its
+// aspect ratio; if square is set, the result is that square, with img centered
+// in it and transparent margins
+func fitICO(img image.Image, size int, square bool) image.Image {
+	bounds := img.Bounds()
+	w, h := size, size
+	if bounds.Dx() > bounds.Dy() {
+		h = bounds.Dy() * size / bounds.Dx()
+	} else {
+		w = bounds.Dx() * size / bounds.Dy()
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	rect := image.Rect(0, 0, w, h)
+	if square {
+		rect = image.Rect((size-w)/2, (size-h)/2, (size-w)/2+w, (size-h)/2+h)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	if !square {
+		dst = image.NewRGBA(rect)
+	}
+	xdraw.CatmullRom.Scale(dst, rect, img, bounds, xdraw.Src, nil)
+	return dst
+}
@@ -0,0 +1,106 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestICORoundTrip(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for x := 0; x < 32; x++ {
+		for y := 0; y < 32; y++ {
+			img.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	var buff bytes.Buffer
+	if err := EncodeICO(&buff, img, []int{16, 32}); err != nil {
+		t.Fatal(err)
+	}
+	if got := SniffImageType(buff.Bytes()); got != ImageTypes.ICO {
+		t.Errorf("SniffImageType = %s, want %s", got, ImageTypes.ICO)
+	}
+	// the largest image is decoded
+	decoded, err := DecodeImage(buff.Bytes(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bounds() != image.Rect(0, 0, 32, 32) {
+		t.Fatalf("bounds = %v, want 32x32", decoded.Bounds())
+	}
+	// the 64x32 image is scaled to 32x16 and centered vertically
+	for _, tt := range []struct {
+		x, y  int
+		wantA uint32
+	}{{0, 0, 0}, {4, 12, 0xffff}, {28, 12, 0}, {4, 28, 0}} {
+		if _, _, _, a := decoded.At(tt.x, tt.y).RGBA(); a != tt.wantA {
+			t.Errorf("alpha at (%d, %d) = %d, want %d", tt.x, tt.y, a, tt.wantA)
+		}
+	}
+}
+
+func TestDecodeICOBitmap(t *testing.T) {
+	// a 2x2 24 bits per pixel bitmap, whose top-right pixel is transparent
+	dib := make([]byte, 40)
+	binary.LittleEndian.PutUint32(dib[0:4], 40)
+	binary.LittleEndian.PutUint32(dib[4:8], 2)
+	binary.LittleEndian.PutUint32(dib[8:12], 4)
+	binary.LittleEndian.PutUint16(dib[12:14], 1)
+	binary.LittleEndian.PutUint16(dib[14:16], 24)
+	// the bottom-up BGR rows, padded to 4 bytes: blue and white, then red and green
+	dib = append(dib, 255, 0, 0, 255, 255, 255, 0, 0)
+	dib = append(dib, 0, 0, 255, 0, 255, 0, 0, 0)
+	// the bottom-up mask rows
+	dib = append(dib, 0, 0, 0, 0, 0x40, 0, 0, 0)
+
+	header := []byte(icoHeader + "\x01\x00")
+	entry := make([]byte, 16)
+	entry[0], entry[1] = 2, 2
+	binary.LittleEndian.PutUint32(entry[8:12], uint32(len(dib)))
+	binary.LittleEndian.PutUint32(entry[12:16], uint32(len(header)+len(entry)))
+	data := append(append(header, entry...), dib...)
+
+	decoded, err := DecodeICO(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []color.NRGBA{
+		{R: 255, A: 255}, {G: 255},
+		{B: 255, A: 255}, {R: 255, G: 255, B: 255, A: 255},
+	}
+	for i, w := range want {
+		if got := color.NRGBAModel.Convert(decoded.At(i%2, i/2)); got != w {
+			t.Errorf("pixel (%d, %d) = %v, want %v", i%2, i/2, got, w)
+		}
+	}
+}
+
+func TestDecodeICOOversizedPNG(t *testing.T) {
+	// an ICO whose 256x256 entry is a PNG claiming to be 60000x60000
+	ihdr := []byte("IHDR")
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 60000)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 60000)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0) // 8 bits RGBA
+	pngData := []byte("\x89PNG\r\n\x1a\n")
+	pngData = binary.BigEndian.AppendUint32(pngData, uint32(len(ihdr)-4))
+	pngData = append(pngData, ihdr...)
+	pngData = binary.BigEndian.AppendUint32(pngData, crc32.ChecksumIEEE(ihdr))
+	entry := []byte{0, 0, 0, 0, 1, 0, 32, 0}
+	entry = binary.LittleEndian.AppendUint32(entry, uint32(len(pngData)))
+	entry = binary.LittleEndian.AppendUint32(entry, 6+16)
+	data := append(append([]byte(icoHeader+"\x01\x00"), entry...), pngData...)
+
+	if _, err := DecodeICOConfig(bytes.NewReader(data)); err == nil {
+		t.Error("DecodeICOConfig of an oversized PNG returned no error")
+	}
+	if _, err := DecodeICO(bytes.NewReader(data)); err == nil {
+		t.Error("DecodeICO of an oversized PNG returned no error")
+	}
+	if _, err := DecodeImage(data, DefaultMaxPixels); err == nil {
+		t.Error("DecodeImage of an ICO with an oversized PNG returned no error")
+	}
+}
@@ -0,0 +1,492 @@
+// Package imagetransparent makes the background of images transparent: it
+// detects (or is given) the background color and clears the alpha of all the
+// pixels having that color, within some tolerance.
+package imagetransparent
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Mode ...
+type Mode string
+
+// Modes of background removal
+var Modes = struct {
+	Global Mode
+	Flood  Mode
+}{
+	Global: "global",
+	Flood:  "flood",
+}
+
+// Matcher reports whether the pixel color matches the reference background
+// color, see Options.Matcher
+type Matcher func(pixel, reference color.RGBA) bool
+
+// MatcherAt reports whether the color of the pixel at (x, y) matches the
+// reference background color, see Options.MatcherAt
+type MatcherAt func(x, y int, pixel, reference color.RGBA) bool
+
+// Options of the background removal
+type Options struct {
+	// Tolerance is the max difference (0-255) per color channel for a pixel to
+	// be considered background when using the RGB metric
+	Tolerance uint8
+	// UniformTolerance is used instead of Tolerance by the RGB metric when all
+	// the color channels differ by the same amount, i.e. for the pixels which are
+	// only lighter or darker than the background without a tint (e.g. the grays
+	// of a white background); by default it is lower than Tolerance, so fewer
+	// such pixels are removed
+	UniformTolerance uint8
+	// NoUniformTolerance disables UniformTolerance: Tolerance is used for all the
+	// pixels
+	NoUniformTolerance bool
+	// ChannelTolerances, if set, are the max differences of the red, green and
+	// blue channels used by the RGB metric instead of Tolerance, e.g. a larger
+	// blue one for a blue sky gradient; UniformTolerance still applies
+	ChannelTolerances *[3]uint8
+	// Matcher, if set, replaces the comparison of the colors by the Metric and
+	// the tolerances (including Exact), e.g. for perceptual or learned color
+	// distances: it reports whether the straight color of a pixel matches a
+	// background color. It isn't given the coordinates of the pixels, see
+	// MatcherAt for that. SoftEdges has no effect with it, as it needs the
+	// distance from the background.
+	Matcher Matcher
+	// MatcherAt is like Matcher, but also gets the coordinates of the pixel,
+	// e.g. to match differently in some regions of the image. It is used
+	// instead of Matcher when removing the background, but not when detecting
+	// its color (Matcher or the Metric are used for that).
+	MatcherAt MatcherAt
+	// gray is set when processing a grayscale image (see isGray), whose pixels
+	// are compared by their gray level (see sameColor)
+	gray bool
+	// Exact requires the RGB values of a pixel to be identical to the background
+	// ones; the tolerances (including UniformTolerance) and Metric are ignored
+	Exact bool
+	// Linear compares the colors in linear light instead of as sRGB encoded
+	// levels, with the RGB and Euclidean metrics, so that the tolerances apply to
+	// the differences of light: shades of dark backgrounds, which differ a lot
+	// more in sRGB levels, match as well as the ones of light backgrounds. Only
+	// the comparisons are affected, the pixels keep their colors.
+	Linear bool
+	// Metric used for comparing colors (default RGB)
+	Metric Metric
+	// HueTolerance is the max hue difference in degrees (0-180) for the HSV metric
+	HueTolerance float64
+	// SaturationTolerance is the max saturation difference (0-255) for the HSV metric
+	SaturationTolerance uint8
+	// ValueTolerance is the max value difference (0-255) for the HSV metric
+	ValueTolerance uint8
+	// BackgroundColors to make transparent - a pixel matching any of them is
+	// made transparent; if there are none, it is detected with DetectBackgroundColor
+	BackgroundColors []color.RGBA
+	// ProtectColors are never made transparent, even if they match the
+	// background, e.g. to keep white shirt buttons on a white background
+	ProtectColors []color.RGBA
+	// ProtectTolerance is the max difference (0-255) per color channel for a
+	// pixel to be considered one of the ProtectColors
+	ProtectTolerance uint8
+	// ChromaKey, if set, removes the pixels by their hue instead of by their
+	// distance to the background colors, which are neither used nor detected;
+	// the Metric and its tolerances are ignored
+	ChromaKey *ChromaKey
+	// BackgroundMode is how DetectBackgroundColor detects the background color
+	// (default Corners); it is only used if BackgroundColors is empty
+	BackgroundMode BackgroundMode
+	// SampleEdgeMidpoints makes DetectBackgroundColor also sample the midpoints
+	// of the image edges, not only its corners
+	SampleEdgeMidpoints bool
+	// BorderSample, if greater than 0, is the thickness in pixels of the band
+	// along the image edges whose most frequent color DetectBackgroundColor
+	// picks, so that the subject can't sway it; not used with Gradient
+	BorderSample int
+	// Mode in which the background is removed: Global makes transparent all the
+	// pixels matching the background color, while Flood only the ones connected
+	// to the image edges through matching pixels (default Global)
+	Mode Mode
+	// SeedPoint, if set, is the pixel (relative to the top-left corner of the
+	// image) the Flood mode fills the background from, instead of the image
+	// edges, e.g. for a background enclosed by the subject; its color is the
+	// background color detected by DetectBackgroundColor. It has to be within
+	// the image. Not used by the Global mode.
+	SeedPoint *image.Point
+	// Invert removes the pixels which don't match the background colors and keeps
+	// the matching ones, e.g. to isolate a flat colored region
+	Invert bool
+	// BackgroundAlpha is the alpha (0-255) the background pixels get, e.g. to
+	// fade the background instead of removing it (default 0, i.e. transparent)
+	BackgroundAlpha uint8
+	// ReplaceWith, if set, is the opaque color the background is replaced with,
+	// instead of being made transparent; pixels which were already transparent
+	// get it too
+	ReplaceWith *color.RGBA
+	// SoftEdges is the width (0-255, in the units of the tolerance of the
+	// Metric) of the band of colors beyond the tolerance which are made
+	// partially transparent, in proportion to how close they are to the
+	// background color, if they are connected to the removed background; it
+	// gives the cleanest edges when keying, e.g. green screens. 0 disables it,
+	// as does Invert.
+	SoftEdges uint8
+	// Despeckle is the size in pixels under which the islands of kept pixels
+	// left in the removed background are removed too, and the holes left in the
+	// subject are filled back, e.g. for noisy photographs; 0 disables it
+	Despeckle int
+	// MinBackgroundRegion is the size in pixels under which the connected areas
+	// of matching pixels are kept rather than removed, e.g. glints on the
+	// subject having the color of the background; 0 disables it
+	MinBackgroundRegion int
+	// KeepLargest, if greater than 0, is the number of the largest connected
+	// areas of kept pixels which are kept, all the others being made
+	// transparent too, e.g. to isolate a single product from the noise
+	// scattered around it
+	KeepLargest int
+	// FeatherRadius is the width in pixels of the band along the edges of the
+	// transparent areas in which the alpha is ramped up; 0 disables feathering
+	FeatherRadius int
+	// Workers is the number of goroutines the rows of an image are processed
+	// with (default runtime.NumCPU())
+	Workers int
+	// MaxPixels is the max number of pixels (width x height) of the images
+	// processed, guarding against decompression bombs exhausting the memory;
+	// 0 means no limit
+	MaxPixels int
+	// Progress, if set, is called with the number of rows processed so far and
+	// the total number of rows; it is called concurrently by the workers
+	Progress func(done, total int)
+}
+
+// DefaultOptions returns the Options used by the command line tool by default
+func DefaultOptions() Options {
+	return Options{
+		Tolerance:           110,
+		UniformTolerance:    100,
+		Metric:              Metrics.RGB,
+		HueTolerance:        20,
+		SaturationTolerance: 60,
+		ValueTolerance:      60,
+		ProtectTolerance:    10,
+		Mode:                Modes.Global,
+		BackgroundMode:      BackgroundModes.Corners,
+		Workers:             runtime.NumCPU(),
+		MaxPixels:           DefaultMaxPixels,
+	}
+}
+
+// ErrNotConverted is returned by MakeTransparent when no pixel was made transparent
+var ErrNotConverted = errors.New("image not converted - no pixel matched the background color, it was probably already transparent")
+
+// ErrAlreadyTransparent is returned by MakeTransparent when the detected
+// background color is transparent, i.e. the background was already removed; it
+// is an ErrNotConverted too (errors.Is reports true for both)
+var ErrAlreadyTransparent error = alreadyTransparentError{}
+
+type alreadyTransparentError struct{}
+
+func (alreadyTransparentError) Error() string {
+	return "image not converted - its background is already transparent"
+}
+
+func (alreadyTransparentError) Is(target error) bool {
+	return target == ErrNotConverted
+}
+
+// notConverted returns the error for an image in which no pixel was made
+// transparent: ErrAlreadyTransparent if its background (see Stats) is
+// transparent, otherwise ErrNotConverted
+func notConverted(stats Stats) error {
+	if len(stats.BackgroundColors) == 1 && stats.BackgroundColors[0].A == 0 {
+		return ErrAlreadyTransparent
+	}
+	return ErrNotConverted
+}
+
+// DefaultMaxPixels is the default Options.MaxPixels: 100 megapixels, which take
+// 400MB as an RGBA image
+const DefaultMaxPixels = 100_000_000
+
+// ErrTooLarge is returned by MakeTransparent when the image has more pixels than
+// Options.MaxPixels
+var ErrTooLarge = errors.New("image too large")
+
+// CheckSize returns an error wrapping ErrTooLarge if a width x height image has
+// more than maxPixels pixels (0 means no limit); it can be used to reject an
+// image from its header, e.g. image.DecodeConfig, before decoding it
+func CheckSize(width, height, maxPixels int) error {
+	if maxPixels > 0 && int64(width)*int64(height) > int64(maxPixels) {
+		return fmt.Errorf("%w: %dx%d is more than %d pixels", ErrTooLarge, width, height, maxPixels)
+	}
+	return nil
+}
+
+// ErrEmptyImage is returned by MakeTransparent when the image has no pixels,
+// e.g. because it was decoded from a corrupt or degenerate file
+var ErrEmptyImage = errors.New("image is empty - it must be at least 1x1 pixels")
+
+// MakeTransparent returns a copy of img in which the background is transparent
+func MakeTransparent(img image.Image, opts Options) (*image.RGBA, error) {
+	imageRGBA, _, err := MakeTransparentCount(img, opts)
+	return imageRGBA, err
+}
+
+// MakeTransparentCount is like MakeTransparent, but also returns the number of
+// pixels which were made transparent
+func MakeTransparentCount(img image.Image, opts Options) (*image.RGBA, int, error) {
+	imageRGBA, stats, err := MakeTransparentStats(img, opts)
+	return imageRGBA, stats.PixelsChanged, err
+}
+
+// Stats describe what was done to an image to make its background transparent
+type Stats struct {
+	// Bounds of the image
+	Bounds image.Rectangle
+	// BackgroundColors which were made transparent: Options.BackgroundColors,
+	// the detected one or, with BackgroundModes.Gradient, the
+	// DetectGradientCorners colors; none with Options.ChromaKey
+	BackgroundColors []color.RGBA
+	// PixelsExamined is the number of pixels compared with the background (the
+	// already transparent pixels, and in Flood mode the ones not reachable from
+	// the edges, are not)
+	PixelsExamined int
+	// PixelsChanged is the number of pixels made (partially) transparent
+	PixelsChanged int
+}
+
+// MakeTransparentStats is like MakeTransparent, but also returns the Stats of
+// what was done; they are returned with ErrNotConverted too
+func MakeTransparentStats(img image.Image, opts Options) (*image.RGBA, Stats, error) {
+	stats, imageRGBA, err := makeBackgroundTransparent(img, &opts)
+	if err != nil {
+		return nil, stats, err
+	}
+	if stats.PixelsChanged == 0 {
+		return nil, stats, notConverted(stats)
+	}
+	return imageRGBA, stats, nil
+}
+
+// Analysis describes what MakeTransparent would do to an image
+type Analysis struct {
+	// BackgroundColors which would be made transparent (with
+	// BackgroundModes.Gradient, the DetectGradientCorners colors)
+	BackgroundColors []color.RGBA
+	// Ambiguous reports whether DetectBackgroundColor could not decide on the
+	// background color (false if it was given in the Options)
+	Ambiguous bool
+	// Opaque reports whether the image has no transparent pixels
+	Opaque bool
+	// Pixels is the number of pixels of the image
+	Pixels int
+	// BackgroundPixels is the number of pixels which would be made transparent
+	BackgroundPixels int
+}
+
+// Analyze reports what MakeTransparent would do to img, without producing the
+// transparent image
+func Analyze(img image.Image, opts Options) Analysis {
+	opts.gray = opts.gray || isGray(img)
+	imageRGBA := image.NewRGBA(img.Bounds())
+	draw.Draw(imageRGBA, img.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	analysis := Analysis{Opaque: imageRGBA.Opaque(), Pixels: img.Bounds().Dx() * img.Bounds().Dy()}
+	analysis.BackgroundColors = opts.BackgroundColors
+	if opts.ChromaKey != nil {
+		analysis.BackgroundColors = nil
+	} else if len(analysis.BackgroundColors) == 0 && opts.BackgroundMode == BackgroundModes.Gradient {
+		corners := DetectGradientCorners(imageRGBA)
+		analysis.BackgroundColors = corners[:]
+	} else if len(analysis.BackgroundColors) == 0 {
+		var detected color.RGBA
+		detected, analysis.Ambiguous = DetectBackgroundColor(imageRGBA, opts)
+		analysis.BackgroundColors = []color.RGBA{detected}
+		opts.BackgroundColors = analysis.BackgroundColors
+	}
+	opts.FeatherRadius = 0
+	stats, _, _ := makeBackgroundTransparent(imageRGBA, &opts)
+	analysis.BackgroundPixels = stats.PixelsChanged
+	return analysis
+}
+
+// forEachRowBand splits the rows [0, height) into (at most) workers horizontal
+// bands and calls fn concurrently for each of them, returning when all are done
+func forEachRowBand(height int, workers int, fn func(yStart, yEnd int)) {
+	bands := workers
+	if bands > height {
+		bands = height
+	}
+	if bands < 1 {
+		bands = 1
+	}
+	bandHeight := (height + bands - 1) / bands
+
+	var wg sync.WaitGroup
+	for yStart := 0; yStart < height; yStart += bandHeight {
+		yEnd := yStart + bandHeight
+		if yEnd > height {
+			yEnd = height
+		}
+		wg.Add(1)
+		go func(yStart, yEnd int) {
+			defer wg.Done()
+			fn(yStart, yEnd)
+		}(yStart, yEnd)
+	}
+	wg.Wait()
+}
+
+// seed returns the coordinates of opts.SeedPoint in an image having the given
+// bounds, reporting whether it is used (in the Flood mode) and within them
+func (opts *Options) seed(bounds image.Rectangle) (image.Point, bool) {
+	if opts.SeedPoint == nil || opts.Mode != Modes.Flood {
+		return image.Point{}, false
+	}
+	p := bounds.Min.Add(*opts.SeedPoint)
+	return p, p.In(bounds)
+}
+
+// isGray reports whether img is a grayscale image, with a single channel
+func isGray(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.GrayModel, color.Gray16Model:
+		return true
+	default:
+		return false
+	}
+}
+
+// straightColor returns the non alpha-premultiplied channel values of c (which is
+// what sameColor compares), so that semi-transparent pixels match by their color
+func straightColor(c color.Color) color.RGBA {
+	nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return color.RGBA{R: nc.R, G: nc.G, B: nc.B, A: nc.A}
+}
+
+// straightRGBAAt returns the straightColor of the pixel at (x, y)
+func straightRGBAAt(img *image.RGBA, x, y int) color.RGBA {
+	c := img.RGBAAt(x, y)
+	if c.A == 255 || c.A == 0 {
+		return c
+	}
+	return straightColor(c)
+}
+
+// makeBackgroundTransparent makes transparent all the pixels which have the same
+// color as any of opts.BackgroundColors or, if there are none, as the one
+// detected by DetectBackgroundColor (or the local one of the gradient between
+// the corners, with BackgroundModes.Gradient). The alpha of the other pixels is left untouched, so
+// images which already have some transparency are processed too, unless the
+// detected background color is transparent, in which case nothing is done. Returns the
+// Stats of what was done, or ErrEmptyImage if img has no pixels (or ErrTooLarge
+// if it has more than opts.MaxPixels).
+func makeBackgroundTransparent(img image.Image, opts *Options) (Stats, *image.RGBA, error) {
+	stats := Stats{Bounds: img.Bounds()}
+	if img.Bounds().Empty() {
+		return stats, nil, ErrEmptyImage
+	}
+	if err := CheckSize(img.Bounds().Dx(), img.Bounds().Dy(), opts.MaxPixels); err != nil {
+		return stats, nil, err
+	}
+	if isGray(img) && !opts.gray {
+		grayOpts := *opts
+		grayOpts.gray = true
+		opts = &grayOpts
+	}
+	seed, seeded := opts.seed(img.Bounds())
+	if opts.SeedPoint != nil && opts.Mode == Modes.Flood && !seeded {
+		return stats, nil, fmt.Errorf("seed point %d,%d is outside of the %dx%d image", opts.SeedPoint.X, opts.SeedPoint.Y, img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	imageRGBA := image.NewRGBA(img.Bounds())
+	draw.Draw(imageRGBA, img.Bounds(), img, img.Bounds().Min, draw.Src)
+	backgroundColors := opts.BackgroundColors
+	if len(backgroundColors) == 0 && opts.BackgroundMode != BackgroundModes.Gradient && opts.ChromaKey == nil {
+		detected, _ := DetectBackgroundColor(imageRGBA, *opts)
+		backgroundColors = []color.RGBA{detected}
+		if detected.A == 0 {
+			// the colors of transparent pixels are meaningless, e.g. black
+			stats.BackgroundColors = backgroundColors
+			return stats, imageRGBA, nil
+		}
+	}
+	isBackground := opts.backgroundMatcher(imageRGBA, backgroundColors)
+	stats.BackgroundColors = backgroundColors
+	if len(backgroundColors) == 0 && opts.ChromaKey == nil {
+		corners := DetectGradientCorners(imageRGBA)
+		stats.BackgroundColors = corners[:]
+	}
+
+	var changed, examined int64
+	if opts.Mode == Modes.Flood {
+		var seeds []image.Point
+		if seeded {
+			seeds = []image.Point{seed}
+		}
+		floodChanged, floodExamined := floodFillTransparent(imageRGBA, isBackground, seeds)
+		changed, examined = int64(floodChanged), int64(floodExamined)
+		if opts.Progress != nil {
+			opts.Progress(imageRGBA.Bounds().Dy(), imageRGBA.Bounds().Dy())
+		}
+	} else {
+		bounds := imageRGBA.Bounds()
+		height := bounds.Dy()
+		workers := opts.Workers
+		if workers < 1 {
+			workers = runtime.NumCPU()
+		}
+		var rowsDone int64
+		// the bands are of rows [0, height), while the pixels are addressed by
+		// their coordinates, which start at bounds.Min (e.g. for sub-images)
+		forEachRowBand(height, workers, func(yStart, yEnd int) {
+			var bandChanged, bandExamined int64
+			for y := bounds.Min.Y + yStart; y < bounds.Min.Y+yEnd; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					color := straightRGBAAt(imageRGBA, x, y)
+					if color.A == 0 {
+						continue
+					}
+					bandExamined++
+					if isBackground(x, y, &color) {
+						c := imageRGBA.RGBAAt(x, y)
+						c.A = 0
+						imageRGBA.SetRGBA(x, y, c)
+						bandChanged++
+					}
+				}
+				if opts.Progress != nil {
+					opts.Progress(int(atomic.AddInt64(&rowsDone, 1)), height)
+				}
+			}
+			atomic.AddInt64(&changed, bandChanged)
+			atomic.AddInt64(&examined, bandExamined)
+		})
+	}
+
+	if changed > 0 && opts.MinBackgroundRegion > 0 {
+		changed -= int64(restoreSmallRegions(imageRGBA, img, opts.MinBackgroundRegion))
+	}
+	if changed > 0 && opts.SoftEdges > 0 && !opts.Invert {
+		changed += int64(softenEdges(imageRGBA, opts, opts.backgroundExcess(imageRGBA, backgroundColors)))
+	}
+	if changed > 0 && opts.Despeckle > 0 {
+		changed += int64(despeckle(imageRGBA, img, opts.Despeckle))
+	}
+	if changed > 0 && opts.KeepLargest > 0 {
+		changed += int64(keepLargest(imageRGBA, opts.KeepLargest))
+	}
+	if changed > 0 {
+		featherEdges(imageRGBA, opts.FeatherRadius)
+		if opts.BackgroundAlpha > 0 {
+			fadeBackground(imageRGBA, img, opts.BackgroundAlpha)
+		}
+		if opts.ReplaceWith != nil {
+			fillBackground(imageRGBA, *opts.ReplaceWith)
+		}
+	}
+	stats.PixelsExamined, stats.PixelsChanged = int(examined), int(changed)
+	return stats, imageRGBA, nil
+}
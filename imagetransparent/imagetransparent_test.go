@@ -0,0 +1,614 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// newTestImage returns a size x size white image with a red square in its center
+func newTestImage(size int) image.Image {
+	return newTestImageCoverage(size, 2)
+}
+
+// newTestImageCoverage returns a size x size white image with a red square in
+// its center, leaving a white margin of size/(2*margins) around it; e.g. 2 makes
+// the image mostly background, 16 mostly foreground
+func newTestImageCoverage(size int, margins int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	red := color.RGBA{R: 255, A: 255}
+	lo, hi := size/(2*margins), size-size/(2*margins)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if x > lo && x < hi && y > lo && y < hi {
+				img.SetRGBA(x, y, red)
+			} else {
+				img.SetRGBA(x, y, white)
+			}
+		}
+	}
+	return img
+}
+
+func BenchmarkMakeBackgroundTransparent(b *testing.B) {
+	coverages := []struct {
+		name    string
+		margins int
+	}{
+		{"background", 2},
+		{"foreground", 16},
+	}
+	workers := []int{1}
+	if n := runtime.NumCPU(); n > 1 {
+		workers = append(workers, n)
+	}
+	for _, size := range []int{256, 1024, 4096} {
+		for _, coverage := range coverages {
+			img := newTestImageCoverage(size, coverage.margins)
+			for _, w := range workers {
+				b.Run(fmt.Sprintf("size=%d/%s/workers=%d", size, coverage.name, w), func(b *testing.B) {
+					opts := DefaultOptions()
+					opts.Workers = w
+					for i := 0; i < b.N; i++ {
+						makeBackgroundTransparent(img, &opts)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestMakeTransparentFixtures(t *testing.T) {
+	// 32 x 32 images, in testdata, of a blue 16 x 16 square on white; the JPEG
+	// one has compression artifacts around the square
+	for _, name := range []string{"blue-on-white.png", "blue-on-white.jpg"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := DecodeImage(data, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		result, changed, err := MakeTransparentCount(img, DefaultOptions())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if changed < 32*32-16*16-64 || changed > 32*32-16*16 {
+			t.Errorf("%s: %d pixels changed, want about %d", name, changed, 32*32-16*16)
+		}
+		if a := result.RGBAAt(0, 0).A; a != 0 {
+			t.Errorf("%s: corner alpha = %d, want 0", name, a)
+		}
+		if a := result.RGBAAt(16, 16).A; a != 255 {
+			t.Errorf("%s: center alpha = %d, want 255", name, a)
+		}
+	}
+}
+
+func TestMakeBackgroundTransparentSemiTransparentPNG(t *testing.T) {
+	// white background with a fully transparent top row and a semi-transparent
+	// red square in the center
+	src := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			switch {
+			case y == 0:
+				src.SetNRGBA(x, y, color.NRGBA{})
+			case x >= 2 && x < 6 && y >= 2 && y < 6:
+				src.SetNRGBA(x, y, color.NRGBA{R: 255, A: 128})
+			default:
+				src.SetNRGBA(x, y, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+			}
+		}
+	}
+	var buff bytes.Buffer
+	if err := png.Encode(&buff, src); err != nil {
+		t.Fatal(err)
+	}
+	img, _, err := image.Decode(&buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultOptions()
+	opts.BackgroundColors = []color.RGBA{{R: 255, G: 255, B: 255, A: 255}}
+	result, err := MakeTransparent(img, opts)
+	if err != nil {
+		t.Fatalf("semi-transparent image was not converted: %v", err)
+	}
+	if a := result.RGBAAt(1, 1).A; a != 0 {
+		t.Errorf("background pixel alpha = %d, want 0", a)
+	}
+	if a := result.RGBAAt(3, 3).A; a != 128 {
+		t.Errorf("semi-transparent foreground pixel alpha = %d, want 128", a)
+	}
+}
+
+func TestMakeTransparentMultipleBackgroundColors(t *testing.T) {
+	// white top half and blue bottom half, with a red square across them
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	red := color.RGBA{R: 255, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			switch {
+			case x >= 3 && x < 5 && y >= 3 && y < 5:
+				img.SetRGBA(x, y, red)
+			case y < 4:
+				img.SetRGBA(x, y, white)
+			default:
+				img.SetRGBA(x, y, blue)
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.BackgroundColors = []color.RGBA{white}
+	result, err := MakeTransparent(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := result.RGBAAt(0, 7).A; a != 255 {
+		t.Errorf("with a single background color, blue pixel alpha = %d, want 255", a)
+	}
+
+	opts.BackgroundColors = []color.RGBA{white, blue}
+	result, err = MakeTransparent(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []image.Point{{0, 0}, {7, 3}, {0, 7}, {7, 4}} {
+		if a := result.RGBAAt(p.X, p.Y).A; a != 0 {
+			t.Errorf("background pixel %v alpha = %d, want 0", p, a)
+		}
+	}
+	if a := result.RGBAAt(3, 3).A; a != 255 {
+		t.Errorf("foreground pixel alpha = %d, want 255", a)
+	}
+}
+
+func TestAutoTolerance(t *testing.T) {
+	// a light gray background with +-6 of noise and a dark bar crossing the
+	// left edge
+	bg := color.RGBA{R: 240, G: 240, B: 240, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			if x < 16 && y >= 12 && y < 20 {
+				img.SetRGBA(x, y, color.RGBA{R: 20, G: 20, B: 20, A: 255})
+				continue
+			}
+			noise := uint8((x*7+y*13)%13) - 6
+			img.SetRGBA(x, y, color.RGBA{R: bg.R + noise, G: bg.G - noise, B: bg.B, A: 255})
+		}
+	}
+
+	tolerance := AutoTolerance(img, []color.RGBA{bg})
+	if tolerance < 6 || tolerance > 30 {
+		t.Fatalf("tolerance = %d, want between 6 and 30", tolerance)
+	}
+
+	opts := DefaultOptions()
+	opts.BackgroundColors = []color.RGBA{bg}
+	opts.Tolerance, opts.UniformTolerance = tolerance, tolerance
+	result, err := MakeTransparent(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []image.Point{{0, 0}, {31, 31}, {20, 15}} {
+		if a := result.RGBAAt(p.X, p.Y).A; a != 0 {
+			t.Errorf("background pixel %v alpha = %d, want 0", p, a)
+		}
+	}
+	if a := result.RGBAAt(0, 15).A; a != 255 {
+		t.Errorf("foreground pixel alpha = %d, want 255", a)
+	}
+}
+
+func TestMakeBackgroundTransparent(t *testing.T) {
+	img := newTestImage(8)
+	opts := DefaultOptions()
+
+	stats, result, err := makeBackgroundTransparent(img, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the red square covers the pixels 3-5 of the rows 3-5
+	if stats.PixelsChanged != 64-9 || stats.PixelsExamined != 64 {
+		t.Errorf("changed %d of %d examined pixels, want %d of %d", stats.PixelsChanged, stats.PixelsExamined, 64-9, 64)
+	}
+	if len(stats.BackgroundColors) != 1 || stats.BackgroundColors[0] != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Errorf("background colors = %v, want white", stats.BackgroundColors)
+	}
+	if stats.Bounds != img.Bounds() {
+		t.Errorf("bounds = %v, want %v", stats.Bounds, img.Bounds())
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			want := uint8(0)
+			if x >= 3 && x <= 5 && y >= 3 && y <= 5 {
+				want = 255
+			}
+			if a := result.RGBAAt(x, y).A; a != want {
+				t.Errorf("pixel (%d, %d) alpha = %d, want %d", x, y, a, want)
+			}
+		}
+	}
+
+	// the detected background color is transparent, so nothing is examined
+	stats, _, _ = makeBackgroundTransparent(result, &opts)
+	if stats.PixelsChanged != 0 || stats.PixelsExamined != 0 {
+		t.Errorf("changed %d of %d examined pixels of an already transparent image, want 0 of 0", stats.PixelsChanged, stats.PixelsExamined)
+	}
+	if _, err := MakeTransparent(result, opts); err != ErrAlreadyTransparent || !errors.Is(err, ErrNotConverted) {
+		t.Errorf("MakeTransparent of an already transparent image returned %v, want ErrAlreadyTransparent", err)
+	}
+	opts.BackgroundColors = []color.RGBA{{R: 255, G: 255, B: 255, A: 255}}
+	if _, err := MakeTransparent(result, opts); err != ErrNotConverted {
+		t.Errorf("MakeTransparent of an already transparent image with a given background color returned %v, want ErrNotConverted", err)
+	}
+}
+
+func TestMakeTransparentTinyImages(t *testing.T) {
+	opts := DefaultOptions()
+
+	onePixel := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	onePixel.SetRGBA(0, 0, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	result, changed, err := MakeTransparentCount(onePixel, opts)
+	if err != nil {
+		t.Fatalf("1x1 image was not converted: %v", err)
+	}
+	if changed != 1 || result.Bounds() != onePixel.Bounds() {
+		t.Errorf("1x1 image: changed %d pixels of a %v result, want 1 of %v", changed, result.Bounds(), onePixel.Bounds())
+	}
+	if a := result.RGBAAt(0, 0).A; a != 0 {
+		t.Errorf("1x1 image pixel alpha = %d, want 0", a)
+	}
+
+	for _, bounds := range []image.Rectangle{image.Rect(0, 0, 0, 0), image.Rect(0, 0, 5, 0), image.Rect(0, 0, 0, 5)} {
+		empty := image.NewRGBA(bounds)
+		for _, mode := range []BackgroundMode{BackgroundModes.Corners, BackgroundModes.Mode, BackgroundModes.Gradient} {
+			opts.BackgroundMode = mode
+			if _, err := MakeTransparent(empty, opts); err != ErrEmptyImage {
+				t.Errorf("%v image, %s background mode: MakeTransparent returned %v, want ErrEmptyImage", bounds, mode, err)
+			}
+		}
+		if _, _, err := MakeTransparent64(empty, opts); err != ErrEmptyImage {
+			t.Errorf("%v image: MakeTransparent64 returned %v, want ErrEmptyImage", bounds, err)
+		}
+	}
+}
+
+func TestSoftEdges(t *testing.T) {
+	// a white background, a black subject and, between them, a column of
+	// pixels blending the two
+	img := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			switch {
+			case x < 4:
+				img.SetRGBA(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			case x == 4:
+				img.SetRGBA(x, y, color.RGBA{R: 200, G: 200, B: 210, A: 255})
+			default:
+				img.SetRGBA(x, y, color.RGBA{A: 255})
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.Tolerance, opts.UniformTolerance = 20, 20
+	result, err := MakeTransparent(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := result.RGBAAt(4, 1).A; a != 255 {
+		t.Errorf("without soft edges, blended pixel alpha = %d, want 255", a)
+	}
+
+	// the blended pixel is 55-20 = 35 beyond the tolerance, so with a band of
+	// 70 it gets half the alpha
+	opts.SoftEdges = 70
+	result, changed, err := MakeTransparentCount(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 4*4+4 {
+		t.Errorf("changed %d pixels, want %d", changed, 4*4+4)
+	}
+	if a := result.RGBAAt(4, 1).A; a != 127 {
+		t.Errorf("blended pixel alpha = %d, want 127", a)
+	}
+	if a := result.RGBAAt(6, 1).A; a != 255 {
+		t.Errorf("subject pixel alpha = %d, want 255", a)
+	}
+}
+
+func TestDespeckle(t *testing.T) {
+	// a white background with a black speck, and a black subject with a white
+	// hole in its middle
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 255, G: 255, B: 255, A: 255}), image.ZP, draw.Src)
+	img.SetRGBA(1, 1, color.RGBA{A: 255})
+	draw.Draw(img, image.Rect(4, 4, 9, 9), image.NewUniform(color.RGBA{A: 255}), image.ZP, draw.Src)
+	img.SetRGBA(6, 6, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+
+	opts := DefaultOptions()
+	opts.Despeckle = 2
+	result, changed, err := MakeTransparentCount(img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the background but the subject, including the hole, and the speck
+	if want := 100 - 25; changed != want {
+		t.Errorf("changed %d pixels, want %d", changed, want)
+	}
+	if a := result.RGBAAt(1, 1).A; a != 0 {
+		t.Errorf("speck alpha = %d, want 0", a)
+	}
+	if c := result.RGBAAt(6, 6); c != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Errorf("hole = %v, want opaque white", c)
+	}
+	if a := result.RGBAAt(0, 0).A; a != 0 {
+		t.Errorf("background alpha = %d, want 0", a)
+	}
+}
+
+func TestKeepLargest(t *testing.T) {
+	// a white background with a 3x3 black subject, a 2x2 blob and two specks,
+	// one of them touching the subject diagonally
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 255, G: 255, B: 255, A: 255}), image.ZP, draw.Src)
+	black := image.NewUniform(color.RGBA{A: 255})
+	draw.Draw(img, image.Rect(5, 5, 8, 8), black, image.ZP, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 2, 2), black, image.ZP, draw.Src)
+	img.SetRGBA(8, 0, color.RGBA{A: 255})
+	img.SetRGBA(8, 8, color.RGBA{A: 255})
+
+	tests := []struct {
+		n        int
+		wantKept int
+		kept     []image.Point
+	}{
+		{1, 10, []image.Point{{6, 6}, {8, 8}}},
+		{2, 14, []image.Point{{6, 6}, {8, 8}, {0, 0}}},
+		{5, 15, []image.Point{{6, 6}, {8, 8}, {0, 0}, {8, 0}}},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.KeepLargest = tt.n
+		result, changed, err := MakeTransparentCount(img, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kept := 0
+		for y := 0; y < 10; y++ {
+			for x := 0; x < 10; x++ {
+				if result.RGBAAt(x, y).A != 0 {
+					kept++
+				}
+			}
+		}
+		if changed != 100-kept {
+			t.Errorf("keep largest %d: changed %d pixels, but %d are kept", tt.n, changed, kept)
+		}
+		for _, p := range tt.kept {
+			if a := result.RGBAAt(p.X, p.Y).A; a != 255 {
+				t.Errorf("keep largest %d: pixel %v alpha = %d, want 255", tt.n, p, a)
+			}
+		}
+		if kept != tt.wantKept {
+			t.Errorf("keep largest %d: kept %d pixels, want %d", tt.n, kept, tt.wantKept)
+		}
+	}
+}
+
+func TestMinBackgroundRegion(t *testing.T) {
+	// a white background with a 6x6 black subject having a white glint of a
+	// pixel and one of 2 pixels
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(img, img.Bounds(), image.NewUniform(white), image.ZP, draw.Src)
+	draw.Draw(img, image.Rect(2, 2, 8, 8), image.NewUniform(color.RGBA{A: 255}), image.ZP, draw.Src)
+	img.SetRGBA(3, 3, white)
+	img.SetRGBA(5, 5, white)
+	img.SetRGBA(6, 5, white)
+
+	tests := []struct {
+		size        int
+		wantChanged int
+		kept        []image.Point
+		removed     []image.Point
+	}{
+		{0, 67, nil, []image.Point{{3, 3}, {5, 5}}},
+		{2, 66, []image.Point{{3, 3}}, []image.Point{{5, 5}, {6, 5}}},
+		{3, 64, []image.Point{{3, 3}, {5, 5}, {6, 5}}, []image.Point{{0, 0}}},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.MinBackgroundRegion = tt.size
+		result, changed, err := MakeTransparentCount(img, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != tt.wantChanged {
+			t.Errorf("min background region %d: changed %d pixels, want %d", tt.size, changed, tt.wantChanged)
+		}
+		for _, p := range tt.kept {
+			if got := result.RGBAAt(p.X, p.Y); got != white {
+				t.Errorf("min background region %d: pixel %v = %v, want %v", tt.size, p, got, white)
+			}
+		}
+		for _, p := range tt.removed {
+			if a := result.RGBAAt(p.X, p.Y).A; a != 0 {
+				t.Errorf("min background region %d: pixel %v alpha = %d, want 0", tt.size, p, a)
+			}
+		}
+	}
+}
+
+func TestMakeTransparentSubImage(t *testing.T) {
+	// the sub-image is the red square in the center of the image, with a
+	// one pixel white margin around it
+	img := newTestImage(8).(*image.RGBA)
+	sub := img.SubImage(image.Rect(2, 2, 7, 7))
+
+	for _, mode := range []Mode{Modes.Global, Modes.Flood} {
+		opts := DefaultOptions()
+		opts.Mode = mode
+		result, changed, err := MakeTransparentCount(sub, opts)
+		if err != nil {
+			t.Fatalf("%s mode: %v", mode, err)
+		}
+		if result.Bounds() != sub.Bounds() {
+			t.Errorf("%s mode: bounds = %v, want %v", mode, result.Bounds(), sub.Bounds())
+		}
+		if changed != 25-9 {
+			t.Errorf("%s mode: changed %d pixels, want %d", mode, changed, 25-9)
+		}
+		for y := 2; y < 7; y++ {
+			for x := 2; x < 7; x++ {
+				want := uint8(0)
+				if x >= 3 && x <= 5 && y >= 3 && y <= 5 {
+					want = 255
+				}
+				if a := result.RGBAAt(x, y).A; a != want {
+					t.Errorf("%s mode: pixel (%d, %d) alpha = %d, want %d", mode, x, y, a, want)
+				}
+			}
+		}
+	}
+}
+
+func TestSeedPoint(t *testing.T) {
+	// a white image with a red ring around the pixels 3-4 of the rows 3-4
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	red := color.RGBA{R: 255, A: 255}
+	for i := 2; i <= 5; i++ {
+		img.SetRGBA(i, 2, red)
+		img.SetRGBA(i, 5, red)
+		img.SetRGBA(2, i, red)
+		img.SetRGBA(5, i, red)
+	}
+	inside := func(x, y int) bool { return x >= 3 && x <= 4 && y >= 3 && y <= 4 }
+	ring := func(x, y int) bool { return x >= 2 && x <= 5 && y >= 2 && y <= 5 && !inside(x, y) }
+
+	tests := []struct {
+		seed    image.Point
+		removed func(x, y int) bool
+	}{
+		// only the white enclosed by the ring, not the outer background
+		{image.Point{X: 3, Y: 4}, inside},
+		// the seed color is the background color
+		{image.Point{X: 5, Y: 2}, ring},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.Mode = Modes.Flood
+		opts.SeedPoint = &tt.seed
+		result, changed, err := MakeTransparentCount(img, opts)
+		if err != nil {
+			t.Fatalf("seed %v: %v", tt.seed, err)
+		}
+		want := 0
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				wantAlpha := uint8(255)
+				if tt.removed(x, y) {
+					wantAlpha = 0
+					want++
+				}
+				if a := result.RGBAAt(x, y).A; a != wantAlpha {
+					t.Errorf("seed %v: pixel (%d, %d) alpha = %d, want %d", tt.seed, x, y, a, wantAlpha)
+				}
+			}
+		}
+		if changed != want {
+			t.Errorf("seed %v: changed %d pixels, want %d", tt.seed, changed, want)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.Mode = Modes.Flood
+	opts.SeedPoint = &image.Point{X: 8, Y: 0}
+	if _, err := MakeTransparent(img, opts); err == nil {
+		t.Error("seed point outside of the image: MakeTransparent returned no error")
+	}
+}
+
+func TestMakeTransparentGray(t *testing.T) {
+	// a scanned document: a light gray paper background with a darker smudge,
+	// 30 gray levels darker, and black text
+	levels := []uint8{200, 170, 0}
+	gray := image.NewGray(image.Rect(0, 0, 9, 3))
+	gray16 := image.NewGray16(gray.Bounds())
+	rgba := image.NewRGBA(gray.Bounds())
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 3; y++ {
+			level := levels[0]
+			if x > 2 && y == 1 {
+				level = levels[x/3]
+			}
+			gray.SetGray(x, y, color.Gray{Y: level})
+			gray16.SetGray16(x, y, color.Gray16{Y: uint16(level) * 0x101})
+			rgba.SetRGBA(x, y, color.RGBA{R: level, G: level, B: level, A: 255})
+		}
+	}
+
+	tests := []struct {
+		name   string
+		img    image.Image
+		metric Metric
+		// whether the smudge is removed
+		want bool
+	}{
+		// the gray levels are compared against the tolerance, not the uniform one
+		{"gray", gray, Metrics.RGB, true},
+		{"gray16", gray16, Metrics.RGB, true},
+		{"gray euclidean", gray, Metrics.Euclidean, true},
+		// the same colors in an RGBA image differ uniformly from the background
+		{"rgba", rgba, Metrics.RGB, false},
+		// by sqrt(3) * 30
+		{"rgba euclidean", rgba, Metrics.Euclidean, false},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.Tolerance, opts.UniformTolerance = 40, 10
+		opts.Metric = tt.metric
+		if got, ambiguous := DetectBackgroundColor(tt.img, opts); got != (color.RGBA{R: 200, G: 200, B: 200, A: 255}) || ambiguous {
+			t.Errorf("%s: background color = %v (ambiguous %t), want gray 200", tt.name, got, ambiguous)
+		}
+		var alpha func(x, y int) uint32
+		if IsDeep(tt.img) {
+			result, _, err := MakeTransparent64(tt.img, opts)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			alpha = func(x, y int) uint32 { return uint32(result.RGBA64At(x, y).A >> 8) }
+		} else {
+			result, err := MakeTransparent(tt.img, opts)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			alpha = func(x, y int) uint32 { return uint32(result.RGBAAt(x, y).A) }
+		}
+		if removed := alpha(4, 1) == 0; removed != tt.want {
+			t.Errorf("%s: smudge removed = %t, want %t", tt.name, removed, tt.want)
+		}
+		if alpha(0, 0) != 0 || alpha(7, 1) != 255 {
+			t.Errorf("%s: background alpha = %d, text alpha = %d, want 0 and 255", tt.name, alpha(0, 0), alpha(7, 1))
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// ImageType ...
+type ImageType string
+
+// ImageTypes supported; AVIF and HEIC can only be decoded, and only by the
+// builds having the heif tag (see ErrDecoderUnavailable)
+var ImageTypes = struct {
+	JPEG        ImageType
+	PNG         ImageType
+	BMP         ImageType
+	TIFF        ImageType
+	GIF         ImageType
+	WEBP        ImageType
+	ICO         ImageType
+	AVIF        ImageType
+	HEIC        ImageType
+	UNSUPPORTED ImageType
+}{
+	JPEG:        "jpeg",
+	PNG:         "png",
+	BMP:         "bmp",
+	TIFF:        "tiff",
+	GIF:         "gif",
+	WEBP:        "webp",
+	ICO:         "ico",
+	AVIF:        "avif",
+	HEIC:        "heic",
+	UNSUPPORTED: "unsupported",
+}
+
+// GetImageType returns the image type corresponding to the given file extension
+// (without the leading dot)
+func GetImageType(fileExt string) ImageType {
+	switch strings.ToLower(fileExt) {
+	case "jpg":
+		fallthrough
+	case "jpeg":
+		return ImageTypes.JPEG
+	case "png":
+		return ImageTypes.PNG
+	case "bmp":
+		return ImageTypes.BMP
+	case "tiff", "tif":
+		return ImageTypes.TIFF
+	case "gif":
+		return ImageTypes.GIF
+	case "webp":
+		return ImageTypes.WEBP
+	case "ico":
+		return ImageTypes.ICO
+	case "avif":
+		return ImageTypes.AVIF
+	case "heic", "heif":
+		return ImageTypes.HEIC
+	default:
+		return ImageTypes.UNSUPPORTED
+	}
+}
+
+// SniffImageType detects the image type from the magic bytes at the start of
+// the image data; returns ImageTypes.UNSUPPORTED if the header is not recognized
+func SniffImageType(header []byte) ImageType {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return ImageTypes.JPEG
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return ImageTypes.PNG
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return ImageTypes.GIF
+	case bytes.HasPrefix(header, []byte("BM")):
+		return ImageTypes.BMP
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		return ImageTypes.TIFF
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")):
+		return ImageTypes.WEBP
+	case bytes.HasPrefix(header, []byte(icoHeader)):
+		return ImageTypes.ICO
+	default:
+		return sniffHEIFType(header)
+	}
+}
+
+// sniffHEIFType detects AVIF and HEIC images from the brands listed in the
+// ftyp box at the start of their (ISO base media) file; returns
+// ImageTypes.UNSUPPORTED for the other files
+func sniffHEIFType(header []byte) ImageType {
+	if len(header) < 16 || string(header[4:8]) != "ftyp" {
+		return ImageTypes.UNSUPPORTED
+	}
+	size := int(binary.BigEndian.Uint32(header[0:4]))
+	if size > len(header) {
+		size = len(header)
+	}
+	// the major brand, then the compatible ones after the minor version
+	brands := []string{string(header[8:12])}
+	for i := 16; i+4 <= size; i += 4 {
+		brands = append(brands, string(header[i:i+4]))
+	}
+	imageType := ImageTypes.UNSUPPORTED
+	for _, brand := range brands {
+		switch brand {
+		case "avif", "avis":
+			return ImageTypes.AVIF
+		case "heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1":
+			imageType = ImageTypes.HEIC
+		}
+	}
+	return imageType
+}
@@ -0,0 +1,65 @@
+package imagetransparent
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetImageType(t *testing.T) {
+	tests := []struct {
+		ext  string
+		want ImageType
+	}{
+		{"jpg", ImageTypes.JPEG},
+		{"jpeg", ImageTypes.JPEG},
+		{"JPG", ImageTypes.JPEG},
+		{"png", ImageTypes.PNG},
+		{"PNG", ImageTypes.PNG},
+		{"bmp", ImageTypes.BMP},
+		{"tiff", ImageTypes.TIFF},
+		{"TIF", ImageTypes.TIFF},
+		{"gif", ImageTypes.GIF},
+		{"webp", ImageTypes.WEBP},
+		{"ICO", ImageTypes.ICO},
+		{"avif", ImageTypes.AVIF},
+		{"HEIC", ImageTypes.HEIC},
+		{"heif", ImageTypes.HEIC},
+		{"", ImageTypes.UNSUPPORTED},
+		{"txt", ImageTypes.UNSUPPORTED},
+		{".png", ImageTypes.UNSUPPORTED},
+	}
+	for _, tt := range tests {
+		if got := GetImageType(tt.ext); got != tt.want {
+			t.Errorf("GetImageType(%q) = %s, want %s", tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestSniffHEIFType(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   ImageType
+	}{
+		{"avif", "\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1miaf", ImageTypes.AVIF},
+		{"avif compatible brand", "\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00mif1avif", ImageTypes.AVIF},
+		{"heic", "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic", ImageTypes.HEIC},
+		{"mp4", "\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isomiso2", ImageTypes.UNSUPPORTED},
+		{"short", "\x00\x00\x00\x18ftyp", ImageTypes.UNSUPPORTED},
+	}
+	for _, tt := range tests {
+		if got := SniffImageType([]byte(tt.header)); got != tt.want {
+			t.Errorf("%s: SniffImageType = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeImageUnavailable(t *testing.T) {
+	if _, ok := decoders[ImageTypes.HEIC]; ok {
+		t.Skip("built with the heif tag")
+	}
+	_, err := DecodeImage([]byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"), 0)
+	if !errors.Is(err, ErrDecoderUnavailable) {
+		t.Errorf("error when decoding a HEIC image = %v, want %v", err, ErrDecoderUnavailable)
+	}
+}
@@ -0,0 +1,80 @@
+package imagetransparent
+
+import (
+	"image"
+	"sort"
+)
+
+// keepLargest keeps only the n largest components (8-connected, so that thin
+// diagonal lines don't split the subject) of the pixels of img which aren't
+// transparent, making transparent all the other ones, e.g. the blobs of noise
+// scattered around the subject. Returns the number of pixels made transparent.
+func keepLargest(img *image.RGBA, n int) int {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	// labels holds the component index + 1 of each kept pixel
+	labels := make([]int, width*bounds.Dy())
+	var sizes []int
+	var queue []image.Point
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i := (y-bounds.Min.Y)*width + (x - bounds.Min.X)
+			if labels[i] != 0 || img.RGBAAt(x, y).A == 0 {
+				continue
+			}
+			sizes = append(sizes, 0)
+			label := len(sizes)
+			labels[i] = label
+			queue = append(queue[:0], image.Point{x, y})
+			for len(queue) > 0 {
+				p := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+				sizes[label-1]++
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						q := image.Point{p.X + dx, p.Y + dy}
+						if !q.In(bounds) {
+							continue
+						}
+						j := (q.Y-bounds.Min.Y)*width + (q.X - bounds.Min.X)
+						if labels[j] != 0 || img.RGBAAt(q.X, q.Y).A == 0 {
+							continue
+						}
+						labels[j] = label
+						queue = append(queue, q)
+					}
+				}
+			}
+		}
+	}
+	if len(sizes) <= n {
+		return 0
+	}
+
+	// the labels of the components by decreasing size; on ties the first found
+	// (the topmost) ones are kept
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return sizes[order[a]] > sizes[order[b]] })
+	kept := make([]bool, len(sizes))
+	for _, label := range order[:n] {
+		kept[label] = true
+	}
+
+	changed := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			label := labels[(y-bounds.Min.Y)*width+(x-bounds.Min.X)]
+			if label == 0 || kept[label-1] {
+				continue
+			}
+			c := img.RGBAAt(x, y)
+			c.A = 0
+			img.SetRGBA(x, y, c)
+			changed++
+		}
+	}
+	return changed
+}
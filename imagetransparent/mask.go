@@ -0,0 +1,21 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+)
+
+// Mask returns the alpha channel of img as a grayscale image: the transparent
+// pixels (e.g. the removed background) are black, the opaque ones white and the
+// semi-transparent ones (e.g. the feathered edges) gray
+func Mask(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	mask := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			_, _, _, a := img.At(x, y).RGBA()
+			mask.SetGray(x, y, color.Gray{Y: uint8(a >> 8)})
+		}
+	}
+	return mask
+}
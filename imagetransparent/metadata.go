@@ -0,0 +1,129 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Metadata is the metadata of an image which is kept when it is made
+// transparent, see ReadMetadata and EncodeOptions.Metadata
+type Metadata struct {
+	// Camera is the make and model of the camera which took the picture
+	Camera string
+	// Date is when the picture was taken, formatted as 2006-01-02 15:04:05
+	Date string
+	// Copyright is the copyright notice
+	Copyright string
+}
+
+// IsEmpty reports whether m has no metadata at all
+func (m Metadata) IsEmpty() bool {
+	return m == Metadata{}
+}
+
+// EXIF tags of the metadata
+const (
+	exifMakeTag             = 0x010F
+	exifModelTag            = 0x0110
+	exifDateTimeTag         = 0x0132
+	exifCopyrightTag        = 0x8298
+	exifIFDTag              = 0x8769
+	exifDateTimeOriginalTag = 0x9003
+)
+
+// ReadMetadata reads the Metadata from the EXIF of the JPEG or TIFF image data;
+// it is empty for other images, or if they have no EXIF
+func ReadMetadata(data []byte) Metadata {
+	e, ok := findEXIF(data)
+	if !ok {
+		return Metadata{}
+	}
+	ifd := e.firstIFD()
+	var m Metadata
+	maker, model := e.ascii(ifd, exifMakeTag), e.ascii(ifd, exifModelTag)
+	// the model often starts with the make, e.g. Canon and Canon EOS 80D
+	if maker != "" && !strings.HasPrefix(model, maker) {
+		model = strings.TrimSpace(maker + " " + model)
+	}
+	m.Camera = model
+	m.Copyright = e.ascii(ifd, exifCopyrightTag)
+
+	date := e.ascii(ifd, exifDateTimeTag)
+	if typ, count, value, ok := e.tag(exifIFDTag); ok && (typ == 4 || typ == 13) && count == 1 { // a LONG or IFD offset
+		if original := e.ascii(int(e.order.Uint32(value)), exifDateTimeOriginalTag); original != "" {
+			date = original
+		}
+	}
+	if t, err := time.Parse("2006:01:02 15:04:05", date); err == nil {
+		date = t.Format("2006-01-02 15:04:05")
+	}
+	m.Date = date
+	return m
+}
+
+// pngTextKeywords are the PNG keywords of the metadata, from the ones predefined
+// by the PNG specification
+func (m Metadata) pngTextKeywords() [][2]string {
+	var keywords [][2]string
+	for _, kv := range [][2]string{{"Source", m.Camera}, {"Creation Time", m.Date}, {"Copyright", m.Copyright}} {
+		if kv[1] != "" {
+			keywords = append(keywords, kv)
+		}
+	}
+	return keywords
+}
+
+// pngChunk returns the PNG chunk of the given type and data, with its length
+// and CRC
+func pngChunk(typ string, data []byte) []byte {
+	chunk := make([]byte, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], typ)
+	copy(chunk[8:], data)
+	binary.BigEndian.PutUint32(chunk[8+len(data):], crc32.ChecksumIEEE(chunk[4:8+len(data)]))
+	return chunk
+}
+
+// isASCII reports whether s can be stored as is in a tEXt chunk, which holds
+// Latin-1 text
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// addPNGMetadata inserts the text chunks of m into the PNG image data, after its
+// IHDR chunk: tEXt chunks for ASCII values, iTXt (UTF-8) chunks for the others
+func addPNGMetadata(data []byte, m Metadata) ([]byte, error) {
+	const ihdrEnd = 8 + 8 + 13 + 4 // signature, IHDR length and type, data and CRC
+	if len(data) < ihdrEnd || string(data[12:16]) != "IHDR" {
+		return nil, errors.New("png: invalid header")
+	}
+	var chunks []byte
+	for _, kv := range m.pngTextKeywords() {
+		keyword, value := kv[0], kv[1]
+		if isASCII(value) {
+			chunks = append(chunks, pngChunk("tEXt", []byte(keyword+"\x00"+value))...)
+			continue
+		}
+		if !utf8.ValidString(value) {
+			value = strings.ToValidUTF8(value, "�")
+		}
+		// no compression, and empty language tag and translated keyword
+		chunks = append(chunks, pngChunk("iTXt", []byte(keyword+"\x00\x00\x00\x00\x00"+value))...)
+	}
+	var out bytes.Buffer
+	out.Grow(len(data) + len(chunks))
+	out.Write(data[:ihdrEnd])
+	out.Write(chunks)
+	out.Write(data[ihdrEnd:])
+	return out.Bytes(), nil
+}
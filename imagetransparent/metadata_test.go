@@ -0,0 +1,126 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// exifTag is an ASCII tag of an IFD built by newEXIFJPEG
+type exifTag struct {
+	tag   uint16
+	value string
+}
+
+// newEXIFJPEG returns the start of a JPEG having an APP1 segment with a little
+// endian EXIF holding the ifd0 tags and, if any, an Exif IFD of the exifIFD tags
+func newEXIFJPEG(ifd0, exifIFD []exifTag) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	// writeIFD appends the IFD of the tags, their values following it, and a
+	// LONG pointer to the next one if next is set
+	var writeIFD func(tags []exifTag, next []exifTag)
+	writeIFD = func(tags []exifTag, next []exifTag) {
+		entries := len(tags)
+		if next != nil {
+			entries++
+		}
+		start := len(tiff)
+		valuesOffset := start + 2 + 12*entries + 4
+		tiff = binary.LittleEndian.AppendUint16(tiff, uint16(entries))
+		var values []byte
+		for _, t := range tags {
+			value := append([]byte(t.value), 0)
+			tiff = binary.LittleEndian.AppendUint16(tiff, t.tag)
+			tiff = binary.LittleEndian.AppendUint16(tiff, 2)
+			tiff = binary.LittleEndian.AppendUint32(tiff, uint32(len(value)))
+			if len(value) <= 4 {
+				tiff = append(tiff, append(value, make([]byte, 4-len(value))...)...)
+				continue
+			}
+			tiff = binary.LittleEndian.AppendUint32(tiff, uint32(valuesOffset+len(values)))
+			values = append(values, value...)
+		}
+		if next != nil {
+			tiff = binary.LittleEndian.AppendUint16(tiff, exifIFDTag)
+			tiff = binary.LittleEndian.AppendUint16(tiff, 4)
+			tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+			tiff = binary.LittleEndian.AppendUint32(tiff, uint32(valuesOffset+len(values)))
+		}
+		tiff = append(tiff, 0, 0, 0, 0)
+		tiff = append(tiff, values...)
+		if next != nil {
+			writeIFD(next, nil)
+		}
+	}
+	writeIFD(ifd0, exifIFD)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	data = binary.BigEndian.AppendUint16(data, uint16(len(segment)+2))
+	return append(append(data, segment...), 0xFF, 0xD9)
+}
+
+func TestReadMetadata(t *testing.T) {
+	data := newEXIFJPEG(
+		[]exifTag{
+			{exifMakeTag, "Canon"},
+			{exifModelTag, "Canon EOS 80D"},
+			{exifDateTimeTag, "2024:05:06 07:08:09"},
+			{exifCopyrightTag, "Jane Doe"},
+		},
+		[]exifTag{{exifDateTimeOriginalTag, "2024:01:02 03:04:05"}},
+	)
+	want := Metadata{Camera: "Canon EOS 80D", Date: "2024-01-02 03:04:05", Copyright: "Jane Doe"}
+	if got := ReadMetadata(data); got != want {
+		t.Errorf("ReadMetadata = %+v, want %+v", got, want)
+	}
+
+	// the make is added to the model, and the date is the modification one if
+	// there is no Exif IFD
+	data = newEXIFJPEG([]exifTag{{exifMakeTag, "NIKON"}, {exifModelTag, "D750"}, {exifDateTimeTag, "2024:05:06 07:08:09"}}, nil)
+	want = Metadata{Camera: "NIKON D750", Date: "2024-05-06 07:08:09"}
+	if got := ReadMetadata(data); got != want {
+		t.Errorf("ReadMetadata = %+v, want %+v", got, want)
+	}
+
+	if got := ReadMetadata([]byte("not an image")); !got.IsEmpty() {
+		t.Errorf("ReadMetadata of no EXIF = %+v, want empty", got)
+	}
+
+	// truncated EXIF: the header only, then the TIFF structure of the first
+	// JPEG cut anywhere, which mustn't panic
+	if got := ReadMetadata(exifJPEG([]byte("II*\x00"))); !got.IsEmpty() {
+		t.Errorf("ReadMetadata of a truncated EXIF header = %+v, want empty", got)
+	}
+	full := newEXIFJPEG([]exifTag{{exifMakeTag, "Canon"}, {exifCopyrightTag, "Jane Doe"}}, []exifTag{{exifDateTimeOriginalTag, "2024:01:02 03:04:05"}})
+	tiff := full[12 : len(full)-2]
+	for n := 0; n < len(tiff); n++ {
+		ReadMetadata(exifJPEG(tiff[:n]))
+	}
+}
+
+func TestEncodePNGMetadata(t *testing.T) {
+	img := newTestImage(8)
+	metadata := Metadata{Camera: "NIKON D750", Date: "2024-05-06 07:08:09", Copyright: "© Jane Doe"}
+	var buff bytes.Buffer
+	if err := EncodeImageWithOptions(&buff, img, ImageTypes.PNG, EncodeOptions{Metadata: metadata}); err != nil {
+		t.Fatal(err)
+	}
+	data := buff.Bytes()
+	for _, chunk := range []string{"tEXtSource\x00NIKON D750", "tEXtCreation Time\x002024-05-06", "iTXtCopyright\x00\x00\x00\x00\x00© Jane Doe"} {
+		if !bytes.Contains(data, []byte(chunk)) {
+			t.Errorf("PNG has no %q chunk", strings.SplitN(chunk, "\x00", 2)[0])
+		}
+	}
+	// the chunks have valid CRCs, otherwise decoding fails
+	decoded, err := png.Decode(&buff)
+	if err != nil {
+		t.Fatalf("png.Decode error: %v", err)
+	}
+	if decoded.Bounds() != image.Rect(0, 0, 8, 8) {
+		t.Errorf("decoded bounds = %v, want (0,0)-(8,8)", decoded.Bounds())
+	}
+}
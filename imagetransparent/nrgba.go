@@ -0,0 +1,33 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// ToNRGBA returns a copy of the result of MakeTransparent with non
+// alpha-premultiplied colors, which some tools expect. Unlike a conversion with
+// color.NRGBAModel, the pixels made transparent keep their original color
+// channels (MakeTransparent only clears their alpha) instead of becoming black,
+// and PNG encodes it as is.
+func ToNRGBA(img *image.RGBA) *image.NRGBA {
+	bounds := img.Bounds()
+	result := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := straightRGBAAt(img, x, y)
+			result.SetNRGBA(x, y, color.NRGBA{R: c.R, G: c.G, B: c.B, A: c.A})
+		}
+	}
+	return result
+}
+
+// ToNRGBA64 is the 16 bits per channel version of ToNRGBA, for the result of
+// MakeTransparent64; its transparent pixels are black, as MakeTransparent64
+// clears them
+func ToNRGBA64(img *image.RGBA64) *image.NRGBA64 {
+	result := image.NewNRGBA64(img.Bounds())
+	draw.Draw(result, result.Bounds(), img, img.Bounds().Min, draw.Src)
+	return result
+}
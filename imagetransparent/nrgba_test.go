@@ -0,0 +1,26 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestToNRGBA(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	img.SetRGBA(0, 0, color.RGBA{R: 200, G: 100, B: 50, A: 0}) // made transparent, keeping its color
+	img.SetRGBA(1, 0, color.RGBA{R: 64, G: 32, B: 0, A: 128})  // premultiplied
+	img.SetRGBA(2, 0, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+
+	result := ToNRGBA(img)
+	want := []color.NRGBA{
+		{R: 200, G: 100, B: 50, A: 0},
+		{R: 127, G: 63, B: 0, A: 128},
+		{R: 10, G: 20, B: 30, A: 255},
+	}
+	for x, w := range want {
+		if got := result.NRGBAAt(x, 0); got != w {
+			t.Errorf("pixel %d = %v, want %v", x, got, w)
+		}
+	}
+}
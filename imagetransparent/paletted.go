@@ -0,0 +1,99 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+)
+
+// MakeTransparentPaletted is like MakeTransparentCount for paletted images (GIFs
+// and some PNGs), but returns a paletted image which keeps the palette of img,
+// with the background pixels remapped to a transparent entry (see
+// transparentPaletteIndex). Since a palette entry is either transparent or not,
+// partially transparent pixels (see FeatherRadius, SoftEdges and
+// BackgroundAlpha) are made transparent if their alpha is below 128.
+func MakeTransparentPaletted(img *image.Paletted, opts Options) (*image.Paletted, int, error) {
+	if img.Bounds().Empty() {
+		return nil, 0, ErrEmptyImage
+	}
+	if err := CheckSize(img.Bounds().Dx(), img.Bounds().Dy(), opts.MaxPixels); err != nil {
+		return nil, 0, err
+	}
+	if changed, result, ok := makePalettedTransparent(img, &opts); ok {
+		if changed == 0 {
+			return nil, 0, ErrNotConverted
+		}
+		return result, changed, nil
+	}
+
+	stats, imageRGBA, err := makeBackgroundTransparent(img, &opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	changed := stats.PixelsChanged
+	if changed == 0 {
+		return nil, 0, notConverted(stats)
+	}
+	if opts.ReplaceWith != nil {
+		return filledPaletted(img, imageRGBA, *opts.ReplaceWith), changed, nil
+	}
+	return transparentPaletted(img, imageRGBA), changed, nil
+}
+
+// makePalettedTransparent is the fast path of makeBackgroundTransparent for
+// paletted images: the background colors are matched once per palette entry
+// instead of once per pixel, and the matching pixels are remapped to a
+// transparent palette entry, without expanding img to RGBA. It reports false if
+// opts need the pixels to be processed individually (Flood mode, feathering,
+// SoftEdges, Despeckle, MinBackgroundRegion, KeepLargest, BackgroundAlpha,
+// ReplaceWith, MatcherAt or the Gradient background mode).
+func makePalettedTransparent(img *image.Paletted, opts *Options) (int, *image.Paletted, bool) {
+	backgroundColors := opts.BackgroundColors
+	if len(backgroundColors) == 0 && opts.BackgroundMode == BackgroundModes.Gradient && opts.ChromaKey == nil {
+		return 0, nil, false
+	}
+	if opts.Mode == Modes.Flood || opts.FeatherRadius > 0 || opts.SoftEdges > 0 || opts.Despeckle > 0 || opts.MinBackgroundRegion > 0 || opts.KeepLargest > 0 || opts.MatcherAt != nil || opts.BackgroundAlpha > 0 || opts.ReplaceWith != nil {
+		return 0, nil, false
+	}
+	if len(backgroundColors) == 0 && opts.ChromaKey == nil {
+		detected, _ := DetectBackgroundColor(img, *opts)
+		// left to makeBackgroundTransparent, which reports it
+		if detected.A == 0 {
+			return 0, nil, false
+		}
+		backgroundColors = []color.RGBA{detected}
+	}
+
+	matches := make([]bool, len(img.Palette))
+	for i, c := range img.Palette {
+		sc := straightColor(c)
+		matches[i] = sc.A != 0 && opts.isBackground(&sc, backgroundColors)
+	}
+	background := func(index uint8) bool {
+		return int(index) < len(matches) && matches[index]
+	}
+
+	bounds := img.Bounds()
+	palette := make(color.Palette, len(img.Palette))
+	copy(palette, img.Palette)
+	result := image.NewPaletted(bounds, palette)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		copy(result.Pix[result.PixOffset(bounds.Min.X, y):], img.Pix[img.PixOffset(bounds.Min.X, y):img.PixOffset(bounds.Max.X, y)])
+	}
+	transparentIndex := transparentPaletteIndex(result, func(x, y int) bool {
+		return background(img.ColorIndexAt(x, y))
+	})
+
+	changed := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if background(img.ColorIndexAt(x, y)) {
+				result.SetColorIndex(x, y, transparentIndex)
+				changed++
+			}
+		}
+	}
+	if opts.Progress != nil {
+		opts.Progress(bounds.Dy(), bounds.Dy())
+	}
+	return changed, result, true
+}
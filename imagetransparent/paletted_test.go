@@ -0,0 +1,47 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestMakeTransparentPaletted(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	red := color.RGBA{R: 255, A: 255}
+	img := image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{white, red})
+	for y := 3; y <= 5; y++ {
+		for x := 3; x <= 5; x++ {
+			img.SetColorIndex(x, y, 1)
+		}
+	}
+
+	opts := DefaultOptions()
+	for _, mode := range []Mode{Modes.Global, Modes.Flood} {
+		opts.Mode = mode
+		result, changed, err := MakeTransparentPaletted(img, opts)
+		if err != nil {
+			t.Fatalf("%s mode: %v", mode, err)
+		}
+		if changed != 64-9 {
+			t.Errorf("%s mode: changed %d pixels, want %d", mode, changed, 64-9)
+		}
+		if len(result.Palette) != 3 || result.Palette[0] != img.Palette[0] || result.Palette[1] != img.Palette[1] {
+			t.Errorf("%s mode: palette = %v, want the original one with a transparent entry added", mode, result.Palette)
+		}
+		if _, _, _, a := result.At(0, 0).RGBA(); a != 0 {
+			t.Errorf("%s mode: background pixel alpha = %d, want 0", mode, a)
+		}
+		if i := result.ColorIndexAt(4, 4); i != 1 {
+			t.Errorf("%s mode: foreground pixel palette index = %d, want 1", mode, i)
+		}
+	}
+
+	sub := image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{white}).SubImage(image.Rect(1, 1, 3, 3)).(*image.Paletted)
+	for _, mode := range []Mode{Modes.Global, Modes.Flood} {
+		opts.Mode = mode
+		if _, changed, err := MakeTransparentPaletted(sub, opts); err != nil || changed != 4 {
+			t.Errorf("%s mode: sub-image: changed %d pixels (error %v), want 4", mode, changed, err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+)
+
+// checkerboard colors, the ones image editors show the transparent areas with
+var (
+	checkerboardLight = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	checkerboardDark  = color.RGBA{R: 204, G: 204, B: 204, A: 255}
+)
+
+// Checkerboard returns img composited over a white and light gray checkerboard
+// of size x size pixel squares, like image editors display transparency, so
+// that where the background was removed is obvious; the result is opaque. The
+// pixels are composited by hand rather than with draw.Over, since the ones made
+// transparent keep their color channels, which draw.Over would add to the
+// checkerboard.
+func Checkerboard(img image.Image, size int) *image.RGBA {
+	if size < 1 {
+		size = 1
+	}
+	bounds := img.Bounds()
+	preview := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			bg := checkerboardLight
+			if ((x-bounds.Min.X)/size+(y-bounds.Min.Y)/size)%2 == 1 {
+				bg = checkerboardDark
+			}
+			r, g, b, a := img.At(x, y).RGBA()
+			over := func(c uint32, bgC uint8) uint8 {
+				// the color channels can't exceed the alpha of premultiplied colors
+				if c > a {
+					c = a
+				}
+				return uint8((c + uint32(bgC)*0x101*(0xffff-a)/0xffff) >> 8)
+			}
+			preview.SetRGBA(x, y, color.RGBA{R: over(r, bg.R), G: over(g, bg.G), B: over(b, bg.B), A: 255})
+		}
+	}
+	return preview
+}
@@ -0,0 +1,133 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	xwebp "golang.org/x/image/webp"
+)
+
+// decoder decodes images of one type
+type decoder struct {
+	decode       func(io.Reader) (image.Image, error)
+	decodeConfig func(io.Reader) (image.Config, error)
+}
+
+// decoders of the supported image types, used by DecodeImageAs; the AVIF and
+// HEIC ones are added by the builds having the heif tag (see heif.go)
+var decoders = map[ImageType]decoder{
+	ImageTypes.JPEG: {jpeg.Decode, jpeg.DecodeConfig},
+	ImageTypes.PNG:  {png.Decode, png.DecodeConfig},
+	ImageTypes.BMP:  {bmp.Decode, bmp.DecodeConfig},
+	ImageTypes.TIFF: {tiff.Decode, tiff.DecodeConfig},
+	ImageTypes.GIF:  {gif.Decode, gif.DecodeConfig},
+	ImageTypes.WEBP: {xwebp.Decode, xwebp.DecodeConfig},
+	ImageTypes.ICO:  {DecodeICO, DecodeICOConfig},
+}
+
+// ErrDecoderUnavailable is returned (wrapped) when decoding AVIF or HEIC images
+// with a build which can't decode them - it has to be built with the heif tag
+var ErrDecoderUnavailable = errors.New("decoder not available - build with '-tags heif' to decode AVIF and HEIC images")
+
+// DecodeImage decodes the image data, in any of the supported formats. Images
+// having more than maxPixels pixels (0 means no limit) are rejected from their
+// header, before being decoded, with an error wrapping ErrTooLarge, as are the
+// ones whose header can't be read when there is a limit; CMYK images
+// are converted to RGBA (see ConvertCMYK). Animated WebP images are decoded as
+// their first frame (see DecodeWebPAnimation).
+func DecodeImage(data []byte, maxPixels int) (image.Image, error) {
+	return DecodeImageAs(data, "", maxPixels)
+}
+
+// DecodeImageAs is like DecodeImage, but decodes the data as the given image
+// type instead of detecting it from the data (which an empty imageType does)
+func DecodeImageAs(data []byte, imageType ImageType, maxPixels int) (image.Image, error) {
+	d := decoder{
+		decode: func(r io.Reader) (image.Image, error) {
+			img, _, err := image.Decode(r)
+			return img, err
+		},
+		decodeConfig: func(r io.Reader) (image.Config, error) {
+			config, _, err := image.DecodeConfig(r)
+			return config, err
+		},
+	}
+	if imageType == "" {
+		// image.Decode can't tell them from other files when not registered
+		if sniffed := SniffImageType(data); sniffed == ImageTypes.AVIF || sniffed == ImageTypes.HEIC {
+			imageType = sniffed
+		}
+	}
+	if imageType != "" {
+		var ok bool
+		if d, ok = decoders[imageType]; !ok {
+			if imageType == ImageTypes.AVIF || imageType == ImageTypes.HEIC {
+				return nil, fmt.Errorf("image type %s can't be decoded: %w", imageType, ErrDecoderUnavailable)
+			}
+			return nil, fmt.Errorf("image type %s is not supported", imageType)
+		}
+	}
+
+	// the size of animated WebP images is checked while decoding them, from
+	// their canvas, which golang.org/x/image/webp rejects when it is too large
+	animatedWebP := (imageType == "" || imageType == ImageTypes.WEBP) && IsAnimatedWebP(data)
+	if maxPixels > 0 && !animatedWebP {
+		config, err := d.decodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("error when reading the image header, to check its size: %w", err)
+		}
+		if err := CheckSize(config.Width, config.Height, maxPixels); err != nil {
+			return nil, err
+		}
+	}
+	if animatedWebP {
+		d.decode = func(io.Reader) (image.Image, error) {
+			anim, err := decodeWebPAnimation(data, 1, maxPixels)
+			if err != nil {
+				return nil, err
+			}
+			return anim.Frames[0], nil
+		}
+	}
+	img, err := d.decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return ConvertCMYK(img), nil
+}
+
+// Process reads an image in any of the supported formats from r, makes its
+// background transparent and writes the result to w in the given format, e.g. to
+// stream images from an HTTP request body to its response. JPEG and TIFF images
+// are oriented as indicated by their EXIF metadata (see Orient) and 16 bits per
+// channel images keep their depth (see MakeTransparent64).
+func Process(r io.Reader, w io.Writer, format ImageType, opts Options) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error when reading image: %w", err)
+	}
+	img, err := DecodeImage(data, opts.MaxPixels)
+	if err != nil {
+		return fmt.Errorf("error when decoding image: %w", err)
+	}
+	img = Orient(img, ExifOrientation(data))
+
+	var output image.Image
+	if IsDeep(img) {
+		output, _, err = MakeTransparent64(img, opts)
+	} else {
+		output, err = MakeTransparent(img, opts)
+	}
+	if err != nil {
+		return err
+	}
+	return EncodeImage(w, output, format)
+}
@@ -0,0 +1,71 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+)
+
+func TestProcess(t *testing.T) {
+	var in bytes.Buffer
+	if err := png.Encode(&in, newTestImage(16)); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := Process(bytes.NewReader(in.Bytes()), &out, ImageTypes.PNG, DefaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+	result, err := png.Decode(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := result.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("background pixel alpha = %d, want 0", a)
+	}
+	if _, _, _, a := result.At(8, 8).RGBA(); a != 0xffff {
+		t.Errorf("foreground pixel alpha = %d, want 0xffff", a)
+	}
+
+	opts := DefaultOptions()
+	opts.MaxPixels = 100
+	if err := Process(bytes.NewReader(in.Bytes()), &out, ImageTypes.PNG, opts); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Process of a 16x16 image with 100 max pixels returned %v, want ErrTooLarge", err)
+	}
+}
+
+func TestDecodeImageMaxPixels(t *testing.T) {
+	var in bytes.Buffer
+	if err := png.Encode(&in, image.NewRGBA(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeImage(in.Bytes(), 256); err != nil {
+		t.Errorf("DecodeImage of a 16x16 image with 256 max pixels error: %v", err)
+	}
+	if _, err := DecodeImage(in.Bytes(), 255); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("DecodeImage of a 16x16 image with 255 max pixels returned %v, want ErrTooLarge", err)
+	}
+
+	// a decoder whose header can't be read is not called when there is a limit
+	const fake ImageType = "fake"
+	decoded := false
+	decoders[fake] = decoder{
+		decode: func(io.Reader) (image.Image, error) {
+			decoded = true
+			return image.NewRGBA(image.Rect(0, 0, 1, 1)), nil
+		},
+		decodeConfig: func(io.Reader) (image.Config, error) {
+			return image.Config{}, errors.New("unreadable header")
+		},
+	}
+	defer delete(decoders, fake)
+	if _, err := DecodeImageAs(in.Bytes(), fake, DefaultMaxPixels); err == nil || decoded {
+		t.Errorf("DecodeImageAs of an unreadable header returned %v and decoded = %t, want an error and no decoding", err, decoded)
+	}
+	if _, err := DecodeImageAs(in.Bytes(), fake, 0); err != nil || !decoded {
+		t.Errorf("DecodeImageAs of an unreadable header with no limit returned %v and decoded = %t, want it decoded", err, decoded)
+	}
+}
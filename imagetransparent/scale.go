@@ -0,0 +1,19 @@
+package imagetransparent
+
+import (
+	"image"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Scale resizes img to width x height pixels with the Catmull-Rom resampler,
+// which keeps the edges sharp. The alpha channel is resampled too, with the
+// colors alpha-premultiplied; since the pixels made transparent by
+// MakeTransparent keep their color channels, which the resampler would blend
+// into the edges of the kept ones, they are cleared first (see ToRGBA64).
+func Scale(img image.Image, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	src := ToRGBA64(img)
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), xdraw.Src, nil)
+	return dst
+}
@@ -0,0 +1,47 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestScale(t *testing.T) {
+	// a black square on white, made transparent, then scaled down: the edges
+	// of the square have to stay black, without the white of the removed
+	// background blended in
+	img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(10, 10, 30, 30), image.Black, image.Point{}, draw.Src)
+	converted, err := MakeTransparent(img, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scaled := Scale(converted, 13, 13)
+	if scaled.Bounds() != image.Rect(0, 0, 13, 13) {
+		t.Fatalf("scaled bounds = %v, want 13 x 13", scaled.Bounds())
+	}
+	edges := 0
+	for y := 0; y < 13; y++ {
+		for x := 0; x < 13; x++ {
+			c := straightRGBAAt(scaled, x, y)
+			if c.A == 0 {
+				continue
+			}
+			if c.A < 255 {
+				edges++
+			}
+			if c.R > 2 || c.G > 2 || c.B > 2 {
+				t.Errorf("pixel (%d, %d) = %v, want black", x, y, c)
+			}
+		}
+	}
+	if edges == 0 {
+		t.Error("no partially transparent edge pixels, want some")
+	}
+	if got := scaled.RGBAAt(0, 0); got != (color.RGBA{}) {
+		t.Errorf("corner pixel = %v, want transparent", got)
+	}
+}
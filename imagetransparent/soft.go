@@ -0,0 +1,71 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+)
+
+// softenEdges makes the pixels of img which nearly match the background, being
+// less than opts.SoftEdges beyond the tolerance (see colorExcess), partially
+// transparent in proportion to how close they are to it. Only such pixels
+// connected (4-connected) to the transparent ones are softened, so colors of
+// the subject which are close to the background are kept. Returns the number of
+// pixels softened.
+func softenEdges(img *image.RGBA, opts *Options, excess func(x, y int, c *color.RGBA) float64) int {
+	band := float64(opts.SoftEdges)
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	visited := make([]bool, width*bounds.Dy())
+	var queue []image.Point
+
+	changed := 0
+	push := func(x, y int) {
+		if x < bounds.Min.X || x >= bounds.Max.X || y < bounds.Min.Y || y >= bounds.Max.Y {
+			return
+		}
+		i := (y-bounds.Min.Y)*width + (x - bounds.Min.X)
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		c := straightRGBAAt(img, x, y)
+		if c.A == 0 {
+			return
+		}
+		e := excess(x, y, &c)
+		if e >= band {
+			return
+		}
+		f := 0.0
+		if e > 0 {
+			f = e / band
+		}
+		p := img.RGBAAt(x, y)
+		img.SetRGBA(x, y, color.RGBA{
+			R: uint8(float64(p.R) * f),
+			G: uint8(float64(p.G) * f),
+			B: uint8(float64(p.B) * f),
+			A: uint8(float64(p.A) * f),
+		})
+		changed++
+		queue = append(queue, image.Point{x, y})
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if img.RGBAAt(x, y).A == 0 {
+				visited[(y-bounds.Min.Y)*width+(x-bounds.Min.X)] = true
+				queue = append(queue, image.Point{x, y})
+			}
+		}
+	}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		push(p.X+1, p.Y)
+		push(p.X-1, p.Y)
+		push(p.X, p.Y+1)
+		push(p.X, p.Y-1)
+	}
+	return changed
+}
@@ -0,0 +1,72 @@
+package imagetransparent
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// sweep contact sheet layout: the max size of a cell, the height of the label
+// above it and the gap around the cells, in pixels
+const (
+	sweepCellSize    = 480
+	sweepLabelHeight = 18
+	sweepGap         = 8
+)
+
+// ToleranceSweep returns a contact sheet of img with its background removed
+// with each of the given tolerances (used as both the Tolerance and the
+// UniformTolerance of opts), to pick the one giving the best cutout at a
+// glance. The results are arranged in a grid, composited over a checkerboard
+// of squareSize pixel squares (see Checkerboard) and labeled with their
+// tolerance; the ones larger than 480 pixels are scaled down.
+func ToleranceSweep(img image.Image, opts Options, tolerances []uint8, squareSize int) (*image.RGBA, error) {
+	if len(tolerances) == 0 {
+		return nil, errors.New("no tolerances to sweep")
+	}
+	if img.Bounds().Empty() {
+		return nil, ErrEmptyImage
+	}
+	size := img.Bounds().Size()
+	if size.X > sweepCellSize || size.Y > sweepCellSize {
+		f := math.Min(float64(sweepCellSize)/float64(size.X), float64(sweepCellSize)/float64(size.Y))
+		size = image.Point{int(math.Max(1, math.Round(float64(size.X)*f))), int(math.Max(1, math.Round(float64(size.Y)*f)))}
+	}
+	columns := int(math.Ceil(math.Sqrt(float64(len(tolerances)))))
+	rows := (len(tolerances) + columns - 1) / columns
+	cellStep := image.Point{size.X + sweepGap, size.Y + sweepLabelHeight + sweepGap}
+	sheet := image.NewRGBA(image.Rect(0, 0, sweepGap+columns*cellStep.X, sweepGap+rows*cellStep.Y))
+	draw.Draw(sheet, sheet.Bounds(), image.White, image.Point{}, draw.Src)
+	drawer := &font.Drawer{Dst: sheet, Src: image.Black, Face: basicfont.Face7x13}
+
+	for i, tolerance := range tolerances {
+		cellOpts := opts
+		cellOpts.Tolerance, cellOpts.UniformTolerance = tolerance, tolerance
+		converted, _, err := MakeTransparentCount(img, cellOpts)
+		var result image.Image = converted
+		if errors.Is(err, ErrNotConverted) {
+			result = img
+		} else if err != nil {
+			return nil, fmt.Errorf("error when removing the background with tolerance %d: %w", tolerance, err)
+		}
+		if result.Bounds().Size() != size {
+			result = Scale(result, size.X, size.Y)
+		}
+
+		origin := image.Point{sweepGap + i%columns*cellStep.X, sweepGap + i/columns*cellStep.Y}
+		drawer.Dot = fixed.P(origin.X, origin.Y+sweepLabelHeight-5)
+		drawer.DrawString(fmt.Sprintf("tolerance %d", tolerance))
+		cell := image.Rectangle{Min: origin.Add(image.Point{0, sweepLabelHeight}), Max: origin.Add(image.Point{size.X, sweepLabelHeight + size.Y})}
+		// a gray frame around the cell, so that where the image ends is clear
+		draw.Draw(sheet, cell.Inset(-1), image.NewUniform(color.RGBA{R: 128, G: 128, B: 128, A: 255}), image.Point{}, draw.Src)
+		draw.Draw(sheet, cell, Checkerboard(result, squareSize), result.Bounds().Min, draw.Src)
+	}
+	return sheet, nil
+}
@@ -0,0 +1,73 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestToleranceSweep(t *testing.T) {
+	// a white background with a light gray square, removed only with the
+	// larger tolerance
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	gray := color.RGBA{R: 200, G: 200, B: 200, A: 255}
+	draw.Draw(img, image.Rect(3, 3, 7, 7), image.NewUniform(gray), image.Point{}, draw.Src)
+
+	sheet, err := ToleranceSweep(img, DefaultOptions(), []uint8{10, 100, 20}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2 columns and 2 rows of cells
+	want := image.Rect(0, 0, sweepGap+2*(10+sweepGap), sweepGap+2*(10+sweepLabelHeight+sweepGap))
+	if sheet.Bounds() != want {
+		t.Fatalf("sheet bounds = %v, want %v", sheet.Bounds(), want)
+	}
+	cell := func(i int) image.Point {
+		return image.Point{sweepGap + i%2*(10+sweepGap), sweepGap + i/2*(10+sweepLabelHeight+sweepGap) + sweepLabelHeight}
+	}
+	for i, wantGray := range []bool{true, false, true} {
+		p := cell(i).Add(image.Point{5, 5})
+		if got := sheet.RGBAAt(p.X, p.Y) == gray; got != wantGray {
+			t.Errorf("cell %d center = %v, want gray %t", i, sheet.RGBAAt(p.X, p.Y), wantGray)
+		}
+	}
+
+	if _, err := ToleranceSweep(img, DefaultOptions(), nil, 1); err == nil {
+		t.Error("ToleranceSweep of no tolerances returned no error")
+	}
+}
+
+func TestToleranceSweepScaledEdges(t *testing.T) {
+	// a black square on a red background, larger than a cell: the edges of
+	// the scaled cutout, over the gray checkerboard, have to stay gray,
+	// without the red of the removed background blended in
+	img := image.NewRGBA(image.Rect(0, 0, 500, 500))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(101, 101, 399, 399), image.Black, image.Point{}, draw.Src)
+
+	sheet, err := ToleranceSweep(img, DefaultOptions(), []uint8{50}, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cell := image.Rect(0, 0, sweepCellSize, sweepCellSize).Add(image.Point{sweepGap, sweepGap + sweepLabelHeight})
+	if want := cell.Max.Add(image.Point{sweepGap, sweepGap}); sheet.Bounds().Max != want {
+		t.Fatalf("sheet size = %v, want %v", sheet.Bounds().Max, want)
+	}
+	blended := 0
+	for y := cell.Min.Y; y < cell.Max.Y; y++ {
+		for x := cell.Min.X; x < cell.Max.X; x++ {
+			c := sheet.RGBAAt(x, y)
+			if int(c.R) > int(c.G)+1 {
+				t.Fatalf("cell pixel (%d, %d) = %v, want gray", x, y, c)
+			}
+			if c.R != 0 && c.R != checkerboardLight.R && c.R != checkerboardDark.R {
+				blended++
+			}
+		}
+	}
+	if blended == 0 {
+		t.Error("no edge pixels blended with the checkerboard, want some")
+	}
+}
@@ -0,0 +1,48 @@
+package imagetransparent
+
+import (
+	"fmt"
+)
+
+// tiffPageOffsets returns the offsets of the IFDs (one per page) chained from
+// the header of the TIFF data; nil if data is not a TIFF
+func tiffPageOffsets(data []byte) []uint32 {
+	if len(data) < 8 || SniffImageType(data) != ImageTypes.TIFF {
+		return nil
+	}
+	e, _ := findEXIF(data)
+	var offsets []uint32
+	seen := make(map[uint32]bool)
+	for offset := e.order.Uint32(data[4:]); offset >= 8 && int(offset)+2 <= len(data) && !seen[offset]; {
+		seen[offset] = true
+		offsets = append(offsets, offset)
+		next := int(offset) + 2 + 12*int(e.order.Uint16(data[offset:]))
+		if next+4 > len(data) {
+			break
+		}
+		offset = e.order.Uint32(data[next:])
+	}
+	return offsets
+}
+
+// TIFFPageCount returns the number of pages of the TIFF data; 0 if data is not
+// a TIFF
+func TIFFPageCount(data []byte) int {
+	return len(tiffPageOffsets(data))
+}
+
+// TIFFPage returns the given page (0-based) of the multi-page TIFF data as a
+// single page TIFF, which can be decoded e.g. with DecodeImage (the TIFF decoder
+// only decodes the first page). It is a copy of data whose header points to the
+// page, so it has the size of the whole data.
+func TIFFPage(data []byte, page int) ([]byte, error) {
+	offsets := tiffPageOffsets(data)
+	if page < 0 || page >= len(offsets) {
+		return nil, fmt.Errorf("TIFF page %d is out of range - the TIFF has %d pages", page, len(offsets))
+	}
+	e, _ := findEXIF(data)
+	pageData := make([]byte, len(data))
+	copy(pageData, data)
+	e.order.PutUint32(pageData[4:], offsets[page])
+	return pageData, nil
+}
@@ -0,0 +1,82 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+func TestEncodeTIFFCompression(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 4))
+	for x := 0; x < 8; x++ {
+		img.SetNRGBA(x, 1, color.NRGBA{R: uint8(30 * x), G: 100, B: 200, A: 255})
+	}
+	const compressionTag, predictorTag = 259, 317
+	// the Compression tag values of the TIFF specification
+	for compression, want := range map[tiff.CompressionType]uint16{tiff.Uncompressed: 1, tiff.Deflate: 8} {
+		var buff bytes.Buffer
+		opts := EncodeOptions{TIFFCompression: compression}
+		if err := EncodeImageWithOptions(&buff, img, ImageTypes.TIFF, opts); err != nil {
+			t.Fatal(err)
+		}
+		e, ok := findEXIF(buff.Bytes())
+		if !ok {
+			t.Fatalf("compression %d: no TIFF header", compression)
+		}
+		if typ, _, value, ok := e.tag(compressionTag); !ok || typ != 3 || e.order.Uint16(value) != want {
+			t.Errorf("compression %d: Compression tag = %v (found %t), want %d", compression, value, ok, want)
+		}
+		if _, _, _, ok := e.tag(predictorTag); ok {
+			t.Errorf("compression %d: Predictor tag written, want none", compression)
+		}
+		decoded, err := tiff.Decode(&buff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for x := 0; x < 8; x++ {
+			if got, want := color.NRGBAModel.Convert(decoded.At(x, 1)), img.NRGBAAt(x, 1); got != want {
+				t.Errorf("compression %d: pixel (%d, 1) = %v, want %v", compression, x, got, want)
+			}
+		}
+	}
+}
+
+func TestTIFFPages(t *testing.T) {
+	// a little endian TIFF with 3 chained IFDs, of 0 entries each
+	data := []byte("II*\x00\x08\x00\x00\x00")
+	for _, next := range []uint32{14, 20, 0} {
+		ifd := make([]byte, 6)
+		binary.LittleEndian.PutUint32(ifd[2:], next)
+		data = append(data, ifd...)
+	}
+
+	if n := TIFFPageCount(data); n != 3 {
+		t.Fatalf("TIFFPageCount = %d, want 3", n)
+	}
+	page, err := TIFFPage(data, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset := binary.LittleEndian.Uint32(page[4:]); offset != 20 {
+		t.Errorf("page 2 IFD offset = %d, want 20", offset)
+	}
+	if offset := binary.LittleEndian.Uint32(data[4:]); offset != 8 {
+		t.Errorf("TIFFPage changed the first IFD offset of the data to %d", offset)
+	}
+	if _, err := TIFFPage(data, 3); err == nil {
+		t.Error("TIFFPage of a page out of range returned no error")
+	}
+
+	// an IFD chained to itself
+	binary.LittleEndian.PutUint32(data[8+2:], 8)
+	if n := TIFFPageCount(data); n != 1 {
+		t.Errorf("TIFFPageCount of a looping IFD chain = %d, want 1", n)
+	}
+	if n := TIFFPageCount([]byte{0xFF, 0xD8, 0xFF}); n != 0 {
+		t.Errorf("TIFFPageCount of a JPEG = %d, want 0", n)
+	}
+}
@@ -0,0 +1,50 @@
+package imagetransparent
+
+import (
+	"fmt"
+	"image"
+)
+
+// Flip ...
+type Flip string
+
+// Flips of the images (see Transform): Horizontal mirrors the left and right
+// sides, Vertical the top and bottom ones
+var Flips = struct {
+	None       Flip
+	Horizontal Flip
+	Vertical   Flip
+}{
+	None:       "",
+	Horizontal: "h",
+	Vertical:   "v",
+}
+
+// transformOrientations are the EXIF orientations (see Orient) of the
+// rotations, followed by no flip, a horizontal one and a vertical one
+var transformOrientations = map[int][3]int{
+	0:   {1, 2, 4},
+	90:  {6, 5, 7},
+	180: {3, 4, 2},
+	270: {8, 7, 5},
+}
+
+// Transform rotates img clockwise by the given degrees (0, 90, 180 or 270),
+// then flips it, in a single pass over its pixels, e.g. to straighten it. 16 bits
+// per channel images (see IsDeep) keep their depth.
+func Transform(img image.Image, rotate int, flip Flip) (image.Image, error) {
+	orientations, ok := transformOrientations[rotate]
+	if !ok {
+		return nil, fmt.Errorf("rotation has to be 0, 90, 180 or 270 degrees - got %d", rotate)
+	}
+	switch flip {
+	case Flips.None:
+		return Orient(img, orientations[0]), nil
+	case Flips.Horizontal:
+		return Orient(img, orientations[1]), nil
+	case Flips.Vertical:
+		return Orient(img, orientations[2]), nil
+	default:
+		return nil, fmt.Errorf("flip has to be h or v - got %s", flip)
+	}
+}
@@ -0,0 +1,47 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	// a 3x2 image with a red top-left pixel
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	red := color.RGBA{R: 255, A: 255}
+	img.SetRGBA(0, 0, red)
+
+	tests := []struct {
+		rotate int
+		flip   Flip
+		size   image.Point
+		red    image.Point
+	}{
+		{0, Flips.None, image.Pt(3, 2), image.Pt(0, 0)},
+		{90, Flips.None, image.Pt(2, 3), image.Pt(1, 0)},
+		{180, Flips.None, image.Pt(3, 2), image.Pt(2, 1)},
+		{270, Flips.None, image.Pt(2, 3), image.Pt(0, 2)},
+		{0, Flips.Horizontal, image.Pt(3, 2), image.Pt(2, 0)},
+		{0, Flips.Vertical, image.Pt(3, 2), image.Pt(0, 1)},
+		{90, Flips.Horizontal, image.Pt(2, 3), image.Pt(0, 0)},
+		{90, Flips.Vertical, image.Pt(2, 3), image.Pt(1, 2)},
+		{270, Flips.Vertical, image.Pt(2, 3), image.Pt(0, 0)},
+	}
+	for _, tt := range tests {
+		got, err := Transform(img, tt.rotate, tt.flip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := got.Bounds().Size(); size != tt.size {
+			t.Errorf("rotate %d, flip %q: size %v, want %v", tt.rotate, tt.flip, size, tt.size)
+		}
+		if c := color.RGBAModel.Convert(got.At(tt.red.X, tt.red.Y)); c != red {
+			t.Errorf("rotate %d, flip %q: pixel %v = %v, want red", tt.rotate, tt.flip, tt.red, c)
+		}
+	}
+
+	if _, err := Transform(img, 45, Flips.None); err == nil {
+		t.Error("Transform by 45 degrees error = nil, want an error")
+	}
+}
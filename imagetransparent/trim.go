@@ -0,0 +1,67 @@
+package imagetransparent
+
+import (
+	"image"
+	"image/draw"
+)
+
+// OpaqueBounds returns the bounding box of the pixels of img which are not
+// fully transparent; it is empty if all of them are
+func OpaqueBounds(img image.Image) image.Rectangle {
+	transparent := func(x, y int) bool {
+		_, _, _, a := img.At(x, y).RGBA()
+		return a == 0
+	}
+	if rgba, ok := img.(*image.RGBA); ok {
+		transparent = func(x, y int) bool {
+			return rgba.RGBAAt(x, y).A == 0
+		}
+	}
+
+	bounds := img.Bounds()
+	box := image.Rectangle{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if transparent(x, y) {
+				continue
+			}
+			box = box.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	return box
+}
+
+// trimBox returns the OpaqueBounds of img extended by padding pixels on each
+// side (within the bounds of img), or an empty rectangle if all its pixels are
+// transparent
+func trimBox(img image.Image, padding int) image.Rectangle {
+	box := OpaqueBounds(img)
+	if box.Empty() {
+		return box
+	}
+	return image.Rect(box.Min.X-padding, box.Min.Y-padding, box.Max.X+padding, box.Max.Y+padding).Intersect(img.Bounds())
+}
+
+// Trim crops img to the bounding box of its pixels which are not fully
+// transparent, extended by padding pixels on each side (within the bounds of
+// img). If all the pixels are transparent img is returned as is.
+func Trim(img *image.RGBA, padding int) *image.RGBA {
+	box := trimBox(img, padding)
+	if box.Empty() {
+		return img
+	}
+	trimmed := image.NewRGBA(image.Rect(0, 0, box.Dx(), box.Dy()))
+	draw.Draw(trimmed, trimmed.Bounds(), img, box.Min, draw.Src)
+	return trimmed
+}
+
+// Trim64 is the 16 bits per channel version of Trim
+func Trim64(img *image.RGBA64, padding int) *image.RGBA64 {
+	box := trimBox(img, padding)
+	if box.Empty() {
+		return img
+	}
+	trimmed := image.NewRGBA64(image.Rect(0, 0, box.Dx(), box.Dy()))
+	draw.Draw(trimmed, trimmed.Bounds(), img, box.Min, draw.Src)
+	return trimmed
+}
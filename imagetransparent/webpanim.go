@@ -0,0 +1,286 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+
+	xwebp "golang.org/x/image/webp"
+)
+
+// WebPAnimation holds the frames of an animated WebP image, as they are
+// displayed: each one composited on the canvas over the previous ones
+type WebPAnimation struct {
+	// Frames are as large as the canvas
+	Frames []*image.RGBA
+	// Delays are the durations of the frames, in milliseconds
+	Delays []int
+	// LoopCount is the number of times the animation is played, 0 meaning forever
+	LoopCount int
+}
+
+// webpChunk is a chunk of a RIFF (WebP) file
+type webpChunk struct {
+	id   string
+	data []byte
+}
+
+// webpChunks splits the chunks of the given RIFF payload (the data following
+// the "WEBP" form type, or the frame data of an ANMF chunk)
+func webpChunks(data []byte) ([]webpChunk, error) {
+	var chunks []webpChunk
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, errors.New("webp: invalid chunk header")
+		}
+		size := binary.LittleEndian.Uint32(data[4:8])
+		if uint64(size) > uint64(len(data)-8) {
+			return nil, errors.New("webp: chunk data out of bounds")
+		}
+		chunks = append(chunks, webpChunk{id: string(data[:4]), data: data[8 : 8+size]})
+		// the chunks are padded to an even size
+		next := 8 + int(size) + int(size&1)
+		if next > len(data) {
+			next = len(data)
+		}
+		data = data[next:]
+	}
+	return chunks, nil
+}
+
+// uint24 decodes the 3 bytes little endian number at the start of b
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+// IsAnimatedWebP reports whether data is an animated WebP image, which
+// golang.org/x/image/webp can't decode (see DecodeWebPAnimation)
+func IsAnimatedWebP(data []byte) bool {
+	const animationBit = 1 << 1
+	return len(data) >= 21 && string(data[0:4]) == "RIFF" && string(data[8:16]) == "WEBPVP8X" && data[20]&animationBit != 0
+}
+
+// DecodeWebPAnimation decodes all the frames of an animated WebP image. Each
+// frame is decoded with golang.org/x/image/webp, as a still image, and
+// composited on the canvas as configured by its blending and disposal methods;
+// the canvas starts transparent, as most viewers ignore the background color.
+// Like for DecodeImage, animations whose canvas has more than maxPixels pixels
+// (0 means no limit) are rejected from their header, with an error wrapping
+// ErrTooLarge.
+func DecodeWebPAnimation(data []byte, maxPixels int) (*WebPAnimation, error) {
+	return decodeWebPAnimation(data, 0, maxPixels)
+}
+
+// decodeWebPAnimation is like DecodeWebPAnimation, but stops after maxFrames
+// frames (0 means all of them)
+func decodeWebPAnimation(data []byte, maxFrames, maxPixels int) (*WebPAnimation, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("webp: invalid header")
+	}
+	size := int(binary.LittleEndian.Uint32(data[4:8]))
+	if size < 4 || size > len(data)-8 {
+		size = len(data) - 8
+	}
+	chunks, err := webpChunks(data[12 : 8+size])
+	if err != nil {
+		return nil, err
+	}
+
+	anim := &WebPAnimation{}
+	var canvas *image.RGBA
+	for _, chunk := range chunks {
+		if maxFrames > 0 && len(anim.Frames) == maxFrames {
+			break
+		}
+		switch chunk.id {
+		case "VP8X":
+			if len(chunk.data) < 10 {
+				return nil, errors.New("webp: invalid VP8X chunk")
+			}
+			width, height := uint24(chunk.data[4:])+1, uint24(chunk.data[7:])+1
+			if err := CheckSize(width, height, maxPixels); err != nil {
+				return nil, err
+			}
+			canvas = image.NewRGBA(image.Rect(0, 0, width, height))
+		case "ANIM":
+			if len(chunk.data) >= 6 {
+				anim.LoopCount = int(binary.LittleEndian.Uint16(chunk.data[4:6]))
+			}
+		case "ANMF":
+			if canvas == nil || len(chunk.data) < 16 {
+				return nil, errors.New("webp: invalid ANMF chunk")
+			}
+			d := chunk.data
+			offset := image.Point{2 * uint24(d[0:]), 2 * uint24(d[3:])}
+			r := image.Rectangle{Min: offset, Max: offset.Add(image.Point{uint24(d[6:]) + 1, uint24(d[9:]) + 1})}
+			if !r.In(canvas.Bounds()) {
+				return nil, fmt.Errorf("webp: frame %d out of the canvas", len(anim.Frames))
+			}
+			frame, err := decodeWebPFrame(d[16:], r.Size())
+			if err != nil {
+				return nil, fmt.Errorf("error when decoding frame %d: %w", len(anim.Frames), err)
+			}
+			const disposeBit, noBlendBit = 1 << 0, 1 << 1
+			op := draw.Over
+			if d[15]&noBlendBit != 0 {
+				op = draw.Src
+			}
+			draw.Draw(canvas, r, frame, frame.Bounds().Min, op)
+			snapshot := image.NewRGBA(canvas.Bounds())
+			copy(snapshot.Pix, canvas.Pix)
+			anim.Frames = append(anim.Frames, snapshot)
+			anim.Delays = append(anim.Delays, uint24(d[12:]))
+			if d[15]&disposeBit != 0 {
+				draw.Draw(canvas, r, image.Transparent, image.Point{}, draw.Src)
+			}
+		}
+	}
+	if len(anim.Frames) == 0 {
+		return nil, errors.New("webp: no animation frames")
+	}
+	return anim, nil
+}
+
+// decodeWebPFrame decodes the frame data of an ANMF chunk (an optional ALPH
+// chunk and a VP8 one, or a VP8L one) of the given size, by wrapping it in a
+// still WebP image; the size of the bitstream is checked before decoding it,
+// so that a frame can't be larger than its rectangle in the canvas
+func decodeWebPFrame(frameData []byte, size image.Point) (image.Image, error) {
+	chunks, err := webpChunks(frameData)
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range chunks {
+		if chunk.id != "VP8 " && chunk.id != "VP8L" {
+			continue
+		}
+		if bitstreamSize, ok := webpBitstreamSize(chunk); !ok || bitstreamSize != size {
+			return nil, errors.New("webp: frame size mismatch")
+		}
+	}
+	const alphaBit = 1 << 4
+	vp8x := make([]byte, 18)
+	copy(vp8x, "VP8X")
+	binary.LittleEndian.PutUint32(vp8x[4:8], 10)
+	for _, chunk := range chunks {
+		if chunk.id == "ALPH" {
+			vp8x[8] |= alphaBit
+		}
+	}
+	w, h := size.X-1, size.Y-1
+	copy(vp8x[12:15], []byte{byte(w), byte(w >> 8), byte(w >> 16)})
+	copy(vp8x[15:18], []byte{byte(h), byte(h >> 8), byte(h >> 16)})
+
+	var still bytes.Buffer
+	still.WriteString("RIFF")
+	binary.Write(&still, binary.LittleEndian, uint32(4+len(vp8x)+len(frameData)))
+	still.WriteString("WEBP")
+	still.Write(vp8x)
+	still.Write(frameData)
+	frame, err := xwebp.Decode(&still)
+	if err != nil {
+		return nil, err
+	}
+	if frame.Bounds().Size() != size {
+		return nil, errors.New("webp: frame size mismatch")
+	}
+	return frame, nil
+}
+
+// webpBitstreamSize returns the size of the image of a VP8 (lossy) or VP8L
+// (lossless) chunk, from its header
+func webpBitstreamSize(chunk webpChunk) (image.Point, bool) {
+	d := chunk.data
+	switch {
+	case chunk.id == "VP8 " && len(d) >= 10 && d[3] == 0x9d && d[4] == 0x01 && d[5] == 0x2a:
+		// a 3 bytes frame tag, a start code and 14 bits dimensions
+		return image.Point{int(binary.LittleEndian.Uint16(d[6:]) & 0x3fff), int(binary.LittleEndian.Uint16(d[8:]) & 0x3fff)}, true
+	case chunk.id == "VP8L" && len(d) >= 5 && d[0] == 0x2f:
+		// a signature and 14 bits dimensions minus one
+		bits := binary.LittleEndian.Uint32(d[1:])
+		return image.Point{int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1}, true
+	}
+	return image.Point{}, false
+}
+
+// MakeTransparentWebPAnimation makes the background of every frame of anim
+// transparent, in place. Like for MakeTransparentGIF, the background colors are
+// the same for all the frames: opts.BackgroundColors or, if there are none, the
+// one detected from the first frame. Returns the number of pixels made
+// transparent in all the frames.
+func MakeTransparentWebPAnimation(anim *WebPAnimation, opts Options) (int, error) {
+	if len(anim.Frames) == 0 {
+		return 0, ErrNotConverted
+	}
+	if len(opts.BackgroundColors) == 0 && opts.BackgroundMode != BackgroundModes.Gradient && opts.ChromaKey == nil {
+		detected, _ := DetectBackgroundColor(anim.Frames[0], opts)
+		if detected.A == 0 {
+			return 0, ErrAlreadyTransparent
+		}
+		opts.BackgroundColors = []color.RGBA{detected}
+	}
+
+	total := 0
+	for i, frame := range anim.Frames {
+		result, changed, err := MakeTransparentCount(frame, opts)
+		if errors.Is(err, ErrNotConverted) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error when processing frame %d: %w", i, err)
+		}
+		total += changed
+		anim.Frames[i] = result
+	}
+	if total == 0 {
+		return 0, ErrNotConverted
+	}
+	return total, nil
+}
+
+// GIF converts anim to an animated GIF: the frames are dithered to the web
+// safe palette, with a transparent entry added for the pixels whose alpha is
+// below 128, and are disposed to the background so that the previous ones don't
+// show through their transparent pixels
+func (anim *WebPAnimation) GIF() *gif.GIF {
+	// GIF loops LoopCount+1 times, -1 meaning once
+	g := &gif.GIF{LoopCount: anim.LoopCount - 1}
+	if anim.LoopCount == 0 {
+		g.LoopCount = 0
+	}
+	for i, frame := range anim.Frames {
+		bounds := frame.Bounds()
+		// dither the colors the pixels had before being made transparent, so
+		// that their alpha doesn't spread into the kept ones
+		opaque := image.NewRGBA(bounds)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := straightRGBAAt(frame, x, y)
+				c.A = 255
+				opaque.SetRGBA(x, y, c)
+			}
+		}
+		paletted := image.NewPaletted(bounds, append(color.Palette(nil), palette.WebSafe...))
+		draw.FloydSteinberg.Draw(paletted, bounds, opaque, bounds.Min)
+		paletted.Palette = append(paletted.Palette, color.RGBA{})
+		transparentIndex := uint8(len(paletted.Palette) - 1)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if frame.RGBAAt(x, y).A < 128 {
+					paletted.SetColorIndex(x, y, transparentIndex)
+				}
+			}
+		}
+		g.Image = append(g.Image, paletted)
+		// GIF delays are in hundredths of a second
+		g.Delay = append(g.Delay, (anim.Delays[i]+5)/10)
+		g.Disposal = append(g.Disposal, gif.DisposalBackground)
+	}
+	return g
+}
@@ -0,0 +1,181 @@
+package imagetransparent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// vp8lSolid returns a VP8L (lossless WebP) bitstream of a w x h image of the
+// color c: each channel is a single symbol prefix code, so no bit is needed per
+// pixel
+func vp8lSolid(w, h int, c color.NRGBA) []byte {
+	var out []byte
+	var acc uint64
+	n := uint(0)
+	write := func(v uint64, bits uint) {
+		acc |= v << n
+		n += bits
+		for n >= 8 {
+			out = append(out, byte(acc))
+			acc >>= 8
+			n -= 8
+		}
+	}
+	write(0x2f, 8)
+	write(uint64(w-1), 14)
+	write(uint64(h-1), 14)
+	write(1, 1) // alpha is used
+	write(0, 3) // version
+	write(0, 1) // no transform
+	write(0, 1) // no color cache
+	write(0, 1) // no meta prefix codes
+	// green, red, blue, alpha and distance codes
+	for _, symbol := range []uint8{c.G, c.R, c.B, c.A, 0} {
+		write(1, 1) // simple code
+		write(0, 1) // 1 symbol
+		write(1, 1) // 8 bits symbol
+		write(uint64(symbol), 8)
+	}
+	write(0, 7)
+	return out
+}
+
+// webpChunkBytes returns the RIFF chunk having the given id and data
+func webpChunkBytes(id string, data []byte) []byte {
+	chunk := append([]byte(id), make([]byte, 4)...)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// putUint24 appends v to b as a 3 bytes little endian number
+func putUint24(b []byte, v int) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16))
+}
+
+// testWebPFrame is a solid colored frame of an animated WebP
+type testWebPFrame struct {
+	r        image.Rectangle
+	c        color.NRGBA
+	duration int
+	flags    byte
+}
+
+// newAnimatedWebP returns an animated WebP image of the given frames
+func newAnimatedWebP(width, height, loopCount int, frames []testWebPFrame) []byte {
+	vp8x := []byte{1<<1 | 1<<4, 0, 0, 0}
+	vp8x = putUint24(putUint24(vp8x, width-1), height-1)
+	body := append([]byte("WEBP"), webpChunkBytes("VP8X", vp8x)...)
+	anim := []byte{0, 0, 0, 0, byte(loopCount), byte(loopCount >> 8)}
+	body = append(body, webpChunkBytes("ANIM", anim)...)
+	for _, f := range frames {
+		var anmf []byte
+		anmf = putUint24(anmf, f.r.Min.X/2)
+		anmf = putUint24(anmf, f.r.Min.Y/2)
+		anmf = putUint24(anmf, f.r.Dx()-1)
+		anmf = putUint24(anmf, f.r.Dy()-1)
+		anmf = putUint24(anmf, f.duration)
+		anmf = append(anmf, f.flags)
+		anmf = append(anmf, webpChunkBytes("VP8L", vp8lSolid(f.r.Dx(), f.r.Dy(), f.c))...)
+		body = append(body, webpChunkBytes("ANMF", anmf)...)
+	}
+	return webpChunkBytes("RIFF", body)
+}
+
+func TestDecodeWebPAnimation(t *testing.T) {
+	white := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	red := color.NRGBA{R: 255, A: 255}
+	// a white background, then a red square over it in the bottom-right corner
+	// which is disposed, then a blue one in the top-left corner
+	data := newAnimatedWebP(4, 4, 3, []testWebPFrame{
+		{image.Rect(0, 0, 4, 4), white, 100, 0},
+		{image.Rect(2, 2, 4, 4), red, 50, 1},
+		{image.Rect(0, 0, 2, 2), color.NRGBA{B: 255, A: 255}, 70, 0},
+	})
+	if !IsAnimatedWebP(data) {
+		t.Fatal("IsAnimatedWebP = false, want true")
+	}
+
+	anim, err := DecodeWebPAnimation(data, 0)
+	if err != nil {
+		t.Fatalf("DecodeWebPAnimation error: %v", err)
+	}
+	if len(anim.Frames) != 3 || anim.LoopCount != 3 || anim.Delays[1] != 50 {
+		t.Fatalf("%d frames, loop count %d, delays %v, want 3 frames, loop count 3, delays [100 50 70]", len(anim.Frames), anim.LoopCount, anim.Delays)
+	}
+	tests := []struct {
+		frame, x, y int
+		want        color.RGBA
+	}{
+		{0, 3, 3, color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+		{1, 3, 3, color.RGBA{R: 255, A: 255}},
+		{1, 0, 0, color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+		// the red square was disposed to transparent
+		{2, 3, 3, color.RGBA{}},
+		{2, 0, 0, color.RGBA{B: 255, A: 255}},
+	}
+	for _, tt := range tests {
+		if got := anim.Frames[tt.frame].RGBAAt(tt.x, tt.y); got != tt.want {
+			t.Errorf("frame %d pixel (%d, %d) = %v, want %v", tt.frame, tt.x, tt.y, got, tt.want)
+		}
+	}
+
+	// still images get the first frame
+	img, err := DecodeImage(data, 0)
+	if err != nil {
+		t.Fatalf("DecodeImage error: %v", err)
+	}
+	if got := color.RGBAModel.Convert(img.At(3, 3)); got != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Errorf("first frame pixel (3, 3) = %v, want white", got)
+	}
+
+	changed, err := MakeTransparentWebPAnimation(anim, DefaultOptions())
+	if err != nil {
+		t.Fatalf("MakeTransparentWebPAnimation error: %v", err)
+	}
+	// the white background of every frame
+	if want := 16 + 12 + 8; changed != want {
+		t.Errorf("%d pixels changed, want %d", changed, want)
+	}
+	g := anim.GIF()
+	if len(g.Image) != 3 || g.LoopCount != 2 || g.Delay[0] != 10 {
+		t.Fatalf("GIF of %d frames, loop count %d, delays %v, want 3 frames, loop count 2, delays [10 5 7]", len(g.Image), g.LoopCount, g.Delay)
+	}
+	if _, _, _, a := g.Image[1].At(0, 0).RGBA(); a != 0 {
+		t.Errorf("GIF frame 1 pixel (0, 0) alpha = %d, want 0", a)
+	}
+	if got := color.RGBAModel.Convert(g.Image[1].At(3, 3)); got != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("GIF frame 1 pixel (3, 3) = %v, want red", got)
+	}
+
+	if IsAnimatedWebP(bytes.Replace(data, []byte("VP8X\x0a\x00\x00\x00\x12"), []byte("VP8X\x0a\x00\x00\x00\x10"), 1)) {
+		t.Error("IsAnimatedWebP of a still image = true, want false")
+	}
+}
+
+func TestDecodeWebPAnimationLimits(t *testing.T) {
+	// a header claiming a 2^24 x 2^24 canvas, rejected before allocating it
+	huge := newAnimatedWebP(1<<24, 1<<24, 0, nil)
+	if _, err := DecodeWebPAnimation(huge, DefaultMaxPixels); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("DecodeWebPAnimation of a huge canvas error = %v, want ErrTooLarge", err)
+	}
+	if _, err := DecodeImage(huge, DefaultMaxPixels); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("DecodeImage of a huge canvas error = %v, want ErrTooLarge", err)
+	}
+
+	// a frame whose bitstream is larger than its rectangle
+	white := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	data := newAnimatedWebP(4, 4, 0, []testWebPFrame{{image.Rect(0, 0, 4, 4), white, 100, 0}})
+	anmf := bytes.Index(data, []byte("ANMF"))
+	copy(data[anmf+8+6:], []byte{1, 0, 0}) // 2 pixels wide
+	if _, err := DecodeWebPAnimation(data, DefaultMaxPixels); err == nil {
+		t.Error("DecodeWebPAnimation of a frame larger than its rectangle returned no error")
+	}
+}
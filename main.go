@@ -2,250 +2,1706 @@ package main
 
 import (
 	"bytes"
-	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/gif"
-	_ "image/gif"
 	"image/jpeg"
-	_ "image/jpeg"
 	"image/png"
-	_ "image/png"
+	"io"
+	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
-	"golang.org/x/image/bmp"
-	_ "golang.org/x/image/bmp"
-	"golang.org/x/image/tiff"
-	_ "golang.org/x/image/tiff"
-	_ "golang.org/x/image/webp"
+	"github.com/padurean/make-image-transparent/imagetransparent"
 )
 
-func logAndExit(msg string, err error) {
+// verboseLog logs the details of the processing of each image to stderr; it
+// discards them unless the -v flag is set
+var verboseLog = log.New(io.Discard, "", log.Ltime|log.Lmicroseconds)
+
+// exit codes of the command line tool
+const (
+	// exitFailure is returned for any failure not covered by the other codes
+	exitFailure = 1
+	// exitUsage is returned for invalid flags or arguments
+	exitUsage = 2
+	// exitDecode is returned when the input can't be decoded as an image
+	exitDecode = 3
+	// exitInterrupted is returned when a batch run is stopped by SIGINT or
+	// SIGTERM (128 + the number of SIGINT, like shells do)
+	exitInterrupted = 130
+)
+
+// decodeError wraps the errors of decoding the input as an image
+type decodeError struct {
+	error
+}
+
+func (e decodeError) Unwrap() error {
+	return e.error
+}
+
+// exitCode returns the exit code for the error of processing an image
+func exitCode(err error) int {
+	var de decodeError
+	if errors.As(err, &de) {
+		return exitDecode
+	}
+	return exitFailure
+}
+
+func logAndExit(code int, msg string, err error) {
 	if msg != "" {
-		fmt.Fprintf(os.Stderr, "%s: %v\n", msg, err)
+		fmt.Fprintf(stderr, "%s: %v\n", msg, err)
 	} else {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-	}
-	os.Exit(-1)
-}
-
-// ImageType ...
-type ImageType string
-
-// ImageTypes supported
-var ImageTypes = struct {
-	JPEG        ImageType
-	PNG         ImageType
-	BMP         ImageType
-	TIFF        ImageType
-	GIF         ImageType
-	WEBP        ImageType
-	UNSUPPORTED ImageType
-}{
-	JPEG:        "jpeg",
-	PNG:         "png",
-	BMP:         "bmp",
-	TIFF:        "tiff",
-	GIF:         "gif",
-	WEBP:        "webp",
-	UNSUPPORTED: "unsupported",
-}
-
-func getImageType(fileExt string) ImageType {
-	switch strings.ToLower(fileExt) {
-	case "jpg":
-		fallthrough
-	case "jpeg":
-		return ImageTypes.JPEG
-	case "png":
-		return ImageTypes.PNG
-	case "bmp":
-		return ImageTypes.BMP
-	case "tiff":
-		return ImageTypes.TIFF
-	case "gif":
-		return ImageTypes.GIF
-	case "webp":
-		return ImageTypes.WEBP
+		fmt.Fprintf(stderr, "%v\n", err)
+	}
+	os.Exit(code)
+}
+
+// fileError adds to err, returned when writing to dir, what to do about its
+// common causes: missing permissions, a read-only file system or a full disk
+func fileError(err error, dir string) error {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("%w (check the permissions of the directory '%s', or save the output to another one with -o)", err, dir)
+	case errors.Is(err, syscall.EROFS):
+		return fmt.Errorf("%w (the directory '%s' is on a read-only file system, save the output to another one with -o)", err, dir)
+	case errors.Is(err, syscall.ENOSPC):
+		return fmt.Errorf("%w (the disk of the directory '%s' is full, free some space or save the output to another disk with -o)", err, dir)
 	default:
-		return ImageTypes.UNSUPPORTED
+		return err
 	}
 }
 
-func createFile(filePath string) *os.File {
-	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
-		err := os.Remove(filePath)
+// writableDirs caches the result of checkWritable for each directory, so that
+// in batch mode every output directory is checked once
+var writableDirs sync.Map
+
+// checkWritable returns an error (see fileError) if files can't be created in
+// dir or, if it doesn't exist yet, in its closest existing parent directory, in
+// which it would be created; it creates and removes a temporary file there, so
+// that unwritable outputs are reported before processing the images instead of
+// after
+func checkWritable(dir string) error {
+	if err, ok := writableDirs.Load(dir); ok {
+		err, _ := err.(error)
+		return err
+	}
+	existing := dir
+	for {
+		if _, err := os.Stat(existing); err == nil || filepath.Dir(existing) == existing {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	var err error
+	if tmpFile, createErr := os.CreateTemp(existing, ".make-image-transparent-*"); createErr != nil {
+		err = fileError(fmt.Errorf("error creating files in directory '%s': %w", dir, createErr), existing)
+	} else {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}
+	writableDirs.Store(dir, err)
+	return err
+}
+
+// writeFileAtomically creates filePath (and its missing parent directories)
+// with the content written by write. The content is written to a temporary file
+// in the same directory first, which is renamed to filePath only if write
+// succeeds, so an existing filePath is never left truncated or corrupt. If write
+// fails, e.g. when encoding midway, the temporary file is removed and the error
+// tells how many bytes were written.
+func writeFileAtomically(filePath string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fileError(fmt.Errorf("error creating directory '%s': %w", dir, err), filepath.Dir(dir))
+	}
+
+	tmpFile, err := os.CreateTemp(dir, "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return fileError(fmt.Errorf("error creating file '%s': %w", filePath, err), dir)
+	}
+	tmpFileName := tmpFile.Name()
+	tempFiles.Store(tmpFileName, nil)
+	defer tempFiles.Delete(tmpFileName)
+	fail := func(err error) error {
+		tmpFile.Close()
+		os.Remove(tmpFileName)
+		return fileError(err, dir)
+	}
+
+	counter := &countingWriter{w: tmpFile}
+	if err := write(counter); err != nil {
+		return fail(fmt.Errorf("%w (%d bytes written, '%s' left untouched)", err, counter.n, filePath))
+	}
+	if err := tmpFile.Chmod(0644); err != nil {
+		return fail(fmt.Errorf("error setting the permissions of file '%s': %w", filePath, err))
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fail(fmt.Errorf("error writing file '%s': %w", filePath, err))
+	}
+	if err := os.Rename(tmpFileName, filePath); err != nil {
+		os.Remove(tmpFileName)
+		return fileError(fmt.Errorf("error creating file '%s': %w", filePath, err), dir)
+	}
+	return nil
+}
+
+// stdinFileName is the file name which makes readInput read from stdin
+const stdinFileName = "-"
+
+// readInput reads the whole content of the given file or, if fileName is
+// stdinFileName, of stdin or, if it is an http(s) URL, of the downloaded image
+func readInput(fileName string) ([]byte, error) {
+	if isURL(fileName) {
+		return readURL(fileName)
+	}
+	if fileName == stdinFileName {
+		data, err := io.ReadAll(os.Stdin)
 		if err != nil {
-			logAndExit("Error deleting file '%s':", err)
+			return nil, fmt.Errorf("error when reading from stdin: %w", err)
 		}
+		return data, nil
+	}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error when reading file '%s': %w", fileName, err)
 	}
+	return data, nil
+}
 
-	file, err := os.Create(filePath)
+// detectImageType returns the type of the image data: inFormat if set (see the
+// -in-format flag), otherwise detected from content (see
+// imagetransparent.SniffImageType) or, if that is inconclusive, from the file
+// extension
+func detectImageType(data []byte, fileName string, inFormat imagetransparent.ImageType) imagetransparent.ImageType {
+	if inFormat != "" {
+		return inFormat
+	}
+	imageType := imagetransparent.SniffImageType(data)
+	if imageType == imagetransparent.ImageTypes.UNSUPPORTED && fileName != stdinFileName {
+		if isURL(fileName) {
+			fileName = urlFileName(fileName)
+		}
+		imageType = imagetransparent.GetImageType(strings.TrimPrefix(filepath.Ext(fileName), "."))
+	}
+	return imageType
+}
+
+// decodeImage decodes the image data read from fileName (see
+// imagetransparent.DecodeImageAs - inFormat forces the image type, if set),
+// wrapping the errors with the file name
+func decodeImage(data []byte, fileName string, inFormat imagetransparent.ImageType, maxPixels int) (image.Image, error) {
+	if fileName == stdinFileName {
+		fileName = "stdin"
+	}
+	imageData, err := imagetransparent.DecodeImageAs(data, inFormat, maxPixels)
+	if errors.Is(err, imagetransparent.ErrTooLarge) {
+		return nil, fmt.Errorf("error when decoding image from '%s': %w", fileName, err)
+	} else if err != nil {
+		return nil, decodeError{fmt.Errorf("error when decoding image from '%s': %w", fileName, err)}
+	}
+	return imageData, nil
+}
+
+// loadImage decodes the image from the given file (or from stdin if fileName is
+// stdinFileName) and returns it together with its type (see detectImageType)
+func loadImage(fileName string) (image.Image, imagetransparent.ImageType, error) {
+	data, err := readInput(fileName)
+	if err != nil {
+		return nil, imagetransparent.ImageTypes.UNSUPPORTED, err
+	}
+	imageData, err := decodeImage(data, fileName, "", imagetransparent.DefaultMaxPixels)
 	if err != nil {
-		logAndExit(fmt.Sprintf("error creating file '%s':", filePath), err)
+		return nil, imagetransparent.ImageTypes.UNSUPPORTED, err
 	}
-	return file
+	return imageData, detectImageType(data, fileName, ""), nil
 }
 
-func loadImage(fileName string, imageType ImageType) *image.Image {
-	file, errOpen := os.Open(fileName)
-	if errOpen != nil {
-		logAndExit(fmt.Sprintf("error when opening file '%s':", fileName), errOpen)
+// pipeThroughBase64Arg returns the value of the second argument, true or false,
+// of the legacy form telling whether to pipe the image through Base64 (see the
+// README). It is taken as such only if there are two arguments, the first of
+// which is an image file, not a directory or a glob, and the second one is not
+// an existing file; otherwise all the arguments are images.
+func pipeThroughBase64Arg(args []string) (bool, bool) {
+	if len(args) != 2 {
+		return false, false
 	}
-	defer file.Close()
+	value, err := strconv.ParseBool(strings.ToLower(args[1]))
+	if err != nil {
+		return false, false
+	}
+	if _, err := os.Stat(args[1]); err == nil {
+		return false, false
+	}
+	if _, isBatch, _ := batchFiles(args[0], false); isBatch {
+		return false, false
+	}
+	return value, true
+}
 
-	imageData, _, err := image.Decode(file)
+// isTerminal reports whether the given file is a terminal (character device)
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// options of a conversion, set from the command line flags
+type options struct {
+	imagetransparent.Options
+	outImageType      imagetransparent.ImageType
+	inFormat          imagetransparent.ImageType
+	outFileName       string
+	outDir            string
+	pipeThroughBase64 bool
+	base64            bool
+	noAutorotate      bool
+	backgroundFrom    string
+	stripMetadata     bool
+	gifNoDither       bool
+	dryRun            bool
+	trim              bool
+	trimPadding       int
+	json              bool
+	keepFormat        bool
+	autoTolerance     bool
+	mask              bool
+	preview           bool
+	clipboard         bool
+	toleranceSweep    []uint8
+	preset            string
+	compare           string
+	compareThreshold  float64
+	// expected is the image decoded from the compare file
+	expected          image.Image
+	outputMode        outputMode
+	scale             *scaleSpec
+	channelTolerances [3]uint8
+	scaleBefore       bool
+	rotate            int
+	flip              imagetransparent.Flip
+	transformBefore   bool
+	previewSize       int
+	force8Bit         bool
+	nrgba             bool
+	minCoverage       float64
+	strict            bool
+	requireCorners    bool
+	failFast          bool
+	recursive         bool
+	fromList          string
+	watch             string
+	watchInterval     time.Duration
+	atlas             string
+	preserveTimes     bool
+	// batchRoot is the directory processed with -recursive
+	batchRoot string
+	quiet     bool
+	verbose   bool
+	// progress is where the progress is printed; nil if it is not shown
+	progress   *progressLine
+	encodeOpts imagetransparent.EncodeOptions
+}
+
+// conversion describes the outcome of processing an image file, as printed by
+// the -json flag
+type conversion struct {
+	Input            string   `json:"input"`
+	Output           string   `json:"output,omitempty"`
+	Width            int      `json:"width"`
+	Height           int      `json:"height"`
+	BackgroundColors []string `json:"backgroundColors,omitempty"`
+	Tolerance        *uint8   `json:"tolerance,omitempty"`
+	PixelsChanged    int      `json:"pixelsChanged"`
+	PixelsExamined   int      `json:"pixelsExamined,omitempty"`
+	PixelsDiffering  int      `json:"pixelsDiffering,omitempty"`
+	Similarity       *float64 `json:"similarity,omitempty"`
+	Preview          string   `json:"preview,omitempty"`
+	Clipboard        bool     `json:"clipboard,omitempty"`
+	Converted        bool     `json:"converted"`
+	DryRun           bool     `json:"dryRun,omitempty"`
+	Error            string   `json:"error,omitempty"`
+	// Pages are the conversions of the pages of a multi-page TIFF
+	Pages []*conversion `json:"pages,omitempty"`
+}
 
+// printJSON prints c, with the error err (if any), as a JSON object on a line
+// of stdout
+func printJSON(c *conversion, err error) {
 	if err != nil {
-		logAndExit(fmt.Sprintf("error when decoding image from file '%s'", fileName), err)
+		c.Error = err.Error()
 	}
+	if err := json.NewEncoder(stdout).Encode(c); err != nil {
+		fmt.Fprintf(stderr, "error when printing JSON output for '%s': %v\n", c.Input, err)
+	}
+}
 
-	return &imageData
+// hexColors formats colors as #RRGGBB
+func hexColors(colors []color.RGBA) []string {
+	hexes := make([]string, len(colors))
+	for i, c := range colors {
+		hexes[i] = fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+	}
+	return hexes
 }
 
-func encodeImageToBase64(img *image.Image, imageType ImageType) string {
-	var buff bytes.Buffer
-	var err error
-	var imageTypeStr string
-	switch imageType {
-	case ImageTypes.JPEG:
-		err = jpeg.Encode(&buff, *img, nil)
-		imageTypeStr = "jpeg"
-	case ImageTypes.PNG:
-		err = png.Encode(&buff, *img)
-		imageTypeStr = "png"
-	case ImageTypes.BMP:
-		err = bmp.Encode(&buff, *img)
-		imageTypeStr = "bmp"
-	case ImageTypes.TIFF:
-		err = tiff.Encode(&buff, *img, nil)
-		imageTypeStr = "tiff"
-	case ImageTypes.GIF:
-		err = gif.Encode(&buff, *img, nil)
-		imageTypeStr = "gif"
-	case ImageTypes.WEBP:
-		fallthrough
-	case ImageTypes.UNSUPPORTED:
-		logAndExit("", fmt.Errorf("error when encoding image to base64: image type %s is not supported", imageType))
+// outputFileName returns the name of the file the conversion of fileName is
+// saved to when no output file name is specified: out__<file name>.<format>,
+// placed in opts.outDir (in the subdirectory mirroring the one of the input file
+// in opts.batchRoot, if set) or, if that is empty, next to the input file (in
+// the current directory for stdin and URLs)
+func outputFileName(fileName string, opts *options) string {
+	dir := filepath.Dir(fileName)
+	base := filepath.Base(fileName)
+	if fileName == stdinFileName {
+		dir, base = ".", "stdin"
+	} else if isURL(fileName) {
+		dir, base = ".", urlFileName(fileName)
+	}
+	if opts.outDir != "" {
+		dir = opts.outDir
+		// mirror the tree of the directory processed recursively
+		if opts.batchRoot != "" {
+			if rel, err := filepath.Rel(opts.batchRoot, filepath.Dir(fileName)); err == nil {
+				dir = filepath.Join(opts.outDir, rel)
+			}
+		}
+	}
+	baseNoExt := base[0 : len(base)-len(filepath.Ext(base))]
+	return filepath.Join(dir, outputFilePrefix+baseNoExt+"."+string(opts.outImageType))
+}
+
+// writeOutput calls write with the output the conversion of fileName is saved
+// to, as configured by opts: stdout (as a data URI with opts.base64),
+// opts.outFileName or outputFileName; with opts.clipboard the output is copied
+// to the clipboard and only saved to opts.outFileName, if given. Returns the
+// path of the output ("-" for stdout, "" for the clipboard only).
+func writeOutput(fileName string, opts *options, write func(w io.Writer) error) (string, error) {
+	outFileName := opts.outFileName
+	if opts.clipboard {
+		var buff bytes.Buffer
+		if err := write(&buff); err != nil {
+			return "", fmt.Errorf("error when encoding image for the clipboard: %w", err)
+		}
+		if err := copyToClipboard(buff.Bytes()); err != nil {
+			return "", err
+		}
+		if outFileName == "" {
+			return "", nil
+		}
+		write = func(w io.Writer) error {
+			_, err := w.Write(buff.Bytes())
+			return err
+		}
+	}
+	if opts.base64 {
+		var buff bytes.Buffer
+		if err := write(&buff); err != nil {
+			return outFileName, fmt.Errorf("error when encoding image to base64: %w", err)
+		}
+		_, err := fmt.Fprintln(stdout, imagetransparent.DataURI(buff.Bytes(), opts.outImageType))
+		return outFileName, err
+	}
+	if outFileName == "-" {
+		if err := write(stdout); err != nil {
+			return outFileName, fmt.Errorf("error when encoding image to stdout: %w", err)
+		}
+		return outFileName, nil
+	}
+	if outFileName == "" {
+		outFileName = outputFileName(fileName, opts)
 	}
 
+	return outFileName, writeFileAtomically(outFileName, func(w io.Writer) error {
+		if err := write(w); err != nil {
+			return fmt.Errorf("error when encoding image file '%s': %w", outFileName, err)
+		}
+		return nil
+	})
+}
+
+// processAnimatedGIF makes the background of all the frames of the GIF data
+// transparent and saves the result as an animated GIF. It reports false if the
+// GIF has a single frame, in which case it has to be processed as a still image.
+func processAnimatedGIF(data []byte, fileName string, opts *options, conv *conversion) (bool, error) {
+	config, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return true, decodeError{fmt.Errorf("error when decoding GIF frames from '%s': %w", fileName, err)}
+	}
+	if err := imagetransparent.CheckSize(config.Width, config.Height, opts.MaxPixels); err != nil {
+		return true, fmt.Errorf("error when decoding GIF frames from '%s': %w", fileName, err)
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
 	if err != nil {
-		logAndExit("error when encoding image to base64", err)
+		return true, decodeError{fmt.Errorf("error when decoding GIF frames from '%s': %w", fileName, err)}
 	}
+	if len(g.Image) < 2 {
+		return false, nil
+	}
+	conv.Width, conv.Height = g.Config.Width, g.Config.Height
 
-	return "data:image/" + imageTypeStr + ";base64," + base64.StdEncoding.EncodeToString(buff.Bytes())
+	changed, err := imagetransparent.MakeTransparentGIF(g, opts.Options)
+	if err != nil {
+		return true, err
+	}
+	conv.PixelsChanged = changed
+	conv.Output, err = writeOutput(fileName, opts, func(w io.Writer) error {
+		return gif.EncodeAll(w, g)
+	})
+	conv.Converted = err == nil
+	return true, err
 }
 
-func decodeImageFromBase64(data []byte) *image.Image {
-	search := []byte("base64,")
-	if idx := bytes.Index(data, search); idx > -1 {
-		src := data[idx+len(search):]
-		if _, err := base64.StdEncoding.Decode(data, src); err != nil {
-			logAndExit("error when decoding from base64", err)
+// processAnimatedWebP makes the background of all the frames of the animated
+// WebP data transparent and saves the result as an animated GIF, since WebP
+// animations can't be encoded
+func processAnimatedWebP(data []byte, fileName string, opts *options, conv *conversion) error {
+	anim, err := imagetransparent.DecodeWebPAnimation(data, opts.MaxPixels)
+	if errors.Is(err, imagetransparent.ErrTooLarge) {
+		return fmt.Errorf("error when decoding WebP frames from '%s': %w", fileName, err)
+	}
+	if err != nil {
+		return decodeError{fmt.Errorf("error when decoding WebP frames from '%s': %w", fileName, err)}
+	}
+	bounds := anim.Frames[0].Bounds()
+	conv.Width, conv.Height = bounds.Dx(), bounds.Dy()
+
+	changed, err := imagetransparent.MakeTransparentWebPAnimation(anim, opts.Options)
+	if err != nil {
+		return err
+	}
+	conv.PixelsChanged = changed
+	conv.Output, err = writeOutput(fileName, opts, func(w io.Writer) error {
+		return gif.EncodeAll(w, anim.GIF())
+	})
+	conv.Converted = err == nil
+	return err
+}
+
+// printAnalysis prints what converting imageData (read from fileName) would do,
+// without writing any output, and records it in conv; returns
+// imagetransparent.ErrNotConverted if no pixel would be made transparent
+func printAnalysis(fileName string, imageData image.Image, opts *options, conv *conversion) error {
+	analysis := imagetransparent.Analyze(imageData, opts.Options)
+	bgs := hexColors(analysis.BackgroundColors)
+	conv.BackgroundColors = bgs
+	conv.PixelsChanged = analysis.BackgroundPixels
+	conv.Converted = analysis.BackgroundPixels > 0
+	conv.DryRun = true
+
+	if !opts.json {
+		if fileName == stdinFileName {
+			fileName = "stdin"
+		}
+		bounds := imageData.Bounds()
+		opacity := "opaque"
+		if !analysis.Opaque {
+			opacity = "has transparency"
+		}
+		detection := ""
+		if analysis.Ambiguous {
+			detection = fmt.Sprintf(" (ambiguous - %s)", ambiguityReason(opts.Options))
+		}
+		percentage := 0.0
+		if analysis.Pixels > 0 {
+			percentage = 100 * float64(analysis.BackgroundPixels) / float64(analysis.Pixels)
 		}
+		background := "background " + strings.Join(bgs, " ")
+		if opts.ChromaKey != nil {
+			background = fmt.Sprintf("chroma key hue %.0f", opts.ChromaKey.Hue)
+		}
+		fmt.Fprintf(stdout, "%s: %dx%d, %s, %s%s, %d of %d pixels (%.2f%%) would be made transparent\n",
+			fileName, bounds.Dx(), bounds.Dy(), opacity, background, detection,
+			analysis.BackgroundPixels, analysis.Pixels, percentage)
 	}
 
-	dataBuffer := bytes.NewBuffer(data)
-	imageData, _, err := image.Decode(dataBuffer)
+	if analysis.BackgroundPixels == 0 {
+		return imagetransparent.ErrNotConverted
+	}
+	return nil
+}
 
-	if err != nil {
-		logAndExit("error when decoding image data from base64", err)
+// ambiguityReason explains why the detection of the background color with the
+// given options was ambiguous
+func ambiguityReason(opts imagetransparent.Options) string {
+	if opts.BackgroundMode == imagetransparent.BackgroundModes.Mode || opts.BorderSample > 0 {
+		return "all the pixels are transparent"
 	}
+	return "the corners have different colors"
+}
 
-	return &imageData
+// checkCoverage warns on stderr if the changed pixels are less than
+// opts.minCoverage percent of the pixels of the image, since the background was
+// probably misdetected; with opts.strict it returns an error instead
+func checkCoverage(fileName string, changed int, bounds image.Rectangle, opts *options) error {
+	pixels := bounds.Dx() * bounds.Dy()
+	if pixels == 0 {
+		return nil
+	}
+	coverage := 100 * float64(changed) / float64(pixels)
+	if coverage >= opts.minCoverage {
+		return nil
+	}
+	msg := fmt.Sprintf("only %.2f%% of the pixels of '%s' matched the background color - it was probably misdetected", coverage, fileName)
+	if opts.strict {
+		return errors.New(msg + " (not saved because of -strict)")
+	}
+	fmt.Fprintf(stderr, "warning: %s\n", msg)
+	return nil
 }
 
-func uint8Diff(a uint8, b uint8) uint8 {
-	if a > b {
-		return a - b
+// keepsPalette reports whether paletted images (GIFs and some PNGs) can be
+// converted keeping their palette, which is the case if the output format
+// supports it and opts don't need more than a transparent palette entry
+func keepsPalette(opts *options) bool {
+	if opts.outImageType != imagetransparent.ImageTypes.PNG && opts.outImageType != imagetransparent.ImageTypes.GIF {
+		return false
 	}
-	return b - a
+	return !opts.trim && opts.scale == nil && opts.FeatherRadius == 0 && opts.SoftEdges == 0 && opts.BackgroundAlpha == 0
 }
 
-var colorTolerance uint8 = 110
-var colorToleranceUniform uint8 = 100
+// processFile makes the background of the image from fileName transparent and
+// saves the result as configured by opts; returns what was done, even on error
+func processFile(fileName string, opts *options) (conv *conversion, err error) {
+	conv = &conversion{Input: fileName}
+	if opts.preserveTimes {
+		defer func() {
+			if err == nil {
+				err = preserveTimes(fileName, conv)
+			}
+		}()
+	}
+	if !opts.dryRun && !opts.base64 && opts.outFileName != "-" && !(opts.clipboard && opts.outFileName == "") && opts.expected == nil {
+		outFileName := opts.outFileName
+		if outFileName == "" {
+			outFileName = outputFileName(fileName, opts)
+		}
+		if err := checkWritable(filepath.Dir(outFileName)); err != nil {
+			return conv, err
+		}
+	}
+	start := time.Now()
+	data, err := readInput(fileName)
+	if err != nil {
+		return conv, err
+	}
+	imageType := detectImageType(data, fileName, opts.inFormat)
+	verboseLog.Printf("%s: read %d bytes of %s image in %v", fileName, len(data), imageType, time.Since(start))
+	if opts.keepFormat && imageType != imagetransparent.ImageTypes.JPEG && imagetransparent.IsEncodable(imageType) {
+		fileOpts := *opts
+		fileOpts.outImageType = imageType
+		opts = &fileOpts
+	}
 
-func sameColor(a *color.RGBA, b *color.RGBA) bool {
-	aa := *a
-	bb := *b
-	dR := uint8Diff(aa.R, bb.R)
-	dG := uint8Diff(aa.G, bb.G)
-	dB := uint8Diff(aa.B, bb.B)
+	animatable := !opts.dryRun && !opts.mask && len(opts.toleranceSweep) == 0 && opts.expected == nil
+	if animatable && imageType == imagetransparent.ImageTypes.GIF && opts.outImageType == imagetransparent.ImageTypes.GIF {
+		if animated, err := processAnimatedGIF(data, fileName, opts, conv); animated {
+			return conv, err
+		}
+	}
+	if animatable && imageType == imagetransparent.ImageTypes.WEBP && imagetransparent.IsAnimatedWebP(data) {
+		if opts.outImageType == imagetransparent.ImageTypes.GIF {
+			return conv, processAnimatedWebP(data, fileName, opts, conv)
+		}
+		if !opts.json {
+			fmt.Fprintf(stderr, "warning: '%s' is an animated WebP - only its first frame is processed, use -format gif to keep the animation\n", fileName)
+		}
+	}
+
+	if imageType == imagetransparent.ImageTypes.TIFF {
+		if pages := imagetransparent.TIFFPageCount(data); pages > 1 {
+			return conv, processTIFFPages(data, pages, fileName, opts, conv)
+		}
+	}
+	return conv, processImage(data, imageType, fileName, opts, conv)
+}
+
+// preserveTimes sets the access and modification times of the outputs of conv
+// (including the ones of its pages) to the modification time of the input file
+// fileName; there is nothing to preserve for stdin, URLs and stdout
+func preserveTimes(fileName string, conv *conversion) error {
+	if fileName == stdinFileName || isURL(fileName) {
+		return nil
+	}
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return fmt.Errorf("error when reading the times of file '%s': %w", fileName, err)
+	}
+	outputs := []string{conv.Output, conv.Preview}
+	for _, page := range conv.Pages {
+		outputs = append(outputs, page.Output, page.Preview)
+	}
+	for _, output := range outputs {
+		if output == "" || output == "-" {
+			continue
+		}
+		if err := os.Chtimes(output, info.ModTime(), info.ModTime()); err != nil {
+			return fmt.Errorf("error when setting the times of file '%s': %w", output, err)
+		}
+	}
+	return nil
+}
 
-	t := colorTolerance
-	if dR == dG && dG == dB {
-		t = colorToleranceUniform
+// processTIFFPages processes each of the pages of the multi-page TIFF data like
+// a separate image, saving them to numbered files (e.g. out__scan_p1.png); conv
+// gets the conversions of the pages. Pages in which no pixel matched the
+// background color are skipped.
+func processTIFFPages(data []byte, pages int, fileName string, opts *options, conv *conversion) error {
+	outFileName := opts.outFileName
+	if outFileName == "-" && !opts.base64 {
+		return errors.New("multi-page TIFFs cannot be written to stdout")
+	}
+	if opts.clipboard {
+		return errors.New("multi-page TIFFs cannot be copied to the clipboard")
 	}
+	if opts.expected != nil {
+		return errors.New("multi-page TIFFs cannot be compared")
+	}
+	if outFileName == "" {
+		outFileName = outputFileName(fileName, opts)
+	}
+	conv.DryRun = opts.dryRun
 
-	return dR <= t && dG <= t && dB <= t
+	for page := 1; page <= pages; page++ {
+		pageData, err := imagetransparent.TIFFPage(data, page-1)
+		if err != nil {
+			return err
+		}
+		pageName := fmt.Sprintf("%s (page %d)", fileName, page)
+		pageOpts := *opts
+		if !opts.base64 {
+			ext := filepath.Ext(outFileName)
+			pageOpts.outFileName = fmt.Sprintf("%s_p%d%s", strings.TrimSuffix(outFileName, ext), page, ext)
+		}
+		pageConv := &conversion{Input: pageName}
+		conv.Pages = append(conv.Pages, pageConv)
+		err = processImage(pageData, imagetransparent.ImageTypes.TIFF, pageName, &pageOpts, pageConv)
+		if errors.Is(err, imagetransparent.ErrNotConverted) {
+			pageConv.Error = err.Error()
+			if !opts.json {
+				fmt.Fprintf(stderr, "warning: %s: %v\n", pageName, err)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		conv.PixelsChanged += pageConv.PixelsChanged
+		conv.Converted = conv.Converted || pageConv.Converted
+	}
+	if !conv.Converted {
+		return imagetransparent.ErrNotConverted
+	}
+	return nil
 }
 
-func makeBackgroundTransparent(img *image.Image) (bool, *image.RGBA) {
-	imageData := *img
-	imageRGBA := image.NewRGBA(imageData.Bounds())
-	draw.Draw(imageRGBA, imageData.Bounds(), imageData, image.ZP, draw.Src)
-	if imageRGBA.Opaque() {
-		backgroundColor := imageRGBA.RGBAAt(0, 0)
-		bounds := imageRGBA.Bounds()
-		width := bounds.Dx()
-		height := bounds.Dy()
-		for x := 0; x < width; x++ {
-			for y := 0; y < height; y++ {
-				color := imageRGBA.RGBAAt(x, y)
-				if sameColor(&color, &backgroundColor) {
-					color.A = 0
-					imageRGBA.SetRGBA(x, y, color)
+// processImage makes the background of the image data of the given type, read
+// from fileName, transparent and saves the result as configured by opts,
+// recording what was done in conv
+func processImage(data []byte, imageType imagetransparent.ImageType, fileName string, opts *options, conv *conversion) error {
+	start := time.Now()
+	imageData, err := decodeImage(data, fileName, opts.inFormat, opts.MaxPixels)
+	if err != nil {
+		return err
+	}
+	if imageData.Bounds().Empty() {
+		return imagetransparent.ErrEmptyImage
+	}
+	verboseLog.Printf("%s: decoded %dx%d %T in %v", fileName, imageData.Bounds().Dx(), imageData.Bounds().Dy(), imageData, time.Since(start))
+	if !opts.noAutorotate && (imageType == imagetransparent.ImageTypes.JPEG || imageType == imagetransparent.ImageTypes.TIFF) {
+		imageData = imagetransparent.Orient(imageData, imagetransparent.ExifOrientation(data))
+	}
+	if (opts.rotate != 0 || opts.flip != "") && opts.transformBefore {
+		if imageData, err = imagetransparent.Transform(imageData, opts.rotate, opts.flip); err != nil {
+			return err
+		}
+		verboseLog.Printf("%s: rotated by %d degrees, flipped %q", fileName, opts.rotate, opts.flip)
+	}
+	if opts.scale != nil && opts.scaleBefore {
+		size := opts.scale.size(imageData.Bounds().Size())
+		imageData = imagetransparent.Scale(imageData, size.X, size.Y)
+		verboseLog.Printf("%s: scaled to %dx%d", fileName, size.X, size.Y)
+	}
+	bounds := imageData.Bounds()
+	conv.Width, conv.Height = bounds.Dx(), bounds.Dy()
+
+	if opts.pipeThroughBase64 {
+		base64Encoded, err := imagetransparent.EncodeImageToBase64WithOptions(imageData, imageType, opts.encodeOpts)
+		if err != nil {
+			return err
+		}
+		imageData, err = imagetransparent.DecodeImageFromBase64([]byte(base64Encoded))
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.autoTolerance {
+		bgColors := opts.BackgroundColors
+		if len(bgColors) == 0 {
+			detected, _ := imagetransparent.DetectBackgroundColor(imageData, opts.Options)
+			bgColors = []color.RGBA{detected}
+		}
+		fileOpts := *opts
+		fileOpts.Tolerance = imagetransparent.AutoTolerance(imageData, bgColors)
+		fileOpts.UniformTolerance = fileOpts.Tolerance
+		opts = &fileOpts
+		conv.Tolerance = &fileOpts.Tolerance
+		if !opts.json {
+			fmt.Fprintf(stderr, "%s: auto tolerance %d\n", fileName, opts.Tolerance)
+		}
+	}
+
+	if opts.dryRun {
+		return printAnalysis(fileName, imageData, opts, conv)
+	}
+
+	transparencyOpts := opts.Options
+	if transparencyOpts.ChromaKey != nil {
+		// keyed by hue, there is no background color
+	} else if len(transparencyOpts.BackgroundColors) == 0 && transparencyOpts.BackgroundMode == imagetransparent.BackgroundModes.Gradient {
+		corners := imagetransparent.DetectGradientCorners(imageData)
+		conv.BackgroundColors = hexColors(corners[:])
+	} else {
+		if len(transparencyOpts.BackgroundColors) == 0 {
+			detected, ambiguous := imagetransparent.DetectBackgroundColor(imageData, transparencyOpts)
+			if ambiguous {
+				fmt.Fprintf(stderr, "warning: the background color of '%s' is ambiguous (%s) - using the color of the top-left pixel\n", fileName, ambiguityReason(opts.Options))
+			}
+			transparencyOpts.BackgroundColors = []color.RGBA{detected}
+			if corners := imagetransparent.MismatchedCorners(imageData, transparencyOpts); len(corners) > 0 {
+				names := make([]string, len(corners))
+				for i, corner := range corners {
+					names[i] = string(corner)
+				}
+				plural := ""
+				if len(names) > 1 {
+					plural = "s"
+				}
+				reason := fmt.Sprintf("the detected background color %s of '%s' doesn't match its %s corner%s",
+					hexColors(transparencyOpts.BackgroundColors)[0], fileName, strings.Join(names, ", "), plural)
+				if opts.requireCorners {
+					return errors.New(reason + " (-require-corners)")
+				}
+				if !ambiguous {
+					fmt.Fprintf(stderr, "warning: %s - the subject may extend into the corners\n", reason)
 				}
 			}
 		}
-		return true, imageRGBA
+		conv.BackgroundColors = hexColors(transparencyOpts.BackgroundColors)
 	}
-	return false, nil
+
+	if opts.progress != nil {
+		transparencyOpts.Progress = opts.progress.imageProgress(fileName)
+		defer opts.progress.clear()
+	}
+	detection := string(transparencyOpts.BackgroundMode)
+	if transparencyOpts.BorderSample > 0 && transparencyOpts.BackgroundMode != imagetransparent.BackgroundModes.Gradient {
+		detection = fmt.Sprintf("%dpx border", transparencyOpts.BorderSample)
+	}
+	tolerance := strconv.Itoa(int(transparencyOpts.Tolerance))
+	if t := transparencyOpts.ChannelTolerances; t != nil {
+		tolerance = fmt.Sprintf("%d,%d,%d", t[0], t[1], t[2])
+	}
+	verboseLog.Printf("%s: background %s (%s detection), %s metric, tolerance %s, uniform tolerance %d, %s mode",
+		fileName, strings.Join(conv.BackgroundColors, " "), detection, transparencyOpts.Metric,
+		tolerance, transparencyOpts.UniformTolerance, transparencyOpts.Mode)
+	if len(opts.toleranceSweep) > 0 {
+		return writeToleranceSweep(fileName, imageData, transparencyOpts, opts, conv)
+	}
+	start = time.Now()
+
+	var output image.Image
+	if imagetransparent.IsDeep(imageData) && !opts.force8Bit {
+		imageRGBA64, changed, err := imagetransparent.MakeTransparent64(imageData, transparencyOpts)
+		if err != nil {
+			return err
+		}
+		conv.PixelsChanged = changed
+		if opts.trim {
+			imageRGBA64 = imagetransparent.Trim64(imageRGBA64, opts.trimPadding)
+		}
+		output = imageRGBA64
+	} else if paletted, ok := imageData.(*image.Paletted); ok && keepsPalette(opts) {
+		imagePaletted, changed, err := imagetransparent.MakeTransparentPaletted(paletted, transparencyOpts)
+		if err != nil {
+			return err
+		}
+		conv.PixelsChanged = changed
+		output = imagePaletted
+	} else {
+		imageRGBA, stats, err := imagetransparent.MakeTransparentStats(imageData, transparencyOpts)
+		conv.PixelsExamined = stats.PixelsExamined
+		if err != nil {
+			return err
+		}
+		conv.PixelsChanged = stats.PixelsChanged
+		if opts.trim {
+			imageRGBA = imagetransparent.Trim(imageRGBA, opts.trimPadding)
+		}
+		output = imageRGBA
+	}
+	if opts.progress != nil {
+		opts.progress.clear()
+	}
+	verboseLog.Printf("%s: %d pixels changed (%d examined) in %v", fileName, conv.PixelsChanged, conv.PixelsExamined, time.Since(start))
+	if err := checkCoverage(fileName, conv.PixelsChanged, imageData.Bounds(), opts); err != nil {
+		return err
+	}
+	if (opts.rotate != 0 || opts.flip != "") && !opts.transformBefore {
+		if output, err = imagetransparent.Transform(output, opts.rotate, opts.flip); err != nil {
+			return err
+		}
+		verboseLog.Printf("%s: rotated by %d degrees, flipped %q", fileName, opts.rotate, opts.flip)
+	}
+	if opts.scale != nil && !opts.scaleBefore {
+		size := opts.scale.size(output.Bounds().Size())
+		output = imagetransparent.Scale(output, size.X, size.Y)
+		verboseLog.Printf("%s: scaled to %dx%d", fileName, size.X, size.Y)
+	}
+	if opts.outputMode != "" && opts.outImageType == imagetransparent.ImageTypes.PNG {
+		output = convertOutputMode(fileName, output, opts)
+	}
+	if opts.nrgba {
+		switch o := output.(type) {
+		case *image.RGBA:
+			output = imagetransparent.ToNRGBA(o)
+		case *image.RGBA64:
+			output = imagetransparent.ToNRGBA64(o)
+		}
+	}
+	cutout := output
+	if opts.mask {
+		output = imagetransparent.Mask(output)
+	}
+
+	if opts.expected != nil {
+		return compareOutput(fileName, output, opts, conv)
+	}
+	encodeOpts := opts.encodeOpts
+	if !opts.stripMetadata {
+		encodeOpts.Metadata = imagetransparent.ReadMetadata(data)
+		if !encodeOpts.Metadata.IsEmpty() && opts.outImageType == imagetransparent.ImageTypes.PNG {
+			verboseLog.Printf("%s: copying metadata %+v", fileName, encodeOpts.Metadata)
+		}
+	}
+	start = time.Now()
+	conv.Output, err = writeOutput(fileName, opts, func(w io.Writer) error {
+		return imagetransparent.EncodeImageWithOptions(w, output, opts.outImageType, encodeOpts)
+	})
+	if err != nil {
+		return err
+	}
+	destination := "'" + conv.Output + "'"
+	if opts.clipboard {
+		destination = strings.TrimPrefix(destination+" and the clipboard", "'' and ")
+	}
+	verboseLog.Printf("%s: encoded %s to %s in %v", fileName, opts.outImageType, destination, time.Since(start))
+	conv.Clipboard = opts.clipboard
+	conv.Converted = true
+	if opts.preview {
+		conv.Preview = previewFileName(conv.Output)
+		err = writeFileAtomically(conv.Preview, func(w io.Writer) error {
+			return png.Encode(w, imagetransparent.Checkerboard(cutout, opts.previewSize))
+		})
+		if err != nil {
+			return err
+		}
+		verboseLog.Printf("%s: saved preview to '%s'", fileName, conv.Preview)
+	}
+	return nil
+}
+
+// compareOutput compares the output image of fileName with opts.expected,
+// records the result in conv and reports it; returns an error if their
+// similarity is below opts.compareThreshold
+func compareOutput(fileName string, output image.Image, opts *options, conv *conversion) error {
+	diff, err := imagetransparent.Compare(output, opts.expected)
+	if err != nil {
+		return fmt.Errorf("error when comparing '%s' with '%s': %w", fileName, opts.compare, err)
+	}
+	similarity := diff.Similarity()
+	conv.PixelsDiffering = diff.Pixels
+	conv.Similarity = &similarity
+	if !opts.json {
+		if fileName == stdinFileName {
+			fileName = "stdin"
+		}
+		fmt.Fprintf(stdout, "%s: %d of %d pixels differ from '%s' (max channel difference %d), %.2f%% similar\n",
+			fileName, diff.Pixels, diff.Total, opts.compare, diff.MaxChannelDiff, similarity)
+	}
+	if similarity < opts.compareThreshold {
+		return fmt.Errorf("'%s' is %.2f%% similar to '%s', below the %.2f%% threshold", fileName, similarity, opts.compare, opts.compareThreshold)
+	}
+	return nil
+}
+
+// convertOutputMode converts the output image of fileName to the color model of
+// opts.outputMode; the images having too many colors for a paletted PNG are
+// saved as RGBA8 instead, with a warning
+func convertOutputMode(fileName string, output image.Image, opts *options) image.Image {
+	switch opts.outputMode {
+	case outputModes.RGBA16:
+		if _, ok := output.(*image.RGBA64); !ok {
+			output = imagetransparent.ToRGBA64(output)
+		}
+	case outputModes.Paletted:
+		if paletted, ok := imagetransparent.ToPaletted(output); ok {
+			verboseLog.Printf("%s: converted to %d colors", fileName, len(paletted.Palette))
+			return paletted
+		}
+		if !opts.json {
+			fmt.Fprintf(stderr, "warning: '%s' has more than 256 colors, too many for a paletted PNG - saving it as %s\n", fileName, outputModes.RGBA8)
+		}
+		fallthrough
+	case outputModes.RGBA8:
+		if _, ok := output.(*image.RGBA); !ok {
+			output = imagetransparent.ToRGBA(output)
+		}
+	case outputModes.GrayAlpha:
+		output = imagetransparent.ToGrayAlpha(output)
+	}
+	return output
+}
+
+// writeToleranceSweep saves the -tolerance-sweep contact sheet of imageData,
+// read from fileName, next to where its output would be saved (e.g.
+// out__photo.sweep.png), instead of the output
+func writeToleranceSweep(fileName string, imageData image.Image, transparencyOpts imagetransparent.Options, opts *options, conv *conversion) error {
+	start := time.Now()
+	sheet, err := imagetransparent.ToleranceSweep(imageData, transparencyOpts, opts.toleranceSweep, opts.previewSize)
+	if err != nil {
+		return err
+	}
+	outFileName := opts.outFileName
+	if outFileName == "" {
+		outFileName = outputFileName(fileName, opts)
+	}
+	conv.Output = strings.TrimSuffix(outFileName, filepath.Ext(outFileName)) + ".sweep.png"
+	err = writeFileAtomically(conv.Output, func(w io.Writer) error {
+		return png.Encode(w, sheet)
+	})
+	if err != nil {
+		return err
+	}
+	verboseLog.Printf("%s: saved the sweep of %d tolerances to '%s' in %v", fileName, len(opts.toleranceSweep), conv.Output, time.Since(start))
+	conv.Converted = true
+	return nil
+}
+
+// previewFileName returns the name of the -preview file of the given output
+// file: the same, with the .preview.png extension
+func previewFileName(outFileName string) string {
+	return strings.TrimSuffix(outFileName, filepath.Ext(outFileName)) + ".preview.png"
 }
 
 func main() {
-	if len(os.Args) < 2 {
-		logAndExit("", errors.New("image file path required - e.g. red-jpg.jpg"))
+	opts := options{Options: imagetransparent.DefaultOptions(), outImageType: imagetransparent.ImageTypes.PNG, previewSize: 8}
+	flag.Var(
+		colorsValue{&opts.BackgroundColors},
+		"bg-color",
+		"background color to make transparent, as hex (#FFFFFF) or decimal (255,255,255) - can be repeated to remove several colors;\n"+
+			"by default it is detected from the image corners")
+	flag.StringVar(
+		&opts.backgroundFrom,
+		"background-from",
+		opts.backgroundFrom,
+		"image file of a sample of the background (e.g. a photo of the backdrop alone) whose average color is made transparent, like with -bg-color")
+	flag.Var(
+		backgroundModeValue{&opts.BackgroundMode},
+		"bg-mode",
+		"how the background color is detected: corners (the color shared by most of the image corners), mode (the most frequent color of the image)\n"+
+			"or gradient (interpolated for each pixel between the colors of the corners)")
+	flag.Var(
+		colorsValue{&opts.ProtectColors},
+		"protect",
+		"color never to make transparent, even if it matches the background, as hex (#FFFFFF) or decimal (255,255,255) - can be repeated")
+	flag.Var(
+		toleranceValue{&opts.ProtectTolerance},
+		"protect-tolerance",
+		"max difference (0-255, or a percentage like 5%) per color channel for a pixel to be considered one of the -protect colors")
+	flag.BoolVar(
+		&opts.SampleEdgeMidpoints,
+		"sample-edges",
+		opts.SampleEdgeMidpoints,
+		"also sample the midpoints of the image edges when detecting the background color")
+	flag.IntVar(
+		&opts.BorderSample,
+		"border-sample",
+		opts.BorderSample,
+		"detect the background color as the most frequent color of the band this many pixels thick along the image edges (0 disables it)")
+	flag.StringVar(
+		&opts.preset,
+		"preset",
+		opts.preset,
+		"set the tolerance, metric and mode (and a few more flags) tuned for a kind of image: logo, photo or scan;\n"+
+			"the flags given explicitly override the values of the preset (see the README for what each one sets)")
+	flag.Var(
+		toleranceValue{&opts.Tolerance},
+		"tolerance",
+		"max difference (0-255, or a percentage like 40%) per color channel for a pixel to be considered background")
+	for i, channel := range []string{"red", "green", "blue"} {
+		flag.Var(
+			toleranceValue{&opts.channelTolerances[i]},
+			"tolerance-"+channel[:1],
+			fmt.Sprintf("max difference (0-255, or a percentage) of the %s channel for a pixel to be considered background (default -tolerance),\n"+
+				"e.g. a larger -tolerance-b for a blue sky gradient", channel))
+	}
+	flag.Var(
+		tolerancesValue{&opts.toleranceSweep},
+		"tolerance-sweep",
+		"instead of the output, save a contact sheet of the image made transparent with each of these comma separated tolerances\n"+
+			"(e.g. 20,40,60,80,100,120) over a checkerboard, next to where the output would be saved (e.g. out__photo.sweep.png), to pick the best one")
+	flag.StringVar(
+		&opts.compare,
+		"compare",
+		opts.compare,
+		"instead of saving the output, compare it pixel by pixel with this expected image and report how similar they are,\n"+
+			"failing if the similarity is below -compare-threshold, e.g. for regression tests")
+	flag.Float64Var(
+		&opts.compareThreshold,
+		"compare-threshold",
+		100,
+		"the minimum percentage (0-100) of the pixels of the output which have to be the same as in the -compare image")
+	flag.BoolVar(
+		&opts.autoTolerance,
+		"auto-tolerance",
+		opts.autoTolerance,
+		"derive -tolerance (and -uniform-tolerance) for each image from how much the colors of its border pixels spread around the background color")
+	flag.Var(
+		toleranceValue{&opts.UniformTolerance},
+		"uniform-tolerance",
+		"max difference (0-255) used instead of -tolerance when all channels differ by the same amount")
+	flag.BoolVar(
+		&opts.NoUniformTolerance,
+		"no-uniform-tolerance",
+		opts.NoUniformTolerance,
+		"use -tolerance for all the pixels, also the ones whose channels all differ by the same amount from the background (grays)")
+	flag.BoolVar(
+		&opts.Exact,
+		"exact",
+		opts.Exact,
+		"only make transparent the pixels having exactly the background color - disables all the tolerances")
+	flag.BoolVar(
+		&opts.Linear,
+		"linear",
+		opts.Linear,
+		"compare the colors in linear light instead of sRGB, so that the tolerance catches the shades of dark and light backgrounds\n"+
+			"as evenly (with the rgb and euclidean metrics)")
+	flag.Var(
+		metricValue{&opts.Metric},
+		"metric",
+		"color comparison metric: rgb (per channel difference), euclidean (distance in the RGB space)\n"+
+			"or hsv (hue, saturation and value difference)")
+	flag.Float64Var(
+		&opts.HueTolerance,
+		"hue-tolerance",
+		opts.HueTolerance,
+		"max hue difference in degrees (0-180) for the hsv metric")
+	flag.Var(
+		toleranceValue{&opts.SaturationTolerance},
+		"saturation-tolerance",
+		"max saturation difference (0-255) for the hsv metric")
+	flag.Var(
+		toleranceValue{&opts.ValueTolerance},
+		"value-tolerance",
+		"max value (brightness) difference (0-255) for the hsv metric")
+	flag.Var(
+		chromaKeyValue{&opts.ChromaKey},
+		"chroma",
+		"remove the pixels by their hue instead of by the background color, like keying a green or blue screen:\n"+
+			"green, blue, a hue in degrees (0-360, e.g. #120) or a color whose hue is keyed out (e.g. 0,177,64);\n"+
+			"the hue tolerance is 40 degrees unless -hue-tolerance is given, and grayish pixels are always kept")
+	flag.Var(
+		modeValue{&opts.Mode},
+		"mode",
+		"background removal mode: global (all pixels matching the background color) or flood (only matching pixels connected to the image edges)")
+	flag.Var(
+		pointValue{&opts.SeedPoint},
+		"seed-point",
+		"flood fill the background from this pixel, as x,y from the top-left corner (e.g. 10,20), instead of from the image edges,\n"+
+			"e.g. for a background enclosed by the subject; its color is the background color unless -bg-color is given (implies -mode flood)")
+	flag.BoolVar(
+		&opts.Invert,
+		"invert",
+		opts.Invert,
+		"invert the selection: make transparent the pixels which don't match the background color and keep the matching ones")
+	flag.Var(
+		alphaValue{&opts.BackgroundAlpha},
+		"bg-alpha",
+		"alpha (0-255, or a percentage like 25%) of the background pixels, e.g. to fade the background instead of removing it")
+	flag.Var(
+		colorValue{&opts.ReplaceWith},
+		"replace-with",
+		"replace the background with this opaque color, as hex (#0055FF) or decimal (0,85,255), instead of making it transparent")
+	flag.Var(
+		toleranceValue{&opts.SoftEdges},
+		"soft-edges",
+		"make the pixels nearly matching the background, up to this much (0-255, or a percentage) beyond the tolerance, partially transparent\n"+
+			"in proportion to how close they are to it, for clean keyed edges (0 disables it)")
+	flag.IntVar(
+		&opts.Despeckle,
+		"despeckle",
+		opts.Despeckle,
+		"remove the islands of kept pixels smaller than this many pixels left in the background, and fill back the holes\n"+
+			"smaller than it left in the subject, e.g. for noisy photographs (0 disables it)")
+	flag.IntVar(
+		&opts.MinBackgroundRegion,
+		"min-bg-region",
+		opts.MinBackgroundRegion,
+		"keep the connected areas of pixels matching the background smaller than this many pixels, e.g. glints on the subject,\n"+
+			"removing only the larger ones (0 disables it)")
+	flag.IntVar(
+		&opts.KeepLargest,
+		"keep-largest",
+		opts.KeepLargest,
+		"keep only this many of the largest connected areas of kept pixels, e.g. 1 to isolate a single product from the scattered noise\n"+
+			"left around it, making the others transparent too (0 keeps them all)")
+	flag.IntVar(
+		&opts.FeatherRadius,
+		"feather",
+		opts.FeatherRadius,
+		"soften the cutout edges by ramping up the alpha over this many pixels (0 disables feathering)")
+	flag.BoolVar(
+		&opts.mask,
+		"mask",
+		opts.mask,
+		"output a grayscale mask instead of the cutout: the removed background is black and the kept pixels are white")
+	flag.Var(
+		scaleValue{&opts.scale},
+		"scale",
+		"resize the output, e.g. for thumbnails: by a factor (e.g. 0.5) or to a width (300x), a height (x200) or both (300x200, fitted within them),\n"+
+			"keeping the aspect ratio; the background is removed before resizing, for a sharper cutout, unless -scale-before is given")
+	flag.BoolVar(
+		&opts.scaleBefore,
+		"scale-before",
+		opts.scaleBefore,
+		"with -scale, resize the image before removing its background, which is faster for large images")
+	flag.IntVar(
+		&opts.rotate,
+		"rotate",
+		opts.rotate,
+		"rotate the output clockwise by 90, 180 or 270 degrees")
+	flag.Var(
+		flipValue{&opts.flip},
+		"flip",
+		"flip the output horizontally (h) or vertically (v), after -rotate")
+	flag.BoolVar(
+		&opts.transformBefore,
+		"transform-before",
+		opts.transformBefore,
+		"with -rotate or -flip, transform the image before removing its background instead of the cutout")
+	flag.BoolVar(
+		&opts.preview,
+		"preview",
+		opts.preview,
+		"also save the output composited over a checkerboard, like image editors show transparency, as a flat PNG next to it\n"+
+			"(e.g. out__photo.preview.png), to check the cutout at a glance")
+	flag.IntVar(
+		&opts.previewSize,
+		"preview-size",
+		opts.previewSize,
+		"size in pixels of the squares of the -preview checkerboard")
+	flag.Float64Var(
+		&opts.minCoverage,
+		"min-coverage",
+		5,
+		"warn if less than this percentage (0-100) of the pixels matched the background color")
+	flag.BoolVar(
+		&opts.strict,
+		"strict",
+		opts.strict,
+		"do not save the output if less than -min-coverage percent of the pixels matched the background color")
+	flag.IntVar(
+		&opts.MaxPixels,
+		"max-pixels",
+		opts.MaxPixels,
+		"reject images having more than this many pixels (width x height), e.g. decompression bombs; 0 disables the limit")
+	flag.BoolVar(
+		&opts.requireCorners,
+		"require-corners",
+		opts.requireCorners,
+		"do not convert an image if the detected background color doesn't match all its corners (by default only a warning is printed)")
+	flag.BoolVar(
+		&opts.trim,
+		"trim",
+		opts.trim,
+		"crop the output to the bounding box of the pixels which are not transparent")
+	flag.IntVar(
+		&opts.trimPadding,
+		"trim-padding",
+		opts.trimPadding,
+		"transparent margin in pixels to keep around the content when using -trim")
+	flag.Var(
+		outputImageTypeValue{&opts.outImageType},
+		"format",
+		"output image format: png, webp, gif, bmp, tiff or ico")
+	flag.Var(
+		inputImageTypeValue{&opts.inFormat},
+		"in-format",
+		"decode the input images as this format: jpeg, png, bmp, tiff, gif, webp, ico, avif or heic (with the heif build tag), instead of detecting it from their content and extension")
+	flag.BoolVar(
+		&opts.keepFormat,
+		"keep-format",
+		opts.keepFormat,
+		"save the output in the format of the input image if it supports transparency (all but jpeg, avif and heic), otherwise in the -format one")
+	flag.Var(
+		pngCompressionValue{&opts.encodeOpts.PNGCompression},
+		"compression",
+		"PNG compression level: default, none, best-speed or best-compression")
+	flag.Var(
+		tiffCompressionValue{&opts.encodeOpts.TIFFCompression},
+		"tiff-compression",
+		"TIFF compression: none or deflate (lossless)")
+	flag.IntVar(
+		&opts.encodeOpts.GIFNumColors,
+		"gif-colors",
+		256,
+		"maximum number of colors (2-256) of GIF output, including the transparent one, e.g. to make smaller stickers")
+	flag.Var(
+		gifQuantizerValue{&opts.encodeOpts.GIFQuantizer},
+		"gif-quantizer",
+		"how the palette of GIF output is built: plan9 (a fixed palette) or median-cut (adapted to the colors of the image)")
+	flag.BoolVar(
+		&opts.gifNoDither,
+		"gif-no-dither",
+		opts.gifNoDither,
+		"map each pixel of GIF output to the closest palette color, instead of dithering them")
+	flag.BoolVar(
+		&opts.encodeOpts.WebPLossless,
+		"webp-lossless",
+		opts.encodeOpts.WebPLossless,
+		"encode WebP output losslessly instead of lossy, keeping the sharp edges of logos and UI graphics")
+	flag.Var(
+		icoSizesValue{&opts.encodeOpts.ICOSizes},
+		"ico-sizes",
+		"comma separated sizes (1-256 pixels) of the square images of the ICO output, e.g. 16,32,48 for a favicon;\n"+
+			"by default it has a single image of the size of the input (scaled down to 256x256 if larger)")
+	flag.IntVar(
+		&opts.encodeOpts.JPEGQuality,
+		"jpeg-quality",
+		jpeg.DefaultQuality,
+		"quality (1-100) of the JPEG images re-encoded when piping them through base64")
+	flag.BoolVar(
+		&opts.base64,
+		"base64",
+		opts.base64,
+		"print the output image to stdout as a base64 data URI (data:image/png;base64,...) instead of saving it, e.g. to embed it in HTML or CSS")
+	flag.BoolVar(
+		&opts.clipboard,
+		"clipboard",
+		opts.clipboard,
+		"copy the output image to the clipboard as a PNG, e.g. to paste it into a design tool, instead of saving it (or in addition, if -o is given);\n"+
+			"uses osascript on macOS, PowerShell on Windows and wl-copy (Wayland) or xclip (X11) on Linux")
+	flag.BoolVar(
+		&opts.force8Bit,
+		"8bit",
+		opts.force8Bit,
+		"save 16 bits per channel images with 8 bits per channel, for compatibility")
+	flag.Var(
+		outputModeValue{&opts.outputMode},
+		"output-mode",
+		"color model of the PNG output: rgba8, rgba16 (e.g. for high-fidelity sources), paletted (much smaller for simple subjects,\n"+
+			"saved as rgba8 if the image has more than 256 colors) or gray+alpha; by default it follows the input")
+	flag.BoolVar(
+		&opts.nrgba,
+		"nrgba",
+		opts.nrgba,
+		"save the output with non alpha-premultiplied colors, keeping the color channels of the transparent pixels")
+	flag.BoolVar(
+		&opts.noAutorotate,
+		"no-autorotate",
+		opts.noAutorotate,
+		"do not rotate/flip JPEG and TIFF images according to their EXIF orientation")
+	flag.BoolVar(
+		&opts.stripMetadata,
+		"strip-metadata",
+		opts.stripMetadata,
+		"do not copy the camera, date and copyright from the EXIF of JPEG and TIFF images to the text chunks of the PNG output")
+	flag.BoolVar(
+		&opts.verbose,
+		"v",
+		opts.verbose,
+		"log the details of the processing of each image to stderr: type, dimensions, background color, tolerance, pixels changed and timings")
+	flag.BoolVar(
+		&opts.quiet,
+		"quiet",
+		opts.quiet,
+		"do not show the progress (which is shown only when stderr is a terminal)")
+	flag.IntVar(
+		&opts.Workers,
+		"threads",
+		opts.Workers,
+		"max number of goroutines processing the images, both the rows of an image and, in batch mode, the images;\n"+
+			"1 processes everything sequentially, e.g. for debugging")
+	flag.BoolVar(
+		&opts.preserveTimes,
+		"preserve-times",
+		opts.preserveTimes,
+		"set the modification time of each output file to the one of its input file, e.g. to keep synced folders ordered by capture time")
+	flag.StringVar(
+		&opts.atlas,
+		"atlas",
+		opts.atlas,
+		"pack all the input images, made transparent and trimmed, into this sprite sheet (e.g. sheet.png), described by\n"+
+			"a JSON atlas next to it (e.g. sheet.json) having the rectangle of each sprite by the name of its input file")
+	flag.BoolVar(
+		&opts.recursive,
+		"recursive",
+		opts.recursive,
+		"in batch mode, also process the images in the subdirectories of the directory, mirroring its tree in the -o directory")
+	flag.StringVar(
+		&opts.fromList,
+		"from-list",
+		opts.fromList,
+		"process in batch mode the image files listed one per line in this file, or in stdin if it is -,\n"+
+			"e.g. find . -name '*.jpg' | make-image-transparent -from-list -")
+	flag.StringVar(
+		&opts.watch,
+		"watch",
+		opts.watch,
+		"keep watching this directory, processing the image files which appear in it (or are modified) once they are completely written,\n"+
+			"saving the outputs next to them or in the -o directory, until interrupted")
+	flag.DurationVar(
+		&opts.watchInterval,
+		"watch-interval",
+		2*time.Second,
+		"how often the -watch directory is checked for new images")
+	flag.BoolVar(
+		&opts.failFast,
+		"fail-fast",
+		opts.failFast,
+		"in batch mode, stop at the first image which fails, instead of processing all of them")
+	flag.BoolVar(
+		&opts.dryRun,
+		"dry-run",
+		opts.dryRun,
+		"only print the detected background color and how many pixels would be made transparent, without writing any output")
+	flag.BoolVar(
+		&opts.json,
+		"json",
+		opts.json,
+		"print the outcome of each conversion (input and output paths, background color, dimensions, number of pixels changed)\n"+
+			"as a JSON object on a line of stdout")
+	outputUsage := "output file path, or - to write the image to stdout (default out__<image file name>.<format>);\n" +
+		"in batch mode the directory to write the images to (default the directory of each image)"
+	flag.StringVar(&opts.outFileName, "o", opts.outFileName, outputUsage)
+	flag.StringVar(&opts.outFileName, "output", opts.outFileName, outputUsage)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [<image file> | <directory> | <glob> | <URL> | -] [true|false]\n"+
+			"       %s [flags] <image file | directory | glob>...\n"+
+			"       %s -atlas <sprite sheet> [flags] <image file>...\n", filepath.Base(os.Args[0]), filepath.Base(os.Args[0]), filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+
+	args, err := parseArgs(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		logAndExit(exitUsage, "", err)
+	}
+	// the flags given on the command line or in the config file
+	explicit, given := explicitFlags(flag.CommandLine), explicitFlags(flag.CommandLine)
+	if configFile := findConfigFile(); configFile != "" {
+		configured, err := loadConfig(flag.CommandLine, configFile)
+		if err != nil {
+			logAndExit(exitUsage, "", err)
+		}
+		for name := range configured {
+			given[name] = true
+		}
+	}
+	if opts.preset != "" {
+		// a -preset given on the command line overrides the config file, while
+		// one given in the config file is overridden by the rest of it
+		keep := explicit
+		if !explicit["preset"] {
+			keep = given
+		}
+		if err := applyPreset(flag.CommandLine, opts.preset, keep); err != nil {
+			logAndExit(exitUsage, "", err)
+		}
+	}
+	fileName := stdinFileName
+	if len(args) > 0 {
+		fileName = args[0] // e.g. "red-jpg.jpg"
+	}
+	if opts.fromList != "" && (len(args) > 0 || opts.recursive || opts.atlas != "") {
+		logAndExit(exitUsage, "", errors.New("-from-list cannot be used together with image file arguments, -recursive or -atlas"))
+	}
+	if opts.watch != "" && (len(args) > 0 || opts.fromList != "" || opts.atlas != "") {
+		logAndExit(exitUsage, "", errors.New("-watch cannot be used together with image file arguments, -from-list or -atlas"))
+	}
+	if fileName == stdinFileName && isTerminal(os.Stdin) && opts.fromList == "" && opts.watch == "" {
+		logAndExit(exitUsage, "", errors.New("image file path required - e.g. red-jpg.jpg - or image data piped to stdin"))
+	}
+	if ptb64, ok := pipeThroughBase64Arg(args); ok && opts.atlas == "" {
+		opts.pipeThroughBase64 = ptb64
+		args = args[:1]
+	}
+	if len(args) > 1 && opts.recursive && opts.atlas == "" {
+		logAndExit(exitUsage, "", errors.New("-recursive requires a single directory"))
 	}
 
-	fileName := os.Args[1] // e.g. "red-jpg.jpg"
-	pipeThroughBase64 := false
-	if len(os.Args) > 2 {
-		ptb64, err := strconv.ParseBool(strings.ToLower(os.Args[2]))
+	if opts.HueTolerance < 0 || opts.HueTolerance > 180 {
+		logAndExit(exitUsage, "", fmt.Errorf("hue tolerance has to be between 0 and 180 degrees - got %v", opts.HueTolerance))
+	}
+	if opts.ChromaKey != nil {
+		if given["hue-tolerance"] {
+			opts.ChromaKey.HueTolerance = opts.HueTolerance
+		}
+		if opts.autoTolerance {
+			logAndExit(exitUsage, "", errors.New("-chroma cannot be used together with -auto-tolerance"))
+		}
+	}
+	channelSet := [3]bool{}
+	for i, name := range []string{"tolerance-r", "tolerance-g", "tolerance-b"} {
+		channelSet[i] = given[name]
+	}
+	if channelSet != ([3]bool{}) {
+		if opts.autoTolerance {
+			logAndExit(exitUsage, "", errors.New("-tolerance-r, -tolerance-g and -tolerance-b cannot be used together with -auto-tolerance"))
+		}
+		for i, set := range channelSet {
+			if !set {
+				opts.channelTolerances[i] = opts.Tolerance
+			}
+		}
+		opts.ChannelTolerances = &opts.channelTolerances
+	}
+	if opts.backgroundFrom != "" {
+		swatch, _, err := loadImage(opts.backgroundFrom)
+		if err != nil {
+			logAndExit(exitUsage, "", fmt.Errorf("error when loading background swatch '%s': %w", opts.backgroundFrom, err))
+		}
+		bg, err := imagetransparent.SwatchColor(swatch)
 		if err != nil {
-			logAndExit(fmt.Sprintf("second argument has to be true or false - got %s", os.Args[2]), err)
+			logAndExit(exitUsage, "", fmt.Errorf("error when loading background swatch '%s': %w", opts.backgroundFrom, err))
 		}
-		pipeThroughBase64 = ptb64
+		opts.BackgroundColors = append(opts.BackgroundColors, bg)
+	}
+	if opts.SeedPoint != nil {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "mode" && opts.Mode != imagetransparent.Modes.Flood {
+				logAndExit(exitUsage, "", fmt.Errorf("-seed-point cannot be used together with -mode %s", opts.Mode))
+			}
+		})
+		opts.Mode = imagetransparent.Modes.Flood
+	}
+	if opts.FeatherRadius < 0 {
+		logAndExit(exitUsage, "", fmt.Errorf("feather radius has to be 0 or greater - got %d", opts.FeatherRadius))
+	}
+	if opts.Workers < 1 {
+		logAndExit(exitUsage, "", fmt.Errorf("threads has to be 1 or greater - got %d", opts.Workers))
+	}
+	if opts.BorderSample < 0 {
+		logAndExit(exitUsage, "", fmt.Errorf("border sample has to be 0 or greater - got %d", opts.BorderSample))
+	}
+	if opts.Despeckle < 0 {
+		logAndExit(exitUsage, "", fmt.Errorf("despeckle size has to be 0 or greater - got %d", opts.Despeckle))
+	}
+	if opts.encodeOpts.GIFNumColors < 2 || opts.encodeOpts.GIFNumColors > 256 {
+		logAndExit(exitUsage, "", fmt.Errorf("GIF colors have to be between 2 and 256 - got %d", opts.encodeOpts.GIFNumColors))
+	}
+	if opts.gifNoDither {
+		opts.encodeOpts.GIFDrawer = draw.Src
+	}
+	if opts.MinBackgroundRegion < 0 {
+		logAndExit(exitUsage, "", fmt.Errorf("min background region has to be 0 or greater - got %d", opts.MinBackgroundRegion))
+	}
+	if opts.KeepLargest < 0 {
+		logAndExit(exitUsage, "", fmt.Errorf("keep largest has to be 0 or greater - got %d", opts.KeepLargest))
 	}
 
-	fileExt := filepath.Ext(fileName)
-	imageType := getImageType(fileExt[1:])
-	fileNameNoExt := fileName[0 : len(fileName)-len(fileExt)]
+	if opts.encodeOpts.JPEGQuality < 1 || opts.encodeOpts.JPEGQuality > 100 {
+		logAndExit(exitUsage, "", fmt.Errorf("JPEG quality has to be between 1 and 100 - got %d", opts.encodeOpts.JPEGQuality))
+	}
+	if opts.minCoverage < 0 || opts.minCoverage > 100 {
+		logAndExit(exitUsage, "", fmt.Errorf("min coverage has to be between 0 and 100 - got %v", opts.minCoverage))
+	}
+	if opts.preview {
+		if opts.previewSize < 1 {
+			logAndExit(exitUsage, "", fmt.Errorf("preview size has to be 1 or greater - got %d", opts.previewSize))
+		}
+		if opts.base64 || opts.outFileName == "-" || opts.atlas != "" {
+			logAndExit(exitUsage, "", errors.New("-preview cannot be used together with -base64, -atlas or -o -, it is saved next to the output file"))
+		}
+	}
+	if opts.outputMode != "" {
+		if opts.mask {
+			logAndExit(exitUsage, "", errors.New("-output-mode cannot be used together with -mask"))
+		}
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "format" && opts.outImageType != imagetransparent.ImageTypes.PNG {
+				logAndExit(exitUsage, "", fmt.Errorf("-output-mode is for PNG outputs - got -format %s", opts.outImageType))
+			}
+		})
+	}
+	if opts.mask && opts.ReplaceWith != nil {
+		logAndExit(exitUsage, "", errors.New("-mask cannot be used together with -replace-with"))
+	}
+	if opts.MaxPixels < 0 {
+		logAndExit(exitUsage, "", fmt.Errorf("max pixels has to be 0 or greater - got %d", opts.MaxPixels))
+	}
+	if opts.trimPadding < 0 {
+		logAndExit(exitUsage, "", fmt.Errorf("trim padding has to be 0 or greater - got %d", opts.trimPadding))
+	}
+	if opts.atlas != "" {
+		sheetType := imagetransparent.GetImageType(strings.TrimPrefix(filepath.Ext(opts.atlas), "."))
+		if sheetType == imagetransparent.ImageTypes.JPEG || !imagetransparent.IsEncodable(sheetType) {
+			logAndExit(exitUsage, "", fmt.Errorf("the -atlas sprite sheet has to be a png, webp, gif, bmp, tiff or ico file - got '%s'", opts.atlas))
+		}
+		if opts.outFileName != "" || opts.base64 || opts.dryRun {
+			logAndExit(exitUsage, "", errors.New("-atlas cannot be used together with -o, -base64 or -dry-run"))
+		}
+	}
 
-	imageData := loadImage(fileName, imageType)
+	if len(opts.toleranceSweep) > 0 {
+		if opts.dryRun || opts.base64 || opts.outFileName == "-" || opts.atlas != "" || opts.clipboard || opts.autoTolerance {
+			logAndExit(exitUsage, "", errors.New("-tolerance-sweep cannot be used together with -dry-run, -base64, -atlas, -clipboard, -auto-tolerance or -o -"))
+		}
+	}
+	if opts.rotate != 0 && opts.rotate != 90 && opts.rotate != 180 && opts.rotate != 270 {
+		logAndExit(exitUsage, "", fmt.Errorf("rotation has to be 90, 180 or 270 degrees - got %d", opts.rotate))
+	}
+	if opts.compareThreshold < 0 || opts.compareThreshold > 100 {
+		logAndExit(exitUsage, "", fmt.Errorf("compare threshold has to be between 0 and 100 - got %g", opts.compareThreshold))
+	}
+	if opts.compare != "" {
+		if opts.dryRun || opts.base64 || opts.outFileName != "" || opts.atlas != "" || opts.clipboard || opts.preview || len(opts.toleranceSweep) > 0 {
+			logAndExit(exitUsage, "", errors.New("-compare cannot be used together with -dry-run, -base64, -o, -atlas, -clipboard, -preview or -tolerance-sweep, it saves no output"))
+		}
+		expected, _, err := loadImage(opts.compare)
+		if err != nil {
+			logAndExit(exitUsage, "", fmt.Errorf("error when loading the image to compare with '%s': %w", opts.compare, err))
+		}
+		opts.expected = expected
+	}
+	if opts.clipboard {
+		flag.Visit(func(f *flag.Flag) {
+			if (f.Name == "format" && opts.outImageType != imagetransparent.ImageTypes.PNG) || f.Name == "keep-format" {
+				logAndExit(exitUsage, "", errors.New("-clipboard copies PNG images, it cannot be used together with -format or -keep-format"))
+			}
+		})
+		// nor with the ones of the config file, which it overrides
+		opts.outImageType, opts.keepFormat = imagetransparent.ImageTypes.PNG, false
+		if opts.base64 || opts.outFileName == "-" || opts.atlas != "" || opts.dryRun {
+			logAndExit(exitUsage, "", errors.New("-clipboard cannot be used together with -base64, -atlas, -dry-run or -o -"))
+		}
+		if (opts.preview || opts.preserveTimes) && opts.outFileName == "" {
+			logAndExit(exitUsage, "", errors.New("-preview and -preserve-times require -o when used together with -clipboard"))
+		}
+	}
+	if opts.base64 {
+		if opts.outFileName != "" {
+			logAndExit(exitUsage, "", errors.New("-base64 cannot be used together with -o, it writes to stdout"))
+		}
+		opts.outFileName = "-"
+	}
+	if opts.json && opts.outFileName == "-" {
+		logAndExit(exitUsage, "", errors.New("-json cannot be used when writing the image to stdout"))
+	}
 
-	if pipeThroughBase64 {
-		base64Encoded := encodeImageToBase64(imageData, imageType)
-		imageData = decodeImageFromBase64([]byte(base64Encoded))
+	if opts.verbose {
+		verboseLog.SetOutput(stderr)
+	} else if !opts.quiet && isTerminal(os.Stderr) {
+		opts.progress = &progressLine{}
+	}
+
+	if opts.atlas != "" {
+		sprites, err := argsFiles(args, opts.recursive)
+		if err != nil {
+			logAndExit(exitFailure, "", err)
+		}
+		if len(sprites) == 0 {
+			logAndExit(exitUsage, "", errors.New("-atlas requires the image files of the sprites"))
+		}
+		if err := makeAtlas(sprites, &opts); err != nil {
+			logAndExit(exitCode(err), "", err)
+		}
+		return
 	}
 
-	ok, imageRGBA := makeBackgroundTransparent(imageData)
-	if !ok {
-		logAndExit("", errors.New("image not converted - it was probably already transparent"))
+	if opts.watch != "" {
+		if info, err := os.Stat(opts.watch); err != nil || !info.IsDir() {
+			logAndExit(exitUsage, "", fmt.Errorf("-watch requires a directory - got '%s'", opts.watch))
+		}
+		if opts.watchInterval <= 0 {
+			logAndExit(exitUsage, "", fmt.Errorf("watch interval has to be greater than 0 - got %v", opts.watchInterval))
+		}
+		if opts.outFileName == "-" || opts.clipboard || opts.compare != "" {
+			logAndExit(exitUsage, "", errors.New("-watch cannot be used together with -o -, -base64, -clipboard or -compare"))
+		}
+		if opts.recursive {
+			opts.batchRoot = opts.watch
+		}
+		opts.outDir, opts.outFileName = opts.outFileName, ""
+		opts.progress = nil
+		if err := watchDir(handleInterrupts(), opts.watch, opts.watchInterval, &opts); err != nil {
+			logAndExit(exitFailure, "", err)
+		}
+		return
 	}
 
-	outFileName := "out__" + fileNameNoExt + ".png"
-	outFile := createFile(outFileName)
-	defer outFile.Close()
+	var files []string
+	isBatch := opts.fromList != ""
+	if isBatch {
+		data, err := readInput(opts.fromList)
+		if err != nil {
+			logAndExit(exitFailure, "", err)
+		}
+		files = parseFileList(data)
+	} else if len(args) > 1 {
+		// several images, e.g. a glob expanded by the shell
+		isBatch = true
+		if files, err = argsFiles(args, false); err != nil {
+			logAndExit(exitFailure, "", err)
+		}
+	} else if files, isBatch, err = batchFiles(fileName, opts.recursive); err != nil {
+		logAndExit(exitFailure, "", err)
+	}
+	if opts.recursive {
+		if info, err := os.Stat(fileName); err != nil || !info.IsDir() {
+			logAndExit(exitUsage, "", errors.New("-recursive requires a directory"))
+		}
+		opts.batchRoot = fileName
+	}
+	if isBatch {
+		if opts.outFileName == "-" {
+			logAndExit(exitUsage, "", errors.New("writing to stdout is not supported in batch mode"))
+		}
+		if opts.clipboard {
+			logAndExit(exitUsage, "", errors.New("-clipboard is not supported in batch mode"))
+		}
+		if opts.compare != "" {
+			logAndExit(exitUsage, "", errors.New("-compare is not supported in batch mode"))
+		}
+		opts.outDir, opts.outFileName = opts.outFileName, ""
+		summary := processBatch(handleInterrupts(), files, &opts)
+		if summary.interrupted {
+			os.Exit(exitInterrupted)
+		}
+		if summary.failed > 0 {
+			os.Exit(exitFailure)
+		}
+		return
+	}
 
-	errEncode := png.Encode(outFile, imageRGBA)
-	if errEncode != nil {
-		logAndExit(fmt.Sprintf("error when encoding image file '%s':", outFileName), errEncode)
+	conv, err := processFile(fileName, &opts)
+	if opts.json {
+		printJSON(conv, err)
+	}
+	if err != nil {
+		logAndExit(exitCode(err), "", err)
 	}
 }
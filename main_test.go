@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/padurean/make-image-transparent/imagetransparent"
+)
+
+func TestOutputFileName(t *testing.T) {
+	tests := []struct {
+		fileName string
+		outDir   string
+		want     string
+	}{
+		{"photo.jpg", "", "out__photo.png"},
+		{filepath.Join("images", "photo.jpg"), "", filepath.Join("images", "out__photo.png")},
+		{filepath.Join("images", "photo.jpg"), "transparent", filepath.Join("transparent", "out__photo.png")},
+		{"archive.tar.gz", "", "out__archive.tar.png"},
+		{"noext", "", "out__noext.png"},
+		{"FILE.JPG", "", "out__FILE.png"},
+		{filepath.Join("images.d", "noext"), "", filepath.Join("images.d", "out__noext.png")},
+		{stdinFileName, "", "out__stdin.png"},
+		{"https://example.com/images/photo.jpg?size=large", "", "out__photo.png"},
+	}
+	for _, tt := range tests {
+		opts := options{outImageType: imagetransparent.ImageTypes.PNG, outDir: tt.outDir}
+		if got := outputFileName(tt.fileName, &opts); got != tt.want {
+			t.Errorf("outputFileName(%q) = %q, want %q", tt.fileName, got, tt.want)
+		}
+	}
+
+	opts := options{outImageType: imagetransparent.ImageTypes.PNG, outDir: "transparent", batchRoot: "images"}
+	fileName := filepath.Join("images", "icons", "photo.jpg")
+	if got, want := outputFileName(fileName, &opts), filepath.Join("transparent", "icons", "out__photo.png"); got != want {
+		t.Errorf("outputFileName(%q) with batchRoot = %q, want %q", fileName, got, want)
+	}
+}
+
+func TestDetectImageType(t *testing.T) {
+	pngHeader := []byte("\x89PNG\r\n\x1a\n")
+	unknown := []byte("not an image")
+	tests := []struct {
+		fileName string
+		data     []byte
+		want     imagetransparent.ImageType
+	}{
+		{"noext", pngHeader, imagetransparent.ImageTypes.PNG},
+		{"noext", unknown, imagetransparent.ImageTypes.UNSUPPORTED},
+		{"FILE.JPG", unknown, imagetransparent.ImageTypes.JPEG},
+		{"photo.jpeg", unknown, imagetransparent.ImageTypes.JPEG},
+		{"FILE.JPG", pngHeader, imagetransparent.ImageTypes.PNG},
+		{"archive.tar.gz", unknown, imagetransparent.ImageTypes.UNSUPPORTED},
+		{"dir.d/noext", unknown, imagetransparent.ImageTypes.UNSUPPORTED},
+		{stdinFileName, unknown, imagetransparent.ImageTypes.UNSUPPORTED},
+	}
+	for _, tt := range tests {
+		if got := detectImageType(tt.data, tt.fileName, ""); got != tt.want {
+			t.Errorf("detectImageType(%q, %q) = %s, want %s", tt.data, tt.fileName, got, tt.want)
+		}
+	}
+}
+
+func TestBatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"noext":          "\x89PNG\r\n\x1a\n",
+		"notes":          "not an image",
+		"FILE.JPG":       "",
+		"archive.tar.gz": "",
+		"out__FILE.png":  "",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, isBatch, err := batchFiles(dir, false)
+	if err != nil || !isBatch {
+		t.Fatalf("batchFiles(%q, false) = %v, %v, want a batch", dir, isBatch, err)
+	}
+	want := []string{filepath.Join(dir, "FILE.JPG"), filepath.Join(dir, "noext")}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("batchFiles(%q, false) = %v, want %v", dir, got, want)
+	}
+
+	for _, sub := range []string{"sub", ".git"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, sub, "a.png"), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, _, err = batchFiles(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, filepath.Join(dir, "sub", "a.png"))
+	if len(got) != len(want) || got[2] != want[2] {
+		t.Errorf("batchFiles(%q, true) = %v, want %v", dir, got, want)
+	}
+}
+
+func TestArgsFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.png", "sub/c.gif", "sub/d.gif"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// files, e.g. of a glob expanded by the shell, a glob and a directory
+	args := []string{filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.png"), filepath.Join(dir, "*.jpg"), filepath.Join(dir, "sub")}
+	got, err := argsFiles(args, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{args[0], args[1], args[0], filepath.Join(dir, "sub", "c.gif"), filepath.Join(dir, "sub", "d.gif")}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("argsFiles = %v, want %v", got, want)
+	}
+}
+
+func TestPipeThroughBase64Arg(t *testing.T) {
+	dir := t.TempDir()
+	imageFile, existing := filepath.Join(dir, "a.jpg"), filepath.Join(dir, "true")
+	for _, path := range []string{imageFile, existing} {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		args          []string
+		want, wantArg bool
+	}{
+		{[]string{imageFile, "true"}, true, true},
+		{[]string{imageFile, "FALSE"}, false, true},
+		{[]string{imageFile}, false, false},
+		// several images
+		{[]string{imageFile, "b.jpg"}, false, false},
+		{[]string{imageFile, "b.jpg", "true"}, false, false},
+		{[]string{imageFile, existing}, false, false},
+		// a batch and an image
+		{[]string{dir, "true"}, false, false},
+	}
+	for _, tt := range tests {
+		got, gotArg := pipeThroughBase64Arg(tt.args)
+		if got != tt.want || gotArg != tt.wantArg {
+			t.Errorf("pipeThroughBase64Arg(%q) = %t, %t, want %t, %t", tt.args, got, gotArg, tt.want, tt.wantArg)
+		}
+	}
+}
+
+func TestParseFileList(t *testing.T) {
+	got := parseFileList([]byte("a.jpg\r\n\n  \nphotos/b c.png\nlast.gif"))
+	want := []string{"a.jpg", "photos/b c.png", "last.gif"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("parseFileList = %q, want %q", got, want)
+	}
+}
+
+func TestProcessFile(t *testing.T) {
+	opts := options{
+		Options:      imagetransparent.DefaultOptions(),
+		outImageType: imagetransparent.ImageTypes.PNG,
+		outDir:       t.TempDir(),
+	}
+	conv, err := processFile("sample--grey-on-white--jpg.jpg", &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conv.Converted || conv.Width != 600 || conv.Height != 400 || conv.PixelsChanged == 0 {
+		t.Errorf("unexpected conversion %+v", conv)
+	}
+
+	f, err := os.Open(conv.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("background alpha = %d, want 0", a)
+	}
+	if _, _, _, a := img.At(300, 150).RGBA(); a == 0 {
+		t.Error("foreground pixel is transparent")
+	}
+}
+
+func TestProcessFilePreserveTimes(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photo.jpg")
+	data, err := os.ReadFile("sample--grey-on-white--jpg.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(input, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := os.Chtimes(input, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := options{
+		Options:       imagetransparent.DefaultOptions(),
+		outImageType:  imagetransparent.ImageTypes.PNG,
+		preserveTimes: true,
+	}
+	conv, err := processFile(input, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(conv.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("output modification time = %v, want %v", info.ModTime(), mtime)
+	}
+}
+
+func TestProcessBatchInterrupted(t *testing.T) {
+	outDir := t.TempDir()
+	opts := options{
+		Options:      imagetransparent.DefaultOptions(),
+		outImageType: imagetransparent.ImageTypes.PNG,
+		outDir:       outDir,
+	}
+	files := []string{"sample--grey-on-white--jpg.jpg", "sample--yellow-on-red--jpg.jpg"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	summary := processBatch(ctx, files, &opts)
+	if !summary.interrupted || summary.notProcessed != len(files) || summary.converted != 0 {
+		t.Errorf("canceled run summary = %+v, want %d files not processed", summary, len(files))
+	}
+	if entries, _ := os.ReadDir(outDir); len(entries) != 0 {
+		t.Errorf("canceled run wrote %d files", len(entries))
+	}
+
+	summary = processBatch(context.Background(), files, &opts)
+	if summary.interrupted || summary.converted != len(files) {
+		t.Errorf("run summary = %+v, want %d files converted", summary, len(files))
+	}
+}
+
+func TestWatcherPoll(t *testing.T) {
+	dir := t.TempDir()
+	opts := options{Options: imagetransparent.DefaultOptions(), outImageType: imagetransparent.ImageTypes.PNG}
+	w := newWatcher(dir, &opts)
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	poll := func(want ...string) {
+		t.Helper()
+		got, err := w.poll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) || (len(got) > 0 && got[0] != filepath.Join(dir, want[0])) {
+			t.Errorf("poll = %v, want %v", got, want)
+		}
+	}
+
+	// a file already converted by a previous run is skipped
+	write("old.png", "old")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "old.png"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	write("out__old.png", "")
+	poll()
+	poll()
+
+	// a file is ready once it didn't change between two polls
+	write("a.png", "being written")
+	poll()
+	write("a.png", "being written, still")
+	poll()
+	poll("a.png")
+	poll()
+}
+
+// failingWriter fails once n bytes were written to w
+type failingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > f.n {
+		n, _ := f.w.Write(p[:f.n])
+		f.n -= n
+		return n, errDiskFull
+	}
+	f.n -= len(p)
+	return f.w.Write(p)
+}
+
+var errDiskFull = errors.New("disk full")
+
+func TestWriteFileAtomicallyFailure(t *testing.T) {
+	dir := t.TempDir()
+	outFileName := filepath.Join(dir, "out.png")
+	if err := os.WriteFile(outFileName, []byte("previous output"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+
+	err := writeFileAtomically(outFileName, func(w io.Writer) error {
+		return png.Encode(&failingWriter{w: w, n: 100}, img)
+	})
+	if !errors.Is(err, errDiskFull) {
+		t.Fatalf("writeFileAtomically error = %v, want %v", err, errDiskFull)
+	}
+	if !strings.Contains(err.Error(), "100 bytes written") {
+		t.Errorf("writeFileAtomically error = %q, want it to tell that 100 bytes were written", err)
+	}
+	if data, _ := os.ReadFile(outFileName); string(data) != "previous output" {
+		t.Errorf("the previous output was changed to %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files left in %q, want only the previous output", len(entries), dir)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "a", "b")
+	for _, d := range []string{dir, missing} {
+		if err := checkWritable(d); err != nil {
+			t.Errorf("checkWritable(%q) = %v, want nil", d, err)
+		}
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("checkWritable created %q", missing)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("checkWritable left %d files in %q", len(entries), dir)
+	}
+
+	if os.Geteuid() == 0 || runtime.GOOS == "windows" {
+		t.Skip("the directory permissions aren't enforced")
+	}
+	readOnly := filepath.Join(dir, "read-only")
+	if err := os.Mkdir(readOnly, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWritable(readOnly); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("checkWritable of a read-only directory = %v, want a permission error", err)
+	}
+}
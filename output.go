@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// syncWriter serializes the writes to w, so that the messages of the files
+// processed concurrently in batch mode don't interleave
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// stdout and stderr are where all the output of the tool goes; each write (e.g.
+// a whole message printed with fmt.Fprintf) is serialized
+var (
+	stdout io.Writer = &syncWriter{w: os.Stdout}
+	stderr io.Writer = &syncWriter{w: os.Stderr}
+)
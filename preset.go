@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// presets map the names of the -preset values to the flags they set, tuned for
+// common kinds of images so that one doesn't need to pick tolerances:
+//   - logo: flat backgrounds, removed also inside the shapes (e.g. the holes of
+//     letters), with a little softening of the anti-aliased edges
+//   - photo: uneven backgrounds (shadows, gradients, noise) around a subject,
+//     removed only where connected to the image edges
+//   - scan: paper backgrounds of scanned documents or drawings, whose color is
+//     the most frequent one, and their specks
+var presets = map[string]map[string]string{
+	"logo": {
+		"tolerance":         "30",
+		"uniform-tolerance": "30",
+		"metric":            "rgb",
+		"mode":              "global",
+		"soft-edges":        "20",
+	},
+	"photo": {
+		"tolerance":         "40",
+		"uniform-tolerance": "40",
+		"metric":            "euclidean",
+		"mode":              "flood",
+		"border-sample":     "4",
+		"soft-edges":        "30",
+		"despeckle":         "50",
+	},
+	"scan": {
+		"tolerance":         "60",
+		"uniform-tolerance": "60",
+		"metric":            "rgb",
+		"mode":              "global",
+		"bg-mode":           "mode",
+		"linear":            "true",
+		"despeckle":         "20",
+	},
+}
+
+// presetNames returns the names of the presets, sorted
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyPreset sets the flags of fs, but the ones in keep, to the values of the
+// named preset. It is called after the command line flags are parsed and the
+// config file is loaded, so the preset overrides the config file values unless
+// they are in keep: the flags given on the command line and, if the preset is
+// given in the config file, the rest of the config file ones. The preset values
+// are set like defaults: the flags aren't visited as set by fs.Visit, so they
+// don't conflict with the flags implying others (e.g. the mode of a preset with
+// -seed-point).
+func applyPreset(fs *flag.FlagSet, name string, keep map[string]bool) error {
+	values, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("invalid preset '%s' - it has to be one of %s", name, strings.Join(presetNames(), ", "))
+	}
+	for flagName, value := range values {
+		if keep[flagName] {
+			continue
+		}
+		if err := fs.Lookup(flagName).Value.Set(value); err != nil {
+			return fmt.Errorf("invalid %s of preset '%s': %w", flagName, name, err)
+		}
+	}
+	return nil
+}
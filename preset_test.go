@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyPreset(t *testing.T) {
+	var tolerance, uniformTolerance, softEdges uint8
+	var mode, metric string
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(toleranceValue{&tolerance}, "tolerance", "")
+	fs.Var(toleranceValue{&uniformTolerance}, "uniform-tolerance", "")
+	fs.Var(toleranceValue{&softEdges}, "soft-edges", "")
+	fs.StringVar(&mode, "mode", "flood", "")
+	fs.StringVar(&metric, "metric", "hsv", "")
+	if err := fs.Parse([]string{"-tolerance", "50"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyPreset(fs, "logo", explicitFlags(fs)); err != nil {
+		t.Fatal(err)
+	}
+
+	if uniformTolerance != 30 || softEdges != 20 || mode != "global" || metric != "rgb" {
+		t.Errorf("uniform tolerance = %d, soft edges = %d, mode = %s, metric = %s, want the preset values",
+			uniformTolerance, softEdges, mode, metric)
+	}
+	if tolerance != 50 {
+		t.Errorf("tolerance = %d, want the command line value 50", tolerance)
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "tolerance" {
+			t.Errorf("flag %s set by the preset is visited as set explicitly", f.Name)
+		}
+	})
+
+	if err := applyPreset(fs, "unknown", nil); err == nil {
+		t.Error("unknown preset was applied")
+	}
+}
+
+func TestApplyPresetOverConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), configFileName)
+	tests := []struct {
+		config                              string
+		args                                []string
+		wantTolerance, wantUniformTolerance uint8
+	}{
+		// the preset of the command line overrides the config file
+		{`{"tolerance": 50}`, []string{"-preset", "logo"}, 30, 30},
+		// and is overridden by the command line flags
+		{`{"tolerance": 50}`, []string{"-preset", "logo", "-tolerance", "70"}, 70, 30},
+		// the preset of the config file is overridden by the rest of it
+		{`{"preset": "logo", "tolerance": 50}`, nil, 50, 30},
+	}
+	for _, tt := range tests {
+		var tolerance, uniformTolerance uint8
+		var preset string
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.Var(toleranceValue{&tolerance}, "tolerance", "")
+		fs.Var(toleranceValue{&uniformTolerance}, "uniform-tolerance", "")
+		for _, name := range []string{"metric", "mode", "soft-edges"} {
+			fs.String(name, "", "")
+		}
+		fs.StringVar(&preset, "preset", "", "")
+		if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		explicit := explicitFlags(fs)
+		configured, err := loadConfig(fs, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// like main does
+		keep := explicit
+		if !explicit["preset"] {
+			for name := range configured {
+				keep[name] = true
+			}
+		}
+		if err := applyPreset(fs, preset, keep); err != nil {
+			t.Fatal(err)
+		}
+		if tolerance != tt.wantTolerance || uniformTolerance != tt.wantUniformTolerance {
+			t.Errorf("config %s, args %v: tolerance = %d, uniform tolerance = %d, want %d and %d",
+				tt.config, tt.args, tolerance, uniformTolerance, tt.wantTolerance, tt.wantUniformTolerance)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// progressLine prints progress messages to stderr on a single line, which is
+// rewritten by each message; it is safe for concurrent use
+type progressLine struct {
+	mu   sync.Mutex
+	last string
+}
+
+// print replaces the current progress message with msg, unless it is the same
+func (p *progressLine) print(msg string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if msg == p.last {
+		return
+	}
+	fmt.Fprintf(stderr, "\r\033[K%s", msg)
+	p.last = msg
+}
+
+// clear erases the current progress message, if any
+func (p *progressLine) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last != "" {
+		fmt.Fprint(stderr, "\r\033[K")
+		p.last = ""
+	}
+}
+
+// imageProgress returns an imagetransparent.Options.Progress function which
+// prints the percentage of the rows of the image fileName processed so far
+func (p *progressLine) imageProgress(fileName string) func(done, total int) {
+	if fileName == stdinFileName {
+		fileName = "stdin"
+	}
+	return func(done, total int) {
+		p.print(fmt.Sprintf("%s: %d%%", fileName, 100*done/total))
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// tempFiles holds the names of the temporary files being written by
+// writeFileAtomically, which are removed if the run is stopped right away
+var tempFiles sync.Map
+
+// handleInterrupts returns a context which is canceled on the first SIGINT
+// (Ctrl-C) or SIGTERM, so that the batch run starts no more files but finishes
+// the ones in progress; on the second one the temporary files being written are
+// removed and the process exits right away, with exitInterrupted
+func handleInterrupts() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Fprintln(stderr, "interrupted: finishing the images in progress, interrupt again to stop right away")
+		cancel()
+		<-signals
+		tempFiles.Range(func(name, _ any) bool {
+			os.Remove(name.(string))
+			return true
+		})
+		os.Exit(exitInterrupted)
+	}()
+	return ctx
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/padurean/make-image-transparent/imagetransparent"
+)
+
+// urlTimeout is the max time allowed for downloading an image from a URL
+const urlTimeout = 30 * time.Second
+
+// isURL reports whether s is an http or https URL
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// urlFileName returns the last element of the path of the URL s (e.g.
+// photo.jpg for https://example.com/images/photo.jpg?size=large), or "url" if
+// the path is empty
+func urlFileName(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "url"
+	}
+	base := path.Base(u.Path)
+	if base == "." || base == "/" {
+		return "url"
+	}
+	return base
+}
+
+// readURL downloads the image from the http(s) URL rawURL and checks that the
+// Content-Type of the response, if it is an image one, matches the content
+func readURL(rawURL string) ([]byte, error) {
+	client := http.Client{Timeout: urlTimeout}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("error when downloading '%s': %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error when downloading '%s': %s", rawURL, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error when downloading '%s': %w", rawURL, err)
+	}
+
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0]))
+	if contentType != "" && contentType != "application/octet-stream" && !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("'%s' is not an image - its content type is %s", rawURL, contentType)
+	}
+	if strings.HasPrefix(contentType, "image/") {
+		declared := imagetransparent.GetImageType(strings.TrimPrefix(strings.TrimPrefix(contentType, "image/"), "x-ms-"))
+		sniffed := imagetransparent.SniffImageType(data)
+		if declared != imagetransparent.ImageTypes.UNSUPPORTED && sniffed != imagetransparent.ImageTypes.UNSUPPORTED && declared != sniffed {
+			return nil, fmt.Errorf("the content type of '%s' is %s, but its content is %s", rawURL, contentType, sniffed)
+		}
+	}
+	return data, nil
+}
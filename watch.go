@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/padurean/make-image-transparent/imagetransparent"
+)
+
+// fileState is the size and modification time of a watched file
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// watcher finds the image files of a watched directory (see batchFiles) which
+// are ready to be processed, by polling it: there are no filesystem
+// notifications in the standard library
+type watcher struct {
+	dir  string
+	opts *options
+	// pending are the states of the files seen by the previous poll which
+	// weren't ready yet
+	pending map[string]fileState
+	// processed are the modification times of the files processed, or skipped
+	// because their output was already newer
+	processed map[string]time.Time
+}
+
+func newWatcher(dir string, opts *options) *watcher {
+	return &watcher{dir: dir, opts: opts, pending: make(map[string]fileState), processed: make(map[string]time.Time)}
+}
+
+// poll returns the files which are ready to be processed: the ones having the
+// same size and modification time as at the previous poll, which are not being
+// written anymore, and which weren't processed already with that modification
+// time. The files whose output is newer than them when they are first seen,
+// e.g. converted by a previous run, are skipped.
+func (w *watcher) poll() ([]string, error) {
+	files, _, err := batchFiles(w.dir, w.opts.recursive)
+	if err != nil {
+		return nil, err
+	}
+	var ready []string
+	pending := make(map[string]fileState)
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			// e.g. removed since listed
+			continue
+		}
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+		if modTime, ok := w.processed[file]; ok && modTime.Equal(state.modTime) {
+			continue
+		}
+		previous, seen := w.pending[file]
+		if !seen && w.upToDate(file, state) {
+			w.processed[file] = state.modTime
+			continue
+		}
+		if seen && previous.size == state.size && previous.modTime.Equal(state.modTime) && state.size > 0 {
+			w.processed[file] = state.modTime
+			ready = append(ready, file)
+			continue
+		}
+		pending[file] = state
+	}
+	w.pending = pending
+	return ready, nil
+}
+
+// upToDate reports whether the output of file exists and is at least as new as
+// it
+func (w *watcher) upToDate(file string, state fileState) bool {
+	info, err := os.Stat(outputFileName(file, w.opts))
+	return err == nil && !info.ModTime().Before(state.modTime)
+}
+
+// watchDir processes the image files which appear in dir, or are modified,
+// polling it every interval until ctx is canceled; the outcome of each file is
+// printed like with -from-list. The files in it when it starts are processed
+// too, unless their output is newer.
+func watchDir(ctx context.Context, dir string, interval time.Duration, opts *options) error {
+	w := newWatcher(dir, opts)
+	fmt.Fprintf(stderr, "watching '%s' for images - press Ctrl-C to stop\n", dir)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ready, err := w.poll()
+		if err != nil {
+			return err
+		}
+		for _, file := range ready {
+			if ctx.Err() != nil {
+				return nil
+			}
+			conv, err := processFile(file, opts)
+			if opts.json {
+				printJSON(conv, err)
+			} else {
+				printFileOutcome(file, conv, err)
+			}
+			if err != nil && !errors.Is(err, imagetransparent.ErrNotConverted) {
+				fmt.Fprintf(stderr, "%s: %v\n", file, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}